@@ -0,0 +1,96 @@
+package brrr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/moby/moby/client"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/log"
+)
+
+// Attach adopts an already running postgres container, referenced by container ID or name, and sets up the
+// template database in it. The container is expected to expose 5432/tcp on the host.
+//
+// The lifecycle of the container is left to whoever started it: Close only releases brrr's own connections.
+// User and Password default to POSTGRES_USER/POSTGRES_PASSWORD from the container's environment when empty,
+// and the template database is created if it does not exist yet. Restore isolation is not supported.
+func Attach(ctx context.Context, containerRef string, cfg Config) (*Container, error) {
+	start := time.Now()
+	cfg, report := newReport(cfg.applyPresets())
+
+	cfg, err := resolveCredentials(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := validate(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.isolation() == Restore {
+		return nil, errors.New("restore isolation requires a container started by brrr")
+	}
+
+	cli, err := testcontainers.NewDockerClientWithOpts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create docker client: %w", err)
+	}
+	defer cli.Close()
+
+	res, err := cli.ContainerInspect(ctx, containerRef, client.ContainerInspectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect container %s: %w", containerRef, err)
+	}
+	inspect := res.Container
+	if inspect.State == nil || !inspect.State.Running {
+		return nil, fmt.Errorf("container %s is not running", containerRef)
+	}
+
+	if inspect.Config != nil {
+		report.Image = inspect.Config.Image
+		env := containerEnv(inspect.Config.Env)
+		if cfg.User == "" {
+			cfg.User = env["POSTGRES_USER"]
+			if cfg.User == "" {
+				cfg.User = "postgres"
+			}
+		}
+		if cfg.Password == "" {
+			cfg.Password = env["POSTGRES_PASSWORD"]
+		}
+	}
+
+	var logger log.Logger
+	if cfg.Logger != nil {
+		logger = &SlogAdapter{logger: cfg.Logger}
+	}
+
+	// Reusing by name hands us a regular testcontainers handle for the running container, without starting
+	// or recreating anything.
+	db, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Name:         strings.TrimPrefix(inspect.Name, "/"),
+			Image:        inspect.Image,
+			ExposedPorts: []string{"5432/tcp"},
+		},
+		Logger: logger,
+		Reuse:  true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach to container %s: %w", containerRef, err)
+	}
+
+	return setupTemplate(ctx, cfg, &dockerServer{container: db, family: cfg.AddressFamily}, report, start)
+}
+
+// containerEnv turns a container's KEY=VALUE environment list into a map.
+func containerEnv(env []string) map[string]string {
+	m := make(map[string]string, len(env))
+	for _, kv := range env {
+		k, v, _ := strings.Cut(kv, "=")
+		m[k] = v
+	}
+	return m
+}
@@ -0,0 +1,126 @@
+package brrr_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/modfin/brrr"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+func TestAttach_ManagesTemplateWithoutOwningContainer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	pg := startExternalContainer(ctx, t)
+
+	c, err := brrr.Attach(ctx, pg.GetContainerID(), brrr.Config{Database: "attached"})
+	if err != nil {
+		t.Fatalf("Attach: %v", err)
+	}
+
+	di, err := c.NewInstance(ctx)
+	if err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+	if err := c.CloseInstance(ctx, di); err != nil {
+		t.Fatalf("CloseInstance: %v", err)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	state, err := pg.State(ctx)
+	if err != nil {
+		t.Fatalf("State: %v", err)
+	}
+	if !state.Running {
+		t.Fatal("expected attached container to keep running after Close")
+	}
+}
+
+func TestAttach_DropsStaleInstances(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	pg := startExternalContainer(ctx, t)
+
+	crashed, err := brrr.Attach(ctx, pg.GetContainerID(), brrr.Config{Database: "stale"})
+	if err != nil {
+		t.Fatalf("Attach: %v", err)
+	}
+	// A run crashing leaves its instances and dump clones behind.
+	stale, err := crashed.NewInstance(ctx)
+	if err != nil {
+		crashed.Close()
+		t.Fatalf("NewInstance: %v", err)
+	}
+	if _, err := stale.Connection.Exec(ctx, `CREATE DATABASE stale_dump_0123abcd`); err != nil {
+		crashed.Close()
+		t.Fatalf("create dump clone: %v", err)
+	}
+	_ = stale.Connection.Close(ctx)
+	crashed.Close()
+
+	c, err := brrr.Attach(ctx, pg.GetContainerID(), brrr.Config{Database: "stale"})
+	if err != nil {
+		t.Fatalf("Attach: %v", err)
+	}
+	defer c.Close()
+
+	di, err := c.NewInstance(ctx)
+	if err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+	defer c.CloseInstance(ctx, di)
+
+	var left []string
+	rows, err := di.Connection.Query(ctx, `SELECT datname FROM pg_database WHERE datname IN ($1, 'stale_dump_0123abcd')`, stale.Name)
+	if err != nil {
+		t.Fatalf("list databases: %v", err)
+	}
+	if left, err = pgx.CollectRows(rows, pgx.RowTo[string]); err != nil {
+		t.Fatalf("list databases: %v", err)
+	}
+	if len(left) > 0 {
+		t.Errorf("expected stale databases to be dropped, found %v", left)
+	}
+}
+
+func TestAttach_ValidatesConfig(t *testing.T) {
+	_, err := brrr.Attach(t.Context(), "brrr-missing", brrr.Config{
+		Database:       "attached",
+		MigrationsPath: "testdata/migrations",
+		MigrationsFS:   fstest.MapFS{},
+	})
+	if err == nil || !strings.Contains(err.Error(), "only one of MigrationsPath and MigrationsFS") {
+		t.Errorf("expected the config to be rejected before attaching, got %v", err)
+	}
+}
+
+// startExternalContainer starts a postgres container not managed by brrr, terminated when t completes.
+func startExternalContainer(ctx context.Context, t *testing.T) testcontainers.Container {
+	t.Helper()
+
+	pg, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        "postgres:17.2",
+			ExposedPorts: []string{"5432/tcp"},
+			Env: map[string]string{
+				"POSTGRES_PASSWORD": "external",
+			},
+			WaitingFor: wait.ForLog("database system is ready to accept connections").WithOccurrence(2),
+		},
+		Started: true,
+	})
+	if err != nil {
+		t.Fatalf("start external container: %v", err)
+	}
+	t.Cleanup(func() { _ = pg.Terminate(context.Background()) })
+	return pg
+}
@@ -0,0 +1,376 @@
+package brrr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/api/types/network"
+
+	"github.com/testcontainers/testcontainers-go"
+)
+
+// Backend selects where the postgres server backing a Container runs.
+type Backend string
+
+const (
+	// Docker runs postgres in a docker container managed by testcontainers.
+	Docker Backend = "docker"
+	// Embedded runs postgres as a local process from an embedded distribution, without a docker daemon. It is
+	// registered by importing github.com/modfin/brrr/embedded.
+	Embedded Backend = "embedded"
+	// Kubernetes runs postgres in a pod provisioned through the Kubernetes API, for test processes running in-cluster.
+	// It is registered by importing github.com/modfin/brrr/kubernetes.
+	Kubernetes Backend = "kubernetes"
+	// External uses an already running postgres server reached through Config.ExternalDSN, without starting one.
+	External Backend = "external"
+)
+
+// backend returns the configured backend, or the default one, which is External when Config.ExternalDSN is set.
+func (cfg Config) backend() Backend {
+	if cfg.Backend == "" && cfg.ExternalDSN != "" {
+		return External
+	}
+	if cfg.Backend == "" {
+		return Docker
+	}
+	return cfg.Backend
+}
+
+// AddressFamily is the IP version used to reach the postgres server.
+type AddressFamily string
+
+const (
+	// AnyFamily uses whichever address the container runtime reports first.
+	AnyFamily AddressFamily = ""
+	// IPv4 only connects over IPv4.
+	IPv4 AddressFamily = "ipv4"
+	// IPv6 only connects over IPv6.
+	IPv6 AddressFamily = "ipv6"
+)
+
+// matches reports whether addr belongs to the family. Unspecified addresses match any family.
+func (f AddressFamily) matches(addr netip.Addr) bool {
+	switch {
+	case f == AnyFamily, !addr.IsValid(), addr.IsUnspecified():
+		return true
+	case f == IPv6:
+		return addr.Is6() && !addr.Is4In6()
+	default:
+		return addr.Is4() || addr.Is4In6()
+	}
+}
+
+// server is a running postgres server which a Container builds its template and instances in.
+type server interface {
+	// endpoint returns the host and port the server can be reached on from the test process.
+	endpoint(ctx context.Context) (string, int, error)
+	// internal returns the address the server can be reached on from other containers, and its aliases per network.
+	internal(ctx context.Context) (string, map[string][]string, error)
+	// healthy returns an error describing why the server is not running.
+	healthy(ctx context.Context) error
+	// terminate stops the server and removes everything it has created.
+	terminate(ctx context.Context) error
+}
+
+// Server is a running postgres server started by a backend registered with RegisterBackend.
+type Server interface {
+	// Endpoint returns the host and port the server can be reached on from the test process.
+	Endpoint(ctx context.Context) (string, int, error)
+	// Internal returns the address the server can be reached on from other containers, and its aliases per network.
+	Internal(ctx context.Context) (string, map[string][]string, error)
+	// Healthy returns an error describing why the server is not running.
+	Healthy(ctx context.Context) error
+	// Terminate stops the server and removes everything it has created.
+	Terminate(ctx context.Context) error
+}
+
+// ServerSpec is the server a registered backend starts for a Config, with the defaults of the Config resolved.
+type ServerSpec struct {
+	// Image is the postgres image, for backends running containers.
+	Image string
+	// Args are the server parameters as sorted -c flags of the postgres command.
+	Args []string
+	// Params are the server parameters, for backends starting postgres without the image entrypoint.
+	Params map[string]string
+	// InitdbArgs are the arguments of initdb selecting the locale, encoding and collation.
+	InitdbArgs string
+	// Conf is the content of the configured postgresql.conf, nil without one.
+	Conf []byte
+	// Labels are added to what the backend provisions, brrr=true included.
+	Labels map[string]string
+	// StartupTimeout is how long to wait for the server to become ready.
+	StartupTimeout time.Duration
+	// Logger logs what the backend does. It is never nil.
+	Logger *slog.Logger
+	// LogOutput receives the log of the server, nil without Config.LogOutput. Write errors are ignored.
+	LogOutput io.Writer
+
+	cfg Config
+}
+
+// Started reports that the server named detail, which began starting at start, is ready, see Config.OnProgress.
+func (s ServerSpec) Started(detail string, start time.Time) {
+	s.cfg.progress(StageContainerStart, detail, start)
+}
+
+// serverSpec resolves the ServerSpec of cfg.
+func (cfg Config) serverSpec() (ServerSpec, error) {
+	conf, err := cfg.postgresConf()
+	if err != nil {
+		return ServerSpec{}, err
+	}
+	spec := ServerSpec{
+		Image:          cfg.image(),
+		Args:           cfg.serverArgs(),
+		Params:         cfg.serverParams(),
+		InitdbArgs:     cfg.initdbArgs(),
+		Conf:           conf,
+		Labels:         cfg.labels(),
+		StartupTimeout: cfg.startupTimeout(),
+		Logger:         cfg.logger(),
+		cfg:            cfg,
+	}
+	if cfg.LogOutput != nil {
+		spec.LogOutput = logWriter{cfg.LogOutput}
+	}
+	return spec, nil
+}
+
+// BackendFunc starts a postgres server for cfg as described by spec.
+type BackendFunc func(ctx context.Context, cfg Config, spec ServerSpec) (Server, error)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = map[Backend]BackendFunc{}
+)
+
+// RegisterBackend makes a backend available to Config.Backend. It is called from the init function of the package
+// implementing the backend, so only importers of that package pay for its dependencies. Like sql.Register, it
+// panics if start is nil or b is registered twice.
+func RegisterBackend(b Backend, start BackendFunc) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	if start == nil {
+		panic("brrr: RegisterBackend start is nil")
+	}
+	if _, dup := backends[b]; dup || b == Docker || b == External {
+		panic("brrr: RegisterBackend called twice for backend " + string(b))
+	}
+	backends[b] = start
+}
+
+// registeredBackend returns the start function registered for b.
+func registeredBackend(b Backend) (BackendFunc, error) {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	start, ok := backends[b]
+	switch {
+	case ok:
+		return start, nil
+	case b == Embedded || b == Kubernetes:
+		return nil, fmt.Errorf("the %s backend is not registered, import github.com/modfin/brrr/%s", b, b)
+	default:
+		return nil, fmt.Errorf("unknown backend %q", b)
+	}
+}
+
+// startRegisteredServer starts the server of the registered backend b.
+func startRegisteredServer(ctx context.Context, cfg Config, b Backend) (server, error) {
+	start, err := registeredBackend(b)
+	if err != nil {
+		return nil, err
+	}
+	spec, err := cfg.serverSpec()
+	if err != nil {
+		return nil, err
+	}
+	srv, err := start(ctx, cfg, spec)
+	if err != nil {
+		return nil, err
+	}
+	return registeredServer{srv}, nil
+}
+
+// registeredServer is a server of a registered backend.
+type registeredServer struct {
+	Server
+}
+
+func (s registeredServer) endpoint(ctx context.Context) (string, int, error) { return s.Endpoint(ctx) }
+
+func (s registeredServer) internal(ctx context.Context) (string, map[string][]string, error) {
+	return s.Internal(ctx)
+}
+
+func (s registeredServer) healthy(ctx context.Context) error { return s.Healthy(ctx) }
+
+func (s registeredServer) terminate(ctx context.Context) error { return s.Terminate(ctx) }
+
+// freePort asks the kernel for a port that is currently free on localhost.
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// dockerServer is a postgres server running in a docker container.
+type dockerServer struct {
+	container testcontainers.Container
+	family    AddressFamily
+	// hostPort is the port the server listens on in the network of the host, or zero if it runs behind a port mapping.
+	hostPort int
+}
+
+// containerConfig applies the configuration of the container of cfg.
+func (cfg Config) containerConfig(c *container.Config) {
+	if cfg.Persistent || cfg.KeepOnFailure {
+		delete(c.Labels, reapLabel)
+	}
+}
+
+// hostConfig applies the configuration of the Docker host to the container of cfg.
+func (cfg Config) hostConfig(hc *container.HostConfig) {
+	hc.Memory = cfg.MemoryLimit
+	hc.NanoCPUs = int64(cfg.CPULimit * 1e9)
+	hc.CPUShares = cfg.CPUShares
+	hc.ShmSize = cfg.ShmSize
+
+	if cfg.HostNetwork {
+		hc.NetworkMode = network.NetworkHost
+		return
+	}
+	if cfg.HostPort != 0 {
+		hc.PortBindings = network.PortMap{
+			network.MustParsePort("5432/tcp"): {{HostPort: strconv.Itoa(cfg.HostPort)}},
+		}
+	}
+}
+
+func startDockerServer(ctx context.Context, cfg Config) (*dockerServer, error) {
+	if err := configureReaper(ctx, cfg); err != nil {
+		return nil, err
+	}
+	if err := ensureImage(ctx, cfg); err != nil {
+		return nil, err
+	}
+
+	if cfg.isolation() == Restore {
+		db, err := setupSnapshotContainer(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return newDockerServer(cfg, db), nil
+	}
+
+	db, err := setupPostgresTestContainer(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newDockerServer(cfg, db), nil
+}
+
+func newDockerServer(cfg Config, c testcontainers.Container) *dockerServer {
+	s := &dockerServer{container: c, family: cfg.AddressFamily}
+	if cfg.HostNetwork {
+		s.hostPort = cfg.HostPort
+	}
+	return s
+}
+
+func (s *dockerServer) endpoint(ctx context.Context) (string, int, error) {
+	inspect, err := s.container.Inspect(ctx)
+	if err != nil {
+		return "", 0, err
+	}
+	if inspect == nil || inspect.NetworkSettings == nil {
+		return "", 0, errors.New("container has no network settings")
+	}
+
+	host, err := s.container.Host(ctx)
+	if err != nil {
+		return "", 0, err
+	}
+	if host == "localhost" {
+		switch s.family {
+		case IPv4:
+			host = "127.0.0.1"
+		case IPv6:
+			host = "::1"
+		}
+	}
+
+	if s.hostPort != 0 {
+		return host, s.hostPort, nil
+	}
+
+	if bridge := inspect.NetworkSettings.Networks["bridge"]; bridge != nil {
+		gateway := bridge.Gateway
+		if s.family == IPv6 {
+			gateway = bridge.IPv6Gateway
+		}
+		if gateway.IsValid() {
+			host = gateway.String()
+		}
+	}
+
+	// Docker may bind different host ports per address family, so pick the binding matching the host address.
+	hostAddr, _ := netip.ParseAddr(host)
+	family := s.family
+	if family == AnyFamily && hostAddr.IsValid() {
+		family = IPv4
+		if hostAddr.Is6() && !hostAddr.Is4In6() {
+			family = IPv6
+		}
+	}
+	for _, binding := range inspect.NetworkSettings.Ports[network.MustParsePort("5432/tcp")] {
+		if !family.matches(binding.HostIP) {
+			continue
+		}
+		port, err := strconv.Atoi(binding.HostPort)
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid host port %q: %w", binding.HostPort, err)
+		}
+		return host, port, nil
+	}
+
+	return "", 0, fmt.Errorf("no host binding for 5432/tcp reachable from %s", host)
+}
+
+func (s *dockerServer) internal(ctx context.Context) (string, map[string][]string, error) {
+	ip, err := s.container.ContainerIP(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	aliases, err := s.container.NetworkAliases(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	return ip, aliases, nil
+}
+
+func (s *dockerServer) healthy(ctx context.Context) error {
+	state, err := s.container.State(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get container state: %w", err)
+	}
+	if !state.Running {
+		return fmt.Errorf("container is not running (status %s)", state.Status)
+	}
+	return nil
+}
+
+func (s *dockerServer) terminate(ctx context.Context) error {
+	return s.container.Terminate(ctx)
+}
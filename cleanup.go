@@ -0,0 +1,64 @@
+package brrr
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// stalePattern matches the names of the instances of the template database and of the clones of DumpTemplate.
+func stalePattern(template string) *regexp.Regexp {
+	return regexp.MustCompile("^" + regexp.QuoteMeta(template) + "_([0-9a-f]{32}|dump_[0-9a-f]{8})$")
+}
+
+// dropStaleInstances drops databases following the instance naming pattern of the template database, which are
+// left behind by runs that crashed before closing their instances, and the clones of DumpTemplate left behind by
+// runs that crashed while dumping. It returns the names of the dropped databases.
+func dropStaleInstances(ctx context.Context, pool *pgxpool.Pool, template string) ([]string, error) {
+	pattern := stalePattern(template)
+
+	rows, err := pool.Query(ctx, "SELECT datname FROM pg_database WHERE NOT datistemplate")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list databases: %w", err)
+	}
+	databases, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to list databases: %w", err)
+	}
+
+	var stale []string
+	for _, name := range databases {
+		if pattern.MatchString(name) {
+			stale = append(stale, name)
+		}
+	}
+
+	for _, name := range stale {
+		if _, err := pool.Exec(ctx, fmt.Sprintf("DROP DATABASE IF EXISTS %s WITH (FORCE)", pgx.Identifier{name}.Sanitize())); err != nil {
+			return nil, fmt.Errorf("failed to drop stale instance %s: %w", name, err)
+		}
+	}
+
+	// Instances created with unique credentials also leave their role behind.
+	rows, err = pool.Query(ctx, "SELECT rolname FROM pg_roles")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	roles, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	for _, name := range roles {
+		if !pattern.MatchString(name) {
+			continue
+		}
+		if _, err := pool.Exec(ctx, fmt.Sprintf("DROP ROLE IF EXISTS %s", pgx.Identifier{name}.Sanitize())); err != nil {
+			return nil, fmt.Errorf("failed to drop stale instance role %s: %w", name, err)
+		}
+	}
+
+	return stale, nil
+}
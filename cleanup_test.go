@@ -0,0 +1,55 @@
+package brrr_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/modfin/brrr"
+)
+
+func TestNewContainer_DropsStaleInstances(t *testing.T) {
+	ctx := context.Background()
+	info := brrr.Default().ConnectionInfo()
+	info.Database = "postgres"
+	conn, err := pgx.Connect(ctx, info.URL())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer conn.Close(ctx)
+
+	const instance = "brrr_crashed_0123456789abcdef0123456789abcdef"
+	// Databases left behind by a crashed run, next to one of another application sharing the prefix.
+	for _, name := range []string{instance, "brrr_crashed_dump_0123abcd", "brrr_crashed_other", "brrr_kept_0123456789abcdef0123456789abcdef"} {
+		if _, err := conn.Exec(ctx, "CREATE DATABASE "+pgx.Identifier{name}.Sanitize()); err != nil {
+			t.Fatalf("create database %s: %v", name, err)
+		}
+	}
+	if _, err := conn.Exec(ctx, "CREATE ROLE "+pgx.Identifier{instance}.Sanitize()); err != nil {
+		t.Fatalf("create role: %v", err)
+	}
+
+	newContainer(t, sharedServer(brrr.Config{Database: "brrr_crashed"}))
+	newContainer(t, sharedServer(brrr.Config{Database: "brrr_kept", KeepStaleInstances: true}))
+
+	rows, err := conn.Query(ctx, "SELECT datname FROM pg_database WHERE datname LIKE 'brrr\\_crashed\\_%' OR datname LIKE 'brrr\\_kept\\_%' ORDER BY 1")
+	if err != nil {
+		t.Fatalf("list databases: %v", err)
+	}
+	databases, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		t.Fatalf("list databases: %v", err)
+	}
+	if want := []string{"brrr_crashed_other", "brrr_kept_0123456789abcdef0123456789abcdef"}; !slices.Equal(databases, want) {
+		t.Errorf("expected only %v to be left, got %v", want, databases)
+	}
+
+	var role bool
+	if err := conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1)", instance).Scan(&role); err != nil {
+		t.Fatalf("look up role: %v", err)
+	}
+	if role {
+		t.Error("expected the role of the stale instance to be dropped")
+	}
+}
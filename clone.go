@@ -0,0 +1,128 @@
+package brrr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// createInstanceDatabase creates the database name of an instance with the options o, according to the isolation,
+// and applies its seed overlays.
+func (c *Container) createInstanceDatabase(ctx context.Context, conn *pgxpool.Conn, o instanceOptions, name string) error {
+	create := c.cloneTemplate
+	if c.cfg.isolation() == Migrate {
+		create = c.migrateInstance
+	}
+	if err := create(ctx, conn, o, name); err != nil {
+		return err
+	}
+	return c.seedInstance(ctx, conn, o, name)
+}
+
+// migrateInstance creates the database name with the options o and the configured locale, and populates it like a
+// template. The database is dropped again if populating it fails.
+func (c *Container) migrateInstance(ctx context.Context, conn *pgxpool.Conn, o instanceOptions, name string) (err error) {
+	ctx, span := c.cfg.startSpan(ctx, "brrr.instance.migrate", databaseAttr(name))
+	defer func() { endSpan(span, err) }()
+
+	createOpts, template := c.cfg.migrateOptions(o)
+	if _, err := conn.Exec(ctx, createOpts.createDatabaseSQL(name, template)); err != nil {
+		return fmt.Errorf("failed to create database: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_, dropErr := conn.Exec(context.Background(), fmt.Sprintf("DROP DATABASE %s WITH (FORCE)", pgx.Identifier{name}.Sanitize()))
+			err = errors.Join(err, dropErr)
+		}
+	}()
+
+	for _, stmt := range o.alterDatabaseSQL(name) {
+		if _, err := conn.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to configure database: %w", err)
+		}
+	}
+
+	// Setup stages are only reported for the container.
+	cfg := c.cfg
+	cfg.Database = name
+	cfg.OnProgress = nil
+	if err := populateDatabase(ctx, cfg, c.server); err != nil {
+		return fmt.Errorf("failed to migrate instance database: %w", err)
+	}
+	return nil
+}
+
+// cloneAttempts is the number of times cloning the template is attempted while it is being accessed.
+const cloneAttempts = 5
+
+// cloneTemplate creates the database name from the template with the options o. Clones only conflict with
+// sessions connected to the template, not with each other, so they run concurrently on the admin connections.
+// Clones failing because something is connected to the template, e.g. a tool outside brrr, are retried. The clone
+// is dropped again if configuring it fails.
+func (c *Container) cloneTemplate(ctx context.Context, conn *pgxpool.Conn, o instanceOptions, name string) (err error) {
+	template, err := c.templateFor(o)
+	if err != nil {
+		return err
+	}
+	ctx, span := c.cfg.startSpan(ctx, "brrr.instance.clone", databaseAttr(name), attribute.String("brrr.template", template))
+	defer func() { endSpan(span, err) }()
+
+	c.templateMu.RLock()
+	defer c.templateMu.RUnlock()
+
+	start := time.Now()
+	backoff := 50 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		_, err := conn.Exec(ctx, o.createDatabaseSQL(name, template))
+		if err == nil {
+			break
+		}
+		if !isObjectInUse(err) {
+			return fmt.Errorf("failed to create database from template: %w", err)
+		}
+		if attempt == cloneAttempts {
+			return fmt.Errorf("failed to create database from template: %w: %w", ErrTemplateBusy, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to create database from template: %w", errors.Join(err, ctx.Err()))
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	c.metrics.observeClone(time.Since(start))
+	defer func() {
+		if err != nil {
+			_, dropErr := conn.Exec(context.Background(), fmt.Sprintf("DROP DATABASE %s WITH (FORCE)", pgx.Identifier{name}.Sanitize()))
+			err = errors.Join(err, dropErr)
+		}
+	}()
+
+	for _, stmt := range o.alterDatabaseSQL(name) {
+		if _, err := conn.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to configure database: %w", err)
+		}
+	}
+	return nil
+}
+
+// isObjectInUse reports whether err is postgres' object_in_use error, returned when cloning a template which
+// other sessions are connected to.
+func isObjectInUse(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "55006"
+}
+
+// isUndefinedDatabase reports whether err is postgres' invalid_catalog_name error, returned for databases which
+// do not exist.
+func isUndefinedDatabase(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "3D000"
+}
@@ -0,0 +1,88 @@
+package brrr
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ConnectionInfo describes how a database can be reached, both from the test process and from other
+// containers, e.g. an application image under test.
+type ConnectionInfo struct {
+	// Host and Port the database is reachable on from the test process.
+	Host string
+	Port int
+
+	// InternalIP and InternalPort the database is reachable on from containers sharing its network.
+	InternalIP   string
+	InternalPort int
+
+	// Aliases of the server per network name.
+	Aliases map[string][]string
+
+	User     string
+	Password string
+	Database string
+}
+
+// ConnectionInfo returns the addresses of the template database.
+func (c *Container) ConnectionInfo() ConnectionInfo {
+	return c.info
+}
+
+// ConnectionInfo returns the addresses of the database for this single test instance.
+func (di *DatabaseInstance) ConnectionInfo() ConnectionInfo {
+	return di.info
+}
+
+// connectionInfo collects the addresses of the server. The internal address does not change while the server
+// runs, so it is resolved once during setup.
+func connectionInfo(ctx context.Context, cfg Config, srv server) (ConnectionInfo, error) {
+	ip, aliases, err := srv.internal(ctx)
+	if err != nil {
+		return ConnectionInfo{}, fmt.Errorf("failed to resolve internal address: %w", err)
+	}
+
+	return ConnectionInfo{
+		Host:         cfg.host,
+		Port:         cfg.port,
+		InternalIP:   ip,
+		InternalPort: 5432,
+		Aliases:      aliases,
+		User:         cfg.User,
+		Password:     cfg.Password,
+		Database:     cfg.Database,
+	}, nil
+}
+
+// URL returns the postgres:// connection URL of the database, reachable from the test process.
+func (info ConnectionInfo) URL() string {
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(info.User, info.Password),
+		Host:     net.JoinHostPort(info.Host, strconv.Itoa(info.Port)),
+		Path:     "/" + info.Database,
+		RawQuery: "sslmode=disable",
+	}
+	return u.String()
+}
+
+// DSN returns the keyword/value connection string of the database, reachable from the test process.
+func (info ConnectionInfo) DSN() string {
+	quote := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	return fmt.Sprintf("host='%s' port=%d user='%s' password='%s' dbname='%s' sslmode=disable",
+		quote.Replace(info.Host), info.Port, quote.Replace(info.User), quote.Replace(info.Password), quote.Replace(info.Database))
+}
+
+// URL returns the postgres:// connection URL of the instance database, e.g. for golang-migrate or an ORM.
+func (di *DatabaseInstance) URL() string {
+	return di.info.URL()
+}
+
+// DSN returns the keyword/value connection string of the instance database.
+func (di *DatabaseInstance) DSN() string {
+	return di.info.DSN()
+}
@@ -1,65 +1,646 @@
 package brrr
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"log/slog"
+	"maps"
+	"net"
+	"net/url"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"os"
 	"path/filepath"
 
-	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/golang-migrate/migrate/v4/database/pgx/v5"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/log"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
 	"github.com/testcontainers/testcontainers-go/wait"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Config struct {
 	// Database user for connecting to the database instances created from the template database.
+	// Defaults to a random user for servers brrr starts, see ConnectionInfo, and to the one in ExternalDSN otherwise.
 	User string
-	// Password for the database user.
+	// Password for the database user. Defaults to a random password for servers brrr starts, and to the one in
+	// ExternalDSN otherwise.
 	Password string
-	// The name of the database which will be used as the template database.
+	// Credentials supplies User and Password when they are empty, e.g. from environment variables or files.
+	Credentials CredentialSource
+
+	// ClientCertRole enables TLS and creates a role of this name which authenticates with a client certificate,
+	// for testing mutual TLS connection code. See Container.ClientCert. Will ignore if empty.
+	ClientCertRole string
+	// The name of the database which will be used as the template database. Instances are named after it with a
+	// 33 character suffix, so it can be at most 30 bytes long to fit postgres' identifier length limit.
 	Database string
 
+	// Backend running the postgres server. Defaults to Docker. Backends other than Docker and External are registered
+	// by importing their package, see RegisterBackend.
+	Backend Backend
+
+	// Isolation selects how instances are isolated from each other. Defaults to Clone.
+	Isolation Isolation
+
+	// ExternalDSN is the connection string of an already running postgres server to build the template and
+	// instances in, instead of starting one, e.g. a CI service container. The role must be allowed to create
+	// databases. User and Password default to the ones in the DSN. Selects the External backend. An existing
+	// Database is only replaced when an earlier run built it.
+	ExternalDSN string
+
 	// Image to use for the test container. Defaults to "postgres:17.2"
 	Image string
 
+	// StartupTimeout is how long the server may take to become ready, e.g. longer for cold image pulls on throttled
+	// CI runners. Defaults to 10 seconds, 15 seconds for the Embedded backend and 2 minutes for the Kubernetes
+	// backend, whose pods are scheduled and pulled within it.
+	StartupTimeout time.Duration
+
+	// StartupRetries is the number of times starting the server is retried when it fails, e.g. because it did not
+	// become ready in time. Failed containers are removed before retrying. Defaults to 0.
+	StartupRetries int
+
+	// WaitFor replaces the check of whether the container is ready, e.g. to wait for a log line of an image which
+	// restarts the server after initializing it, or for longer on slow CI runners. Only supported by the Docker
+	// backend. Defaults to waiting up to StartupTimeout for the server to accept queries.
+	WaitFor wait.Strategy
+
+	// PullPolicy selects when the image is pulled. Only supported by the Docker backend. Defaults to
+	// PullIfNotPresent.
+	PullPolicy PullPolicy
+
+	// RegistryAuth are the credentials the image is pulled with. Defaults to the credentials of the Docker
+	// configuration, including credential helpers and the DOCKER_AUTH_CONFIG environment variable. Only supported by
+	// the Docker backend.
+	RegistryAuth *RegistryAuth
+
+	// RegistryMirror is a registry, optionally with a path, prefixed to images hosted on Docker Hub, including the
+	// default image and those of presets, e.g. "registry.example.com/dockerhub" for CI environments without access
+	// to Docker Hub. Will ignore if empty.
+	RegistryMirror string
+
+	// EmbeddedVersion is the postgres version run by the Embedded backend, e.g. "15.3.0". Defaults to the embedded-postgres default.
+	EmbeddedVersion string
+
+	// HostPort binds the server to a fixed port of the host instead of a random one, so database clients and
+	// reused containers can be reached at a stable address. Fails to start if the port is in use. Not supported by
+	// the Kubernetes and External backends. Will ignore if zero.
+	HostPort int
+
+	// HostNetwork runs the container in the network of the host instead of behind Docker's port mapping, saving
+	// the userland proxy on every connection, which adds up in suites opening thousands of connections. The server
+	// listens on HostPort, or on a free port if zero. Requires a Linux host, or Docker Desktop with host networking
+	// enabled. Only supported by the Docker backend.
+	HostNetwork bool
+
+	// Network attaches the container to an existing Docker network instead of the default bridge, so other
+	// containers under test, such as the application image, can reach the server on port 5432 by its
+	// NetworkAliases. Will ignore if empty. Only supported by the Docker backend.
+	Network string
+	// NetworkAliases are the host names of the server in Network, see ConnectionInfo.Aliases.
+	NetworkAliases []string
+
+	// MemoryLimit caps the memory of the container in bytes, e.g. so the server can't starve the tests on shared CI
+	// runners. Will ignore if zero. Not supported by the Embedded and External backends.
+	MemoryLimit int64
+	// CPULimit caps the number of CPUs the container may use, e.g. 1.5. Will ignore if zero. Not supported by the
+	// Embedded and External backends.
+	CPULimit float64
+	// CPUShares is the CPU weight of the container relative to other containers, 1024 being the Docker default.
+	// Will ignore if zero. Only supported by the Docker backend.
+	CPUShares int64
+	// ShmSize is the size of /dev/shm in bytes, which postgres allocates the shared memory of parallel workers in.
+	// Defaults to 64MB with the Docker backend. Not supported by the Embedded and External backends.
+	ShmSize int64
+
+	// ContainerName names the container, or the pod with the Kubernetes backend, instead of a random name, e.g. to
+	// docker exec into it while debugging. Starting fails while a container of the same name exists, so processes
+	// running in parallel need names of their own. With Reuse, the container of that name is reused whatever
+	// configuration it was started with. Not supported by the Embedded and External backends.
+	ContainerName string
+
+	// Labels are added to the container, or the pod with the Kubernetes backend, e.g. so CI cleanup jobs and cost
+	// attribution tooling can identify it. The brrr=true label is always added. Not supported by the Embedded and
+	// External backends.
+	Labels map[string]string
+
+	// AddressFamily forces the IP version used to reach the server on dual-stack hosts. Defaults to whatever the runtime reports first.
+	AddressFamily AddressFamily
+
+	// KubeConfig is the kubeconfig used by the Kubernetes backend. Defaults to the standard kubeconfig loading rules, falling back to the in-cluster service account.
+	KubeConfig string
+
+	// KubeNamespace the Kubernetes backend creates its pod in. Defaults to the namespace of the kubeconfig context.
+	KubeNamespace string
+
+	// PostgresConf is the path of a complete postgresql.conf used by the server instead of the image's default.
+	// Settings brrr configures itself, such as max_connections, take precedence over the file. Will ignore if empty.
+	PostgresConf string
+
+	// PostgresConfData is like PostgresConf, but with the contents of the file, e.g. from an embed directive.
+	PostgresConfData []byte
+
+	// Locale of the server, e.g. "en_US.UTF-8" or "sv_SE.UTF-8", passed to initdb, so collation sensitive sorting
+	// behaves as in production. The image must provide the locale; the Debian based postgres images only have
+	// en_US.UTF-8 and C.UTF-8 without installing more. For servers not initialized by brrr, such as the External
+	// backend, the template database is created with it instead. Defaults to the image's, usually en_US.utf8.
+	Locale string
+
+	// Encoding of the server, e.g. "UTF8" or "LATIN1", applied like Locale. Defaults to the one of the locale.
+	Encoding string
+
+	// Collation is LC_COLLATE of the server when it should differ from Locale, applied like Locale. Not supported
+	// by the Embedded backend. Defaults to Locale.
+	Collation string
+
+	// Timezone of the server and of the connections brrr makes, including those of instances, e.g. "UTC" or
+	// "Europe/Stockholm", so tests of date boundaries behave the same everywhere. The container's TZ is set to it
+	// as well. With the External backend only brrr's connections use it. Defaults to the server's, usually UTC.
+	Timezone string
+
 	// MaxConnections to the database. Defaults to 1000.
 	MaxConnections int
 
+	// FastProfile starts the server with fsync, synchronous_commit, full_page_writes and autovacuum turned off,
+	// which speeds up seeding and cloning considerably. Throwaway test databases don't need the durability they
+	// provide. Not supported by the External backend.
+	FastProfile bool
+
+	// ServerParams are settings the server is started with as -c flags, e.g. "shared_preload_libraries" or
+	// "log_statement". They take precedence over MaxConnections, FastProfile and PostgresConf. Not supported by the
+	// External backend. Will ignore if empty.
+	ServerParams map[string]string
+
+	// Presets configure the server and template for a postgres distribution, e.g. PostGIS. Will ignore if empty.
+	Presets []Preset
+
+	// Extensions are created in the template database before the dump is restored and the migrations run, along
+	// with the extensions they depend on, e.g. "uuid-ossp", "pgcrypto" or "citext". They must be available in the
+	// image. Will ignore if empty.
+	Extensions []string
+
+	// DumpPath is the path to a pg_dump of a reference database restored into the template before the migrations,
+	// so tests can start from a snapshot instead of replaying years of migrations. Plain SQL dumps are executed like
+	// seed files, and custom format dumps (pg_dump -Fc) are restored with pg_restore inside the container, which is
+	// only supported by the Docker backend. Will ignore if empty.
+	DumpPath string
+
 	// Path to migrations/seeding directory. Will ignore if empty.
 	MigrationsPath string
 
+	// MigrationsFS is a filesystem with the migrations in its root, read through the iofs source of golang-migrate,
+	// e.g. an embed.FS narrowed to the migrations directory with fs.Sub. Used instead of MigrationsPath, so only one
+	// of them may be set. Will ignore if empty.
+	MigrationsFS fs.FS
+
+	// MigrationTool selects the tool running the migrations in MigrationsPath or MigrationsFS. Defaults to
+	// GolangMigrate. Tools other than GolangMigrate and Dbmate are registered by importing their package, see
+	// RegisterMigrationTool.
+	MigrationTool MigrationTool
+
+	// MigrationTargetVersion builds the template at the given migration version instead of the latest one, e.g. to
+	// test upgrade code paths against an older schema. Setup fails if no migration has the version. For dbmate the
+	// version is the numeric file name prefix. Not supported with Migrator. Will ignore if zero.
+	MigrationTargetVersion uint
+
+	// Migrator migrates the template database with any other mechanism, such as custom tooling or an ORM's auto
+	// migration. Used instead of MigrationsPath and MigrationsFS, so only one of them may be set. Will ignore if empty.
+	Migrator Migrator
+
 	// Path to seeding directory. Will ignore if empty.
 	SeedPath string
 
+	// SeedFS is a filesystem with the seed files in its root, e.g. an embed.FS narrowed with fs.Sub, or testdata of
+	// another module. Used instead of SeedPath, so only one of them may be set. Will ignore if empty.
+	SeedFS fs.FS
+
+	// SeedVars renders the seed files, including those of WithSeedFiles, as Go text/templates with the variables,
+	// e.g. {{.TenantID}}, so environment specific values need no generated files. Besides the text/template
+	// builtins, templates can call now, date and timestamp to write a time.Time as a quoted literal, e.g.
+	// {{date (now.AddDate 0 0 -7)}}, and quote and ident to quote a string as a literal or identifier. Reused
+	// templates are fingerprinted with the rendered seed files, so they are rebuilt once a file renders differently,
+	// e.g. on the next day for a file calling date on now. Will ignore if empty.
+	SeedVars map[string]any
+
+	// CSVPath is the path to a directory of CSV files loaded after the seed files with COPY, each into the table it
+	// is named after, see LoadCSV. Will ignore if empty.
+	CSVPath string
+
+	// CSVFS is like CSVPath, but with the CSV files in the root of a filesystem. Used instead of CSVPath, so only one
+	// of them may be set. Will ignore if empty.
+	CSVFS fs.FS
+
 	// Seed func to run after migrations. Will ignore if empty.
 	SeedFunc func(db *sql.DB, connStr string) error
 
-	// Logger for logging the test container's output. Useful for debugging. Default to testcontainer's noopLogger
+	// SeedFuncCtx is a seed func run after SeedFunc with a pgx connection to the template database, for seeding using
+	// pgx specific features such as CopyFrom and batches. The context is cancelled if setup is. Will ignore if empty.
+	SeedFuncCtx func(ctx context.Context, conn *pgx.Conn, connStr string) error
+
+	// SyntheticRows fills tables with the given number of synthetic rows after seeding, keyed by table name which may
+	// be qualified with its schema. Parents are filled before their children and foreign keys reference existing
+	// parent rows, for volume testing without production data. Will ignore if empty.
+	SyntheticRows map[string]int
+
+	// SyntheticFaker makes SyntheticRows generate realistic looking values for columns whose names suggest what they
+	// hold, such as email, first_name, phone, city, price or birth_date, instead of values made from the column name
+	// and row number. Values are the same between runs, and include the row number where they are likely to be
+	// unique, such as emails and usernames.
+	SyntheticFaker bool
+
+	// Templates are additional template databases built after the one described by the rest of Config, each from
+	// its own migrations and seeds, e.g. "empty" and "large-seed". Instances are cloned from one of them with
+	// WithTemplate. Only supported with Clone isolation. Will ignore if empty.
+	Templates map[string]Template
+
+	// ValidateTemplate are queries run against the template after seeding, each returning the rows violating an
+	// expectation, e.g. "SELECT id FROM users WHERE email IS NULL". Setup fails if any query errors or returns rows,
+	// catching broken fixtures before the tests using them. Will ignore if empty.
+	ValidateTemplate []string
+
+	// MaxInstances caps the number of instance databases existing at the same time, e.g. to keep highly parallel
+	// suites from exhausting max_connections. Creating the databases is limited further by AdminConnections. Will
+	// ignore if zero.
+	MaxInstances int
+
+	// InstanceQuotaWait is how long NewInstance waits for an instance to be closed when MaxInstances is reached,
+	// before failing with a QuotaError. Fails immediately if zero. With InstanceQuotaWaitForever, NewInstance waits
+	// until its context is done, which applies back-pressure to parallel tests instead of failing them.
+	InstanceQuotaWait time.Duration
+
+	// InstanceTTL is the default time after which instances which haven't been closed are dropped in the background,
+	// terminating their connections, see WithTTL. It is a safety net for tests skipping CloseInstance, e.g. on panics,
+	// and logs where the reaped instance was created as a warning. Not supported with Restore isolation. Will
+	// ignore if zero.
+	InstanceTTL time.Duration
+
+	// InstanceConnectionLimit is the default CONNECTION LIMIT of instance databases, see WithConnectionLimit. Not
+	// supported with Restore isolation. Will ignore if zero.
+	InstanceConnectionLimit int
+
+	// InstanceTxIsoLevel is the default transaction isolation level of instance databases, see WithTxIsoLevel.
+	// Defaults to the server's, read committed.
+	InstanceTxIsoLevel pgx.TxIsoLevel
+
+	// UniqueCredentials gives every instance its own login role with privileges on only its database, see
+	// WithUniqueCredentials.
+	UniqueCredentials bool
+
+	// KeepStaleInstances disables dropping instance databases left behind by crashed runs when setting up against
+	// a server which already has them, e.g. an attached container, a reused container or an external server. Stale
+	// databases are those named after Database with an instance or DumpTemplate suffix, and are dropped before the
+	// template is built. Servers should not be shared by concurrent runs using the same Database unless this is set.
+	KeepStaleInstances bool
+
+	// FailOnLeak makes Close return a LeakError listing the instances which were never closed, with where they were
+	// created, instead of only logging them as a warning to Logger. Leaked instances keep their connections open,
+	// which exhausts max_connections in large suites.
+	FailOnLeak bool
+
+	// AsyncDrop makes CloseInstance hand the database off to a background worker dropping it, instead of waiting
+	// for the drop. Errors of background drops are returned by Drain, which Close calls before shutting down.
+	AsyncDrop bool
+
+	// TemplateFinalize is called with a superuser connection to the template database after migrations and seeding,
+	// right before it is flagged as a template. It is an escape hatch for setup not expressible in migrations, such
+	// as event triggers or foreign servers. Settings made with ALTER DATABASE are not cloned into instances, see
+	// InstanceOption for those. Will ignore if empty.
+	TemplateFinalize func(ctx context.Context, conn *pgx.Conn) error
+
+	// BeforeMigrate is called before the dump is restored and the migrations run in the template database, e.g. to
+	// install extensions or register types they depend on. Will ignore if empty.
+	BeforeMigrate Hook
+
+	// AfterMigrate is called after the migrations ran in the template database. Will ignore if empty.
+	AfterMigrate Hook
+
+	// BeforeSeed is called before the seed files are executed in the template database, after AfterMigrate, e.g.
+	// to set GUCs for the seeding session. Will ignore if empty.
+	BeforeSeed Hook
+
+	// AfterTemplateReady is called once the template database is complete and flagged as a template, including
+	// after RefreshTemplate. The connection must not be kept, as databases can't be cloned while connected to.
+	// Not called with Migrate isolation, which has no template. Will ignore if empty.
+	AfterTemplateReady Hook
+
+	// BeforeInstanceCreate is called before the database of every instance is created. Will ignore if empty.
+	BeforeInstanceCreate InstanceHook
+
+	// AfterInstanceDrop is called after the database of every instance is dropped, also when dropped in the
+	// background with AsyncDrop. Will ignore if empty.
+	AfterInstanceDrop InstanceHook
+
+	// FreezeTemplate runs VACUUM FREEZE and a CHECKPOINT on the template before flagging it, which makes cloning
+	// large templates faster.
+	FreezeTemplate bool
+
+	// AdminConnections is the number of brrr's own connections to the server, which create and drop instance
+	// databases, so parallel tests don't wait on each other to do so. Defaults to 4.
+	AdminConnections int
+
+	// ConnectRetries is the number of times a failed connection to a new instance is retried. Defaults to 0.
+	ConnectRetries int
+
+	// ConnectBackoff is the delay before the first connection retry, doubled for every following retry. Defaults to 100ms.
+	ConnectBackoff time.Duration
+
+	// ConnectDeadline bounds the total time spent connecting to a new instance, retries included. Will ignore if zero.
+	ConnectDeadline time.Duration
+
+	// Tracer traces the queries of instance connections and of brrr's own connection pool, e.g. a tracer from
+	// otelpgx, so queries issued during tests show up in traces. See WithTracer. Will ignore if empty.
+	Tracer pgx.QueryTracer
+
+	// OnProgress is called after each setup stage completes, with one of the Stage constants, a stage specific
+	// detail such as the migration version or seed file name, and the time the stage took. Will ignore if empty.
+	OnProgress func(stage string, detail string, elapsed time.Duration)
+
+	// Reuse keeps the container running after Close and reuses it in later runs with the same configuration,
+	// through the reusable containers of testcontainers, to skip starting the server and building the template.
+	// The template is rebuilt when the migrations, seed files or configuration changed, but changes to seed funcs,
+	// Migrator and TemplateFinalize are not detected. Supported by the Docker and External backends. The testcontainers
+	// reaper removes the container when the process exits, unless it is disabled or Persistent is set.
+	Reuse bool
+
+	// FailureDumpDir is the directory Container.Instance writes a plain SQL dump of the instance of every failed
+	// test to, before the instance is dropped, see DatabaseInstance.DumpOnFailure. Will ignore if empty.
+	FailureDumpDir string
+
+	// KeepOnFailure leaves the databases of failed tests, see Container.Instance, and the container running when
+	// a test failed, printing how to connect to them, so the data can be inspected. The container is kept from the
+	// testcontainers reaper, so it is left behind if the process is killed before Close. Only supported by the
+	// Docker backend.
+	KeepOnFailure bool
+
+	// Persistent is Reuse for local development loops: the container is also kept from the testcontainers reaper,
+	// so it outlives the process and later runs attach to it with the template already built. Remove it with
+	// docker rm when done. Only supported by the Docker backend.
+	Persistent bool
+
+	// DisableReaper turns off Ryuk, the reaper of testcontainers which removes the containers of a process when it
+	// exits, for CI environments which can't run it. Containers are still removed by Close, and the containers left
+	// behind by processes of the same host which are gone are removed when the next container starts. The reaper
+	// settings apply to every container of the process, and must be the same for all of them. Only supported by
+	// the Docker backend.
+	DisableReaper bool
+	// ReaperPrivileged runs the reaper as a privileged container, which some Docker hosts such as rootless Podman
+	// require. Only supported by the Docker backend.
+	ReaperPrivileged bool
+	// ReaperRegistry is the registry the reaper image is pulled from instead of Docker Hub, e.g. a mirror. It
+	// applies to other Docker Hub images started through testcontainers too. Will ignore if empty. Only supported by
+	// the Docker backend.
+	ReaperRegistry string
+	// Session tags the container with the brrr.session label, e.g. the ID of the CI job, so cleanup jobs can find
+	// the containers of a session. Will ignore if empty. Not supported by the Embedded and External backends.
+	Session string
+
+	// TracerProvider traces setup and the lifecycle of instances with OpenTelemetry spans: starting the server,
+	// restoring the dump, migrating, seeding, building the template, and creating, cloning and dropping instances.
+	// Spans of NewInstance and CloseInstance are children of the span in their context. Will ignore if empty.
+	TracerProvider trace.TracerProvider
+
+	// LogOutput receives the log of the server as it is written, from a background goroutine, e.g. a file kept as a
+	// CI artifact. The Embedded backend only passes the log on in batches, once the server has started and once it
+	// has stopped. Write errors are ignored. Will ignore if empty. Not supported by the External backend.
+	LogOutput io.Writer
+
+	// Logger for logging the test container's output and brrr's own progress, such as the migrations and seed files
+	// run, at info and debug level. Useful for debugging. Defaults to discarding everything.
 	Logger *slog.Logger
 
 	host string
 	port int
+	// reuseName is the name of the container when reusing it
+	reuseName string
+	// files are copied into the container before it starts
+	files []testcontainers.ContainerFile
+	// onProgress is OnProgress as set by the user, before newReport wrapped it to record the setup report
+	onProgress func(stage string, detail string, elapsed time.Duration)
+}
+
+// Setup stages reported to Config.OnProgress.
+const (
+	StageImagePull      = "image pull"
+	StageContainerStart = "container start"
+	StageDump           = "dump"
+	StageMigration      = "migration"
+	StageSeed           = "seed"
+	StageSeedFunc       = "seed func"
+	StageSyntheticData  = "synthetic data"
+	StageTemplate       = "template"
+)
+
+// logger returns the configured logger, or one discarding everything.
+func (cfg Config) logger() *slog.Logger {
+	if cfg.Logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	return cfg.Logger
+}
+
+// progress reports a completed setup stage which began at start.
+func (cfg Config) progress(stage, detail string, start time.Time) {
+	if cfg.OnProgress != nil {
+		cfg.OnProgress(stage, detail, time.Since(start))
+	}
+}
+
+// image returns the configured postgres image, or the default one.
+func (cfg Config) image() string {
+	if cfg.Image != "" {
+		return mirrorImage(cfg.Image, cfg.RegistryMirror)
+	}
+	return mirrorImage("postgres:17.2", cfg.RegistryMirror)
+}
+
+// maxConnections returns the configured max_connections, or the default.
+func (cfg Config) maxConnections() int {
+	if cfg.MaxConnections != 0 {
+		return cfg.MaxConnections
+	}
+	return 1000
+}
+
+// startupTimeout returns the configured startup timeout, or the default of the backend.
+func (cfg Config) startupTimeout() time.Duration {
+	switch {
+	case cfg.StartupTimeout > 0:
+		return cfg.StartupTimeout
+	case cfg.backend() == Kubernetes:
+		return 2 * time.Minute
+	case cfg.backend() == Embedded:
+		return 15 * time.Second
+	default:
+		return 10 * time.Second
+	}
+}
+
+// adminConnections returns the configured number of admin connections, or the default.
+func (cfg Config) adminConnections() int {
+	if cfg.AdminConnections > 0 {
+		return cfg.AdminConnections
+	}
+	return 4
+}
+
+// postgresConfPath is where a custom postgresql.conf is placed in the container.
+const postgresConfPath = "/etc/postgresql/postgresql.conf"
+
+// postgresConf returns the contents of the configured postgresql.conf, or nil if there is none.
+func (cfg Config) postgresConf() ([]byte, error) {
+	if cfg.PostgresConfData != nil {
+		return cfg.PostgresConfData, nil
+	}
+	if cfg.PostgresConf == "" {
+		return nil, nil
+	}
+	conf, err := os.ReadFile(cfg.PostgresConf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read postgresql.conf: %w", err)
+	}
+	return conf, nil
+}
+
+// fastProfile are the server settings of Config.FastProfile.
+var fastProfile = map[string]string{
+	"fsync":              "off",
+	"synchronous_commit": "off",
+	"full_page_writes":   "off",
+	"autovacuum":         "off",
+}
+
+// serverParams returns the settings the server is started with.
+func (cfg Config) serverParams() map[string]string {
+	params := map[string]string{"max_connections": strconv.Itoa(cfg.maxConnections())}
+	if cfg.Timezone != "" {
+		params["timezone"] = cfg.Timezone
+	}
+	if cfg.FastProfile {
+		maps.Copy(params, fastProfile)
+	}
+	maps.Copy(params, cfg.ServerParams)
+	return params
+}
+
+// serverArgs returns the settings the server is started with as sorted -c flags of the postgres command.
+func (cfg Config) serverArgs() []string {
+	params := cfg.serverParams()
+	var args []string
+	for _, key := range slices.Sorted(maps.Keys(params)) {
+		args = append(args, "-c", key+"="+params[key])
+	}
+	return args
+}
+
+// postgresCmd returns the command starting the server in the container.
+func (cfg Config) postgresCmd() []string {
+	cmd := append([]string{"postgres"}, cfg.serverArgs()...)
+	if cfg.PostgresConf != "" || cfg.PostgresConfData != nil {
+		// The server must be reachable through the mapped port whatever the file says.
+		cmd = append(cmd, "-c", "config_file="+postgresConfPath, "-c", "listen_addresses=*")
+	}
+	return cmd
+}
+
+// maxDatabaseNameLen is the longest template database name whose instance names, with an underscore and 32 hex
+// digits appended, stay within postgres' 63 byte identifier limit instead of being truncated.
+const maxDatabaseNameLen = 63 - 33
+
+// validateDatabaseName checks that name can be used as the template database name. Any other character is allowed,
+// as names are quoted in SQL.
+func validateDatabaseName(name string) error {
+	switch {
+	case name == "":
+		return errors.New("database name is required")
+	case len(name) > maxDatabaseNameLen:
+		return fmt.Errorf("database name %q is longer than %d bytes", name, maxDatabaseNameLen)
+	case strings.ContainsRune(name, 0):
+		return fmt.Errorf("database name %q contains a NUL character", name)
+	case !utf8.ValidString(name):
+		return fmt.Errorf("database name %q is not valid UTF-8", name)
+	}
+	return nil
+}
+
+// url returns the connection URL for database on the server, using scheme to select the driver.
+func (cfg Config) url(scheme, database string) string {
+	query := url.Values{"sslmode": {"disable"}}
+	if cfg.Timezone != "" {
+		query.Set("timezone", cfg.Timezone)
+	}
+	u := url.URL{
+		Scheme:   scheme,
+		User:     url.UserPassword(cfg.User, cfg.Password),
+		Host:     net.JoinHostPort(cfg.host, strconv.Itoa(cfg.port)),
+		Path:     "/" + database,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
 }
 
 type Container struct {
-	cfg       Config
-	container testcontainers.Container
-	pool      *pgxpool.Pool
+	cfg    Config
+	server server
+	pool   *pgxpool.Pool
+	info   ConnectionInfo
+	report *Report
+
+	clientCert *ClientCert
+
+	// slots limits the number of existing instances to Config.MaxInstances, nil when unlimited
+	slots chan struct{}
+
+	mu sync.Mutex
+	// instances maps the name of every existing instance to where it was created
+	instances map[string]string
+	// ttls maps the name of every instance with a TTL to the timer reaping it, nil once Close stopped them
+	ttls map[string]*time.Timer
+
+	// owned is false for containers adopted with Attach, whose lifecycle is managed elsewhere
+	owned bool
+
+	// snapshot restores the database for every instance with Restore isolation, nil otherwise
+	snapshot *postgres.PostgresContainer
+	// restoring is held by the single existing instance with Restore isolation
+	restoring chan struct{}
+
+	// templateMu is held for reading while cloning the templates, and for writing while refreshing them
+	templateMu sync.RWMutex
+
+	// drops queues the databases dropped in the background with Config.AsyncDrop, nil otherwise
+	drops chan dropJob
+	// queueMu is held while queueing drops, and dropsClosed is set once Close closed drops
+	queueMu     sync.Mutex
+	dropsClosed bool
+	// pendingDrops counts the queued drops which have not completed
+	pendingDrops sync.WaitGroup
+	dropMu       sync.Mutex
+	// dropErrs are the errors of background drops not yet returned by Drain
+	dropErrs []error
+
+	metrics metrics
+	// started is when setup began
+	started time.Time
+	// failed is set when a test using the container failed
+	failed atomic.Bool
 }
 
 // NewContainer launches a postgres test container and sets up the template database.
@@ -67,8 +648,36 @@ func NewContainer(cfg Config) (*Container, error) {
 	return setup(context.Background(), cfg)
 }
 
+// NewContainerContext is like NewContainer, but aborts setup when ctx is cancelled.
+func NewContainerContext(ctx context.Context, cfg Config) (*Container, error) {
+	return setup(ctx, cfg)
+}
+
 // NewInstance clones the template database to setup a database scoped to a single test
-func (c *Container) NewInstance(ctx context.Context) (*DatabaseInstance, error) {
+func (c *Container) NewInstance(ctx context.Context, opts ...InstanceOption) (_ *DatabaseInstance, err error) {
+	ctx, span := c.cfg.startSpan(ctx, "brrr.instance.create")
+	defer func() {
+		if err == nil {
+			c.metrics.created.Add(1)
+		}
+		endSpan(span, err)
+	}()
+
+	if c.snapshot != nil {
+		return c.restoreInstance(ctx, opts)
+	}
+
+	o := newInstanceOptions(c.cfg, opts)
+
+	if err := c.acquireInstance(ctx); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			c.releaseInstance()
+		}
+	}()
+
 	conn, err := c.pool.Acquire(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to acquire connection: %w", err)
@@ -76,121 +685,524 @@ func (c *Container) NewInstance(ctx context.Context) (*DatabaseInstance, error)
 	defer conn.Release()
 
 	name := c.cfg.Database + "_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	span.SetAttributes(databaseAttr(name))
 
-	_, err = conn.Exec(ctx, fmt.Sprintf("CREATE DATABASE %s TEMPLATE %s", name, c.cfg.Database))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create database from template: %w", err)
+	if err := runInstanceHook(ctx, conn.Conn(), "BeforeInstanceCreate", c.cfg.BeforeInstanceCreate, name); err != nil {
+		return nil, err
+	}
+	if err := c.createInstanceDatabase(ctx, conn, o, name); err != nil {
+		return nil, err
+	}
+	// The database, and the role if any, are dropped again when the instance can't be set up completely.
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, c.dropInstance(context.Background(), name, o.uniqueCredentials))
+		}
+	}()
+
+	cfg := c.cfg
+	if o.uniqueCredentials {
+		password, err := createInstanceRole(ctx, c.cfg, conn, name)
+		if err != nil {
+			return nil, err
+		}
+		cfg.User, cfg.Password = name, password
 	}
 
-	instanceConn, err := pgx.Connect(ctx, fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable", c.cfg.User, c.cfg.Password, c.cfg.host, c.cfg.port, name))
+	instanceConn, err := c.connect(ctx, cfg.url("postgres", name), o.tracer)
 	if err != nil {
 		return nil, err
 	}
 
-	return &DatabaseInstance{
+	var pool *pgxpool.Pool
+	if o.poolMaxConns > 0 {
+		if pool, err = openInstancePool(ctx, cfg.url("postgres", name), o); err != nil {
+			_ = instanceConn.Close(context.Background())
+			return nil, err
+		}
+	}
+	c.track(name, caller())
+
+	info := c.info
+	info.Database = name
+	info.User, info.Password = cfg.User, cfg.Password
+
+	di := &DatabaseInstance{
 		Connection: instanceConn,
+		Pool:       pool,
 		Name:       name,
-	}, nil
+		container:  c,
+		info:       info,
+		role:       o.uniqueCredentials,
+		opts:       o,
+	}
+	c.startReaper(di)
+	return di, nil
+}
+
+// connect opens a connection to connStr traced by tracer, retrying according to the configured connect retry policy.
+func (c *Container) connect(ctx context.Context, connStr string, tracer pgx.QueryTracer) (*pgx.Conn, error) {
+	if c.cfg.ConnectDeadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.cfg.ConnectDeadline)
+		defer cancel()
+	}
+
+	backoff := c.cfg.ConnectBackoff
+	if backoff == 0 {
+		backoff = 100 * time.Millisecond
+	}
+
+	connCfg, err := pgx.ParseConfig(connStr)
+	if err != nil {
+		return nil, err
+	}
+	connCfg.RuntimeParams["application_name"] = applicationName
+	connCfg.Tracer = tracer
+
+	for attempt := 0; ; attempt++ {
+		conn, err := pgx.ConnectConfig(ctx, connCfg)
+		if err == nil {
+			return conn, nil
+		}
+		if attempt >= c.cfg.ConnectRetries {
+			return nil, fmt.Errorf("failed to connect after %d attempts: %w", attempt+1, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to connect after %d attempts: %w", attempt+1, errors.Join(err, ctx.Err()))
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
 }
 
 type DatabaseInstance struct {
 	// Connection to the database for the single test instance
 	Connection *pgx.Conn
 
+	// Pool of connections to the database, for code under test running concurrent queries. Only set with WithPool.
+	Pool *pgxpool.Pool
+
 	// Name of the database for this single test instance
 	Name string
+
+	// container the instance was created by, which tears it down
+	container *Container
+	info      ConnectionInfo
+	// role is true when the instance has its own role, named after the database
+	role bool
+	// opts the instance was created with, applied again by Reset
+	opts instanceOptions
+	// resets counts the calls to Reset, so connections of DB made before the last one are discarded
+	resets atomic.Int64
+	// reaper drops the instance once its TTL has passed, nil without a TTL
+	reaper *time.Timer
+	// reaped is set once the reaper has dropped the instance
+	reaped atomic.Bool
+
+	// dbMu guards db, which is opened by DB on first use and closed by closeDB, possibly concurrently
+	dbMu sync.Mutex
+	db   *sql.DB
 }
 
 // Close will close the connection to the database for the single test instance and drop the database
 func (c *Container) CloseInstance(ctx context.Context, di *DatabaseInstance) error {
-	err := di.Connection.Close(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to close database connection: %w", err)
+	if c.snapshot != nil {
+		return c.closeRestoredInstance(ctx, di)
+	}
+
+	if di.reaper != nil {
+		di.reaper.Stop()
+	}
+	tracked := c.untrack(di.Name)
+	// The slot of the instance is freed once its database is dropped, by the worker with AsyncDrop.
+	release := tracked
+	defer func() {
+		if release {
+			c.releaseInstance()
+		}
+	}()
+
+	dbErr := di.closeDB()
+	if di.Pool != nil {
+		di.Pool.Close()
+	}
+	connErr := di.Connection.Close(ctx)
+	if !tracked && di.reaped.Load() {
+		// The reaper dropped the database already, terminating the connections.
+		return nil
+	}
+	if dbErr != nil {
+		return fmt.Errorf("failed to close database handle: %w", dbErr)
+	}
+	if connErr != nil {
+		return fmt.Errorf("failed to close database connection: %w", connErr)
 	}
 
+	if c.drops != nil {
+		if err := c.queueDrop(dropJob{name: di.Name, role: di.role, release: tracked}); err != nil {
+			return err
+		}
+		release = false
+		return nil
+	}
+	return c.dropInstance(ctx, di.Name, di.role)
+}
+
+// dropInstance drops the database of an instance, and its role if it has one.
+func (c *Container) dropInstance(ctx context.Context, name string, role bool) (err error) {
+	ctx, span := c.cfg.startSpan(ctx, "brrr.instance.drop", databaseAttr(name))
+	defer func() { endSpan(span, err) }()
+
 	conn, err := c.pool.Acquire(ctx)
 	if err != nil {
 		return err
 	}
 	defer conn.Release()
 
-	_, err = conn.Exec(ctx, fmt.Sprintf("DROP DATABASE %s WITH (FORCE)", di.Name))
-	return err
+	_, err = conn.Exec(ctx, fmt.Sprintf("DROP DATABASE %s WITH (FORCE)", pgx.Identifier{name}.Sanitize()))
+	if isUndefinedDatabase(err) {
+		return fmt.Errorf("failed to drop instance %s: %w: %w", name, ErrInstanceNotFound, err)
+	}
+	if err != nil {
+		return err
+	}
+	c.metrics.dropped.Add(1)
+	if role {
+		if err := dropInstanceRole(ctx, conn, name); err != nil {
+			return err
+		}
+	}
+	return runInstanceHook(ctx, conn.Conn(), "AfterInstanceDrop", c.cfg.AfterInstanceDrop, name)
 }
 
-// Close will terminate the database and delete the test container image
+// Close will terminate the database and delete the test container image, after waiting for background drops.
+// Containers adopted with Attach or started with Config.Reuse are left running; only brrr's own connections are closed.
+// A summary of the container's usage, see Report, is logged to Config.Logger, as are the instances which were never
+// closed, see Config.FailOnLeak.
 func (c *Container) Close() error {
-	return c.container.Terminate(context.Background())
+	var err error
+	if c.drops != nil {
+		err = c.Drain(context.Background())
+		c.queueMu.Lock()
+		c.dropsClosed = true
+		close(c.drops)
+		c.queueMu.Unlock()
+	}
+	c.stopReapers()
+	c.logUsage()
+	if leaked := c.holders(); len(leaked) > 0 {
+		c.cfg.logger().Warn("Instances were not closed", "database", c.cfg.Database, "instances", leaked)
+		if c.cfg.FailOnLeak {
+			err = errors.Join(err, &LeakError{Instances: leaked})
+		}
+	}
+	c.pool.Close()
+	if !c.owned {
+		return err
+	}
+	if c.cfg.KeepOnFailure && c.failed.Load() {
+		c.keep()
+		return err
+	}
+	return errors.Join(err, c.server.terminate(context.Background()))
 }
 
-func setup(ctx context.Context, cfg Config) (*Container, error) {
-	db, err := setupPostgresTestContainer(ctx, cfg)
+// validate checks the settings of cfg which don't depend on how the server is provided, for NewContainer and
+// Attach alike.
+func validate(cfg Config) error {
+	if err := validateDatabaseName(cfg.Database); err != nil {
+		return err
+	}
+	if cfg.MigrationsPath != "" && cfg.MigrationsFS != nil {
+		return errors.New("only one of MigrationsPath and MigrationsFS may be set")
+	}
+	if cfg.Migrator != nil && (cfg.MigrationsPath != "" || cfg.MigrationsFS != nil) {
+		return errors.New("only one of Migrator, MigrationsPath and MigrationsFS may be set")
+	}
+	if cfg.Migrator != nil && cfg.MigrationTargetVersion != 0 {
+		return errors.New("MigrationTargetVersion is not supported with Migrator")
+	}
+	if cfg.SeedPath != "" && cfg.SeedFS != nil {
+		return errors.New("only one of SeedPath and SeedFS may be set")
+	}
+	if cfg.CSVPath != "" && cfg.CSVFS != nil {
+		return errors.New("only one of CSVPath and CSVFS may be set")
+	}
+	if err := validateTemplates(cfg); err != nil {
+		return err
+	}
+	if tool := cfg.migrationTool(); tool != GolangMigrate && tool != Dbmate && cfg.Migrator == nil {
+		if _, err := registeredMigrationTool(tool); err != nil {
+			return err
+		}
+	}
+	if cfg.InstanceQuotaWait < 0 {
+		return errors.New("InstanceQuotaWait must not be negative, use InstanceQuotaWaitForever to wait until the context is done")
+	}
+	if cfg.isolation() == Restore && cfg.InstanceTTL != 0 {
+		return errors.New("instance TTLs are not supported with restore isolation")
+	}
+	if cfg.isolation() == Restore && cfg.InstanceConnectionLimit != 0 {
+		return errors.New("instance connection limits are not supported with restore isolation")
+	}
+	return nil
+}
+
+func setup(ctx context.Context, cfg Config) (_ *Container, err error) {
+	ctx, span := cfg.startSpan(ctx, "brrr.setup", databaseAttr(cfg.Database), attribute.String("brrr.backend", string(cfg.backend())))
+	defer func() { endSpan(span, err) }()
+
+	start := time.Now()
+	cfg, report := newReport(cfg.applyPresets())
+
+	cfg, err = resolveCredentials(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
+	var external *externalServer
+	if cfg.backend() == External {
+		if cfg, external, err = externalCredentials(cfg); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.KeepOnFailure && cfg.backend() != Docker {
+		return nil, fmt.Errorf("keeping containers on failure is not supported by the %s backend", cfg.backend())
+	}
+	if cfg.Persistent {
+		if cfg.backend() != Docker {
+			return nil, fmt.Errorf("persistent containers are not supported by the %s backend", cfg.backend())
+		}
+		cfg.Reuse = true
+	}
+	if cfg.Reuse && cfg.backend() == Docker {
+		if cfg.isolation() != Clone || cfg.ClientCertRole != "" {
+			return nil, errors.New("reuse is only supported with Clone isolation and without client certificates")
+		}
+		cfg = reuseCredentials(cfg)
+		if cfg.reuseName, err = reuseName(cfg); err != nil {
+			return nil, err
+		}
+	} else if cfg.Reuse && cfg.backend() != External {
+		return nil, fmt.Errorf("reuse is not supported by the %s backend", cfg.backend())
+	}
+	if cfg.backend() != External {
+		if cfg, err = defaultCredentials(cfg); err != nil {
+			return nil, err
+		}
+	}
+	if err := validate(cfg); err != nil {
+		return nil, err
+	}
+	if b := cfg.backend(); b != Docker && b != External {
+		if _, err := registeredBackend(b); err != nil {
+			return nil, err
+		}
+	}
+	if (cfg.Encoding != "" || cfg.Collation != "") && cfg.backend() == Embedded {
+		return nil, errors.New("encoding and collation are not supported by the embedded backend")
+	}
+	if (cfg.RegistryAuth != nil || cfg.PullPolicy != "") && cfg.backend() != Docker {
+		return nil, fmt.Errorf("registry credentials and pull policies are not supported by the %s backend", cfg.backend())
+	}
+	switch cfg.pullPolicy() {
+	case PullIfNotPresent, PullAlways, PullNever:
+	default:
+		return nil, fmt.Errorf("unknown pull policy %q", cfg.PullPolicy)
+	}
+	if cfg.HostPort != 0 && (cfg.backend() == Kubernetes || cfg.backend() == External) {
+		return nil, fmt.Errorf("host ports are not supported by the %s backend", cfg.backend())
+	}
+	if cfg.HostNetwork {
+		if cfg.backend() != Docker {
+			return nil, fmt.Errorf("host networking is not supported by the %s backend", cfg.backend())
+		}
+		if cfg.HostPort == 0 {
+			if cfg.HostPort, err = freePort(); err != nil {
+				return nil, fmt.Errorf("failed to find a free port: %w", err)
+			}
+		}
+	}
+	if cfg.Network != "" && cfg.backend() != Docker {
+		return nil, fmt.Errorf("networks are not supported by the %s backend", cfg.backend())
+	}
+	if cfg.Network == "" && len(cfg.NetworkAliases) > 0 {
+		return nil, errors.New("network aliases require a network")
+	}
+	if cfg.Network != "" && cfg.HostNetwork {
+		return nil, errors.New("a network can not be combined with host networking")
+	}
+	if cfg.MemoryLimit < 0 || cfg.CPULimit < 0 || cfg.CPUShares < 0 || cfg.ShmSize < 0 {
+		return nil, errors.New("resource limits must not be negative")
+	}
+	if (cfg.MemoryLimit != 0 || cfg.CPULimit != 0 || cfg.ShmSize != 0) && (cfg.backend() == Embedded || cfg.backend() == External) {
+		return nil, fmt.Errorf("resource limits are not supported by the %s backend", cfg.backend())
+	}
+	if cfg.CPUShares != 0 && cfg.backend() != Docker {
+		return nil, fmt.Errorf("CPU shares are not supported by the %s backend", cfg.backend())
+	}
+	if (cfg.DisableReaper || cfg.ReaperPrivileged || cfg.ReaperRegistry != "") && cfg.backend() != Docker {
+		return nil, fmt.Errorf("reaper settings are not supported by the %s backend", cfg.backend())
+	}
+	if cfg.Session != "" && (cfg.backend() == Embedded || cfg.backend() == External) {
+		return nil, fmt.Errorf("sessions are not supported by the %s backend", cfg.backend())
+	}
+	if cfg.LogOutput != nil && cfg.backend() == External {
+		return nil, errors.New("server logs are not supported by the external backend")
+	}
+	if cfg.ContainerName != "" && (cfg.backend() == Embedded || cfg.backend() == External) {
+		return nil, fmt.Errorf("container names are not supported by the %s backend", cfg.backend())
+	}
+	if len(cfg.Labels) > 0 && (cfg.backend() == Embedded || cfg.backend() == External) {
+		return nil, fmt.Errorf("labels are not supported by the %s backend", cfg.backend())
+	}
+	if cfg.WaitFor != nil && cfg.backend() != Docker {
+		return nil, fmt.Errorf("wait strategies are not supported by the %s backend", cfg.backend())
+	}
+	if (cfg.FastProfile || len(cfg.ServerParams) > 0) && cfg.backend() == External {
+		return nil, errors.New("server settings are not supported by the external backend")
+	}
+	for key := range cfg.ServerParams {
+		if key == "" || strings.ContainsAny(key, "= ") {
+			return nil, fmt.Errorf("invalid server parameter name %q", key)
+		}
+	}
+
+	if conf, err := cfg.postgresConf(); err != nil {
+		return nil, err
+	} else if conf != nil {
+		if cfg.backend() == Kubernetes || cfg.backend() == External {
+			return nil, fmt.Errorf("postgresql.conf is not supported by the %s backend", cfg.backend())
+		}
+		cfg.files = append(cfg.files, testcontainers.ContainerFile{
+			Reader:            bytes.NewReader(conf),
+			ContainerFilePath: postgresConfPath,
+			FileMode:          0o644,
+		})
+	}
+
+	var clientCert *ClientCert
+	if cfg.isolation() == Restore && cfg.backend() != Docker {
+		return nil, fmt.Errorf("restore isolation is not supported by the %s backend", cfg.backend())
+	}
 
-	port, err := db.MappedPort(ctx, "5432/tcp")
+	if cfg.ClientCertRole != "" {
+		if cfg.backend() != Docker {
+			return nil, fmt.Errorf("client certificate authentication is not supported by the %s backend", cfg.backend())
+		}
+		var files []testcontainers.ContainerFile
+		if clientCert, files, err = certAuthFiles(cfg.ClientCertRole); err != nil {
+			return nil, err
+		}
+		cfg.files = append(cfg.files, files...)
+	}
+
+	srv, err := startServer(ctx, cfg, external)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, fmt.Errorf("%w: %w", ErrContainerStartTimeout, err)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	inspect, err := db.Inspect(ctx)
+	c, err := setupTemplate(ctx, cfg, srv, report, start)
 	if err != nil {
 		return nil, err
 	}
+	c.owned = !cfg.Reuse
 
-	cfg.host = "localhost"
-	if inspect != nil &&
-		inspect.NetworkSettings != nil &&
-		inspect.NetworkSettings.Networks != nil &&
-		inspect.NetworkSettings.Networks["bridge"] != nil {
-		cfg.host = inspect.NetworkSettings.Networks["bridge"].Gateway.String()
+	if clientCert != nil {
+		role := pgx.Identifier{clientCert.Role}.Sanitize()
+		if _, err := c.pool.Exec(ctx, fmt.Sprintf("CREATE ROLE %s LOGIN IN ROLE pg_read_all_data, pg_write_all_data", role)); err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to create client certificate role: %w", err), c.Close())
+		}
+		c.clientCert = clientCert
 	}
 
-	cfg.port = int(port.Num())
+	return c, nil
+}
+
+// startServer starts the postgres server of the configured backend, or returns external for the External backend.
+func startServer(ctx context.Context, cfg Config, external *externalServer) (srv server, err error) {
+	ctx, span := cfg.startSpan(ctx, "brrr.server.start", attribute.String("brrr.backend", string(cfg.backend())))
+	defer func() { endSpan(span, err) }()
+
+	for attempt := 0; ; attempt++ {
+		switch cfg.backend() {
+		case Docker:
+			srv, err = startDockerServer(ctx, cfg)
+		case External:
+			return external, nil
+		default:
+			srv, err = startRegisteredServer(ctx, cfg, cfg.backend())
+		}
+		if err == nil || attempt >= cfg.StartupRetries || ctx.Err() != nil {
+			return srv, err
+		}
+		cfg.logger().Warn("Failed to start postgres server, retrying", "attempt", attempt+1, "error", err)
+	}
+}
+
+// setupTemplate resolves the address of the running postgres server and builds the template database in it.
+// Setup began at start, and the outcome is recorded in report.
+func setupTemplate(ctx context.Context, cfg Config, srv server, report *Report, start time.Time) (*Container, error) {
+	var err error
+	cfg.host, cfg.port, err = srv.endpoint(ctx)
+	if err != nil {
+		return nil, err
+	}
 
 	pool, err := setupPgxPool(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	fmt.Println("Test container setup complete")
+	// The database is created by the container entrypoint, but attached containers may not have it yet.
+	created, err := ensureDatabase(ctx, pool, cfg.Database, cfg.createDatabaseOptions())
+	if err != nil {
+		return nil, err
+	}
 
-	if cfg.MigrationsPath != "" {
-		fmt.Println("Starting migrations")
-		if err := runMigrations(cfg, cfg.MigrationsPath); err != nil {
+	if !cfg.KeepStaleInstances {
+		dropped, err := dropStaleInstances(ctx, pool, cfg.Database)
+		if err != nil {
 			return nil, err
 		}
-		fmt.Println("Database migrations complete")
+		if len(dropped) > 0 {
+			cfg.logger().Info("Dropped stale instance databases", "count", len(dropped), "databases", dropped)
+		}
 	}
 
-	if cfg.SeedPath != "" {
-		fmt.Println("Starting seeding")
-		if err := executeFiles(cfg, cfg.SeedPath); err != nil {
+	cfg.logger().Info("Test container setup complete")
+
+	fp, err := fingerprint(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// External servers outlive runs, so they may hold the template of an earlier run, which is rebuilt when stale.
+	var fresh bool
+	if cfg.reusesTemplate() && cfg.isolation() != Migrate {
+		if fresh, err = reusableTemplate(ctx, cfg, pool, fp, created); err != nil {
 			return nil, err
 		}
-		fmt.Println("Database seeding complete")
 	}
 
-	if cfg.SeedFunc != nil {
-		err = func() error {
-			dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable", cfg.host, cfg.port, cfg.User, cfg.Password, cfg.Database)
-			db, err := sql.Open("pgx", dsn)
-			if err != nil {
-				return fmt.Errorf("failed to open database connection: %w", err)
-			}
-			defer db.Close()
-			if err = db.Ping(); err != nil {
-				return fmt.Errorf("failed to ping database: %w", err)
-			}
-
-			connStr := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable", cfg.User, cfg.Password, cfg.host, cfg.port, cfg.Database)
-			return cfg.SeedFunc(db, connStr)
-		}()
-		if err != nil {
+	var snapshot *postgres.PostgresContainer
+	switch {
+	case cfg.isolation() == Migrate:
+		// Every instance is migrated itself, so there is no template to build.
+	case fresh:
+		cfg.logger().Info("Reusing up to date database template", "database", cfg.Database)
+	default:
+		if snapshot, err = buildTemplate(ctx, cfg, srv, pool, fp); err != nil {
 			return nil, err
 		}
-		fmt.Println("Database seed func complete")
+	}
+	if err := buildTemplates(ctx, cfg, srv, pool); err != nil {
+		return nil, err
 	}
 
 	c, err := pool.Acquire(ctx)
@@ -199,78 +1211,284 @@ func setup(ctx context.Context, cfg Config) (*Container, error) {
 	}
 	defer c.Release()
 
-	if _, err := c.Exec(ctx, fmt.Sprintf("ALTER DATABASE %s is_template=true", cfg.Database)); err != nil {
+	cfg.logger().Info("Database template setup complete", "database", cfg.Database)
+
+	info, err := connectionInfo(ctx, cfg, srv)
+	if err != nil {
 		return nil, err
 	}
 
-	fmt.Println("Database template setup complete")
+	err = c.QueryRow(ctx, "SELECT current_setting('server_version'), pg_database_size($1)", cfg.Database).Scan(&report.ServerVersion, &report.TemplateSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect template database: %w", err)
+	}
+	report.Fingerprint = fp
+	report.Setup = time.Since(start)
+
+	// Stages run after setup, e.g. by RefreshTemplate, are not part of the setup report.
+	cfg.OnProgress = cfg.onProgress
 
-	return &Container{
+	var slots chan struct{}
+	if cfg.MaxInstances > 0 {
+		slots = make(chan struct{}, cfg.MaxInstances)
+	}
+
+	container := &Container{
 		cfg:       cfg,
-		container: db,
+		server:    srv,
 		pool:      pool,
-	}, nil
+		info:      info,
+		report:    report,
+		slots:     slots,
+		instances: map[string]string{},
+		ttls:      map[string]*time.Timer{},
+		snapshot:  snapshot,
+		restoring: make(chan struct{}, 1),
+		started:   start,
+	}
+	if cfg.AsyncDrop {
+		container.startDropWorker()
+	}
+	return container, nil
 }
 
-// runMigrations runs sql files from the specified path using go migrate file includings its file notations using sequences and up/down.
-func runMigrations(cfg Config, path string) error {
-	absPath := path
-	if !filepath.IsAbs(path) {
-		wd, err := os.Getwd()
-		if err != nil {
-			return err
+// buildTemplate migrates and seeds the template database and flags it as a template. With Restore isolation it
+// returns the container snapshotting it. fp is the fingerprint of cfg.
+func buildTemplate(ctx context.Context, cfg Config, srv server, pool *pgxpool.Pool, fp string) (_ *postgres.PostgresContainer, err error) {
+	ctx, span := cfg.startSpan(ctx, "brrr.template.build", databaseAttr(cfg.Database))
+	defer func() { endSpan(span, err) }()
+
+	if err := populateDatabase(ctx, cfg, srv); err != nil {
+		return nil, err
+	}
+
+	if cfg.FreezeTemplate {
+		if err := freezeTemplate(ctx, cfg, pool); err != nil {
+			return nil, err
+		}
+	}
+
+	templateStart := time.Now()
+	var snapshot *postgres.PostgresContainer
+	if cfg.isolation() == Restore {
+		var err error
+		if snapshot, err = snapshotTemplate(ctx, cfg, srv); err != nil {
+			return nil, err
 		}
-		absPath = filepath.Join(wd, path)
+	} else if _, err := pool.Exec(ctx, fmt.Sprintf("ALTER DATABASE %s is_template=true", pgx.Identifier{cfg.Database}.Sanitize())); err != nil {
+		return nil, err
+	}
+	if cfg.reusesTemplate() {
+		if err := markReusable(ctx, cfg, pool, fp); err != nil {
+			return nil, err
+		}
+	}
+	cfg.progress(StageTemplate, cfg.Database, templateStart)
+
+	if err := runHook(ctx, cfg, "AfterTemplateReady", cfg.AfterTemplateReady); err != nil {
+		return nil, err
 	}
+	return snapshot, nil
+}
 
-	fmt.Printf("Executing files from: %s\n", absPath)
+// populateDatabase restores the dump into the database cfg.Database on srv, then migrates, seeds, validates and
+// finalizes it, calling the hooks along the way.
+func populateDatabase(ctx context.Context, cfg Config, srv server) error {
+	var err error
 
-	m, err := migrate.New("file://"+absPath, fmt.Sprintf("pgx5://%s:%s@%s:%d/%s?sslmode=disable", cfg.User, cfg.Password, cfg.host, cfg.port, cfg.Database))
-	if err != nil {
+	if err := createExtensions(ctx, cfg); err != nil {
+		return err
+	}
+	if err := runHook(ctx, cfg, "BeforeMigrate", cfg.BeforeMigrate); err != nil {
+		return err
+	}
+	if cfg.DumpPath != "" {
+		if err := restoreDump(ctx, cfg, srv); err != nil {
+			return err
+		}
+	}
+
+	if cfg.MigrationsPath != "" || cfg.MigrationsFS != nil || cfg.Migrator != nil {
+		cfg.logger().Debug("Starting migrations", "database", cfg.Database)
+		if err := runMigrations(ctx, cfg); err != nil {
+			return err
+		}
+		cfg.logger().Info("Database migrations complete", "database", cfg.Database)
+	}
+	if err := runHook(ctx, cfg, "AfterMigrate", cfg.AfterMigrate); err != nil {
 		return err
 	}
 
-	if err = m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+	if err := runHook(ctx, cfg, "BeforeSeed", cfg.BeforeSeed); err != nil {
 		return err
 	}
+	if cfg.SeedPath != "" || cfg.SeedFS != nil {
+		cfg.logger().Debug("Starting seeding", "database", cfg.Database)
+		fsys, err := sourceFS(cfg, cfg.SeedFS, cfg.SeedPath)
+		if err != nil {
+			return err
+		}
+		if err := executeFiles(ctx, cfg, fsys); err != nil {
+			return err
+		}
+		cfg.logger().Info("Database seeding complete", "database", cfg.Database)
+	}
+
+	if cfg.CSVPath != "" || cfg.CSVFS != nil {
+		cfg.logger().Debug("Starting CSV loading", "database", cfg.Database)
+		err = func() error {
+			fsys, err := sourceFS(cfg, cfg.CSVFS, cfg.CSVPath)
+			if err != nil {
+				return err
+			}
+			conn, err := pgx.Connect(ctx, cfg.url("postgres", cfg.Database))
+			if err != nil {
+				return fmt.Errorf("failed to connect to database: %w", err)
+			}
+			defer conn.Close(context.Background())
+
+			start := time.Now()
+			if err := LoadCSV(ctx, conn, fsys); err != nil {
+				return err
+			}
+			cfg.progress(StageSeed, "csv", start)
+			return nil
+		}()
+		if err != nil {
+			return err
+		}
+		cfg.logger().Info("Database CSV loading complete", "database", cfg.Database)
+	}
+
+	if cfg.SeedFunc != nil {
+		start := time.Now()
+		err = func() error {
+			db, err := sql.Open("pgx", cfg.url("postgres", cfg.Database))
+			if err != nil {
+				return fmt.Errorf("failed to open database connection: %w", err)
+			}
+			defer db.Close()
+			if err = db.Ping(); err != nil {
+				return fmt.Errorf("failed to ping database: %w", err)
+			}
+
+			connStr := cfg.url("postgres", cfg.Database)
+			return cfg.SeedFunc(db, connStr)
+		}()
+		if err != nil {
+			return err
+		}
+		cfg.progress(StageSeedFunc, "", start)
+		cfg.logger().Info("Database seed func complete", "database", cfg.Database)
+	}
+
+	if cfg.SeedFuncCtx != nil {
+		start := time.Now()
+		err = func() error {
+			connStr := cfg.url("postgres", cfg.Database)
+			conn, err := pgx.Connect(ctx, connStr)
+			if err != nil {
+				return fmt.Errorf("failed to connect to database: %w", err)
+			}
+			defer conn.Close(context.Background())
+
+			return cfg.SeedFuncCtx(ctx, conn, connStr)
+		}()
+		if err != nil {
+			return err
+		}
+		cfg.progress(StageSeedFunc, "", start)
+		cfg.logger().Info("Database seed func complete", "database", cfg.Database)
+	}
+
+	if len(cfg.SyntheticRows) > 0 {
+		err = func() error {
+			conn, err := pgx.Connect(ctx, cfg.url("postgres", cfg.Database))
+			if err != nil {
+				return fmt.Errorf("failed to connect to database: %w", err)
+			}
+			defer conn.Close(context.Background())
+
+			start := time.Now()
+			return generateSyntheticData(ctx, conn, cfg.SyntheticRows, cfg.SyntheticFaker, func(table string) {
+				cfg.progress(StageSyntheticData, table, start)
+				start = time.Now()
+			})
+		}()
+		if err != nil {
+			return err
+		}
+		cfg.logger().Info("Database synthetic data complete", "database", cfg.Database)
+	}
+
+	if len(cfg.ValidateTemplate) > 0 {
+		err = func() error {
+			conn, err := pgx.Connect(ctx, cfg.url("postgres", cfg.Database))
+			if err != nil {
+				return fmt.Errorf("failed to connect to database: %w", err)
+			}
+			defer conn.Close(context.Background())
 
-	sErr, mErr := m.Close()
-	if sErr != nil {
-		return sErr
+			return validateTemplate(ctx, conn, cfg.ValidateTemplate)
+		}()
+		if err != nil {
+			return err
+		}
+		cfg.logger().Info("Database template validation complete", "database", cfg.Database)
 	}
-	if mErr != nil {
-		return mErr
+
+	if cfg.TemplateFinalize != nil {
+		err = func() error {
+			conn, err := pgx.Connect(ctx, cfg.url("postgres", cfg.Database))
+			if err != nil {
+				return fmt.Errorf("failed to connect to template database: %w", err)
+			}
+			defer conn.Close(context.Background())
+
+			if err := cfg.TemplateFinalize(ctx, conn); err != nil {
+				return fmt.Errorf("failed to finalize template: %w", err)
+			}
+			return nil
+		}()
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-// executeFiles reads and executes SQL files from a directory, ordered by filename.
-func executeFiles(cfg Config, path string) error {
+// sourceFS returns fsys if set, or else the directory at path, relative to the working directory.
+func sourceFS(cfg Config, fsys fs.FS, path string) (fs.FS, error) {
+	if fsys != nil {
+		return fsys, nil
+	}
+
 	absPath := path
-	if !filepath.IsAbs(path) {
+	if !filepath.IsAbs(absPath) {
 		wd, err := os.Getwd()
 		if err != nil {
-			return err
+			return nil, err
 		}
-		absPath = filepath.Join(wd, path)
+		absPath = filepath.Join(wd, absPath)
 	}
 
-	fmt.Printf("Executing files from: %s\n", absPath)
+	cfg.logger().Debug("Executing files", "path", absPath)
 
-	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable", cfg.host, cfg.port, cfg.User, cfg.Password, cfg.Database)
+	return os.DirFS(absPath), nil
+}
 
-	db, err := sql.Open("pgx", dsn)
+// executeFiles reads and executes SQL files from the root of fsys, ordered by filename. The statements of a file are
+// executed one by one in a transaction, so errors name the statement and line that failed and leave nothing of the
+// file behind.
+func executeFiles(ctx context.Context, cfg Config, fsys fs.FS) error {
+	conn, err := pgx.Connect(ctx, cfg.url("postgres", cfg.Database))
 	if err != nil {
-		return fmt.Errorf("failed to open database connection: %w", err)
-	}
-	defer db.Close()
-
-	if err = db.Ping(); err != nil {
-		return fmt.Errorf("failed to ping database: %w", err)
+		return fmt.Errorf("failed to connect to database: %w", err)
 	}
+	defer conn.Close(context.Background())
 
-	files, err := os.ReadDir(absPath)
+	files, err := fs.ReadDir(fsys, ".")
 	if err != nil {
 		return fmt.Errorf("failed to read directory: %w", err)
 	}
@@ -288,85 +1506,224 @@ func executeFiles(cfg Config, path string) error {
 	})
 
 	for _, file := range sqlFiles {
-		filePath := filepath.Join(absPath, file.Name())
-		fmt.Printf("  -> Executing: %s\n", file.Name())
+		start := time.Now()
+		cfg.logger().Debug("Executing seed file", "file", file.Name())
 
-		content, err := os.ReadFile(filePath)
+		// Files are streamed from disk a statement at a time, so large dumps are never held in memory as a whole.
+		err := func() (err error) {
+			ctx, span := cfg.startSpan(ctx, "brrr.seed.file", databaseAttr(cfg.Database), attribute.String("brrr.file", file.Name()))
+			defer func() { endSpan(span, err) }()
+
+			f, err := fsys.Open(file.Name())
+			if err != nil {
+				return fmt.Errorf("failed to read file %s: %w", file.Name(), err)
+			}
+			defer f.Close()
+
+			r, err := renderSeed(cfg, file.Name(), f)
+			if err != nil {
+				return err
+			}
+			return executeFile(ctx, conn, file.Name(), r)
+		}()
 		if err != nil {
-			return fmt.Errorf("failed to read file %s: %w", file.Name(), err)
+			return err
 		}
+		cfg.progress(StageSeed, file.Name(), start)
+	}
 
-		// If switching from pgx, make sure replacement has multi-statement support
-		if _, err = db.Exec(string(content)); err != nil {
-			return fmt.Errorf("failed to execute SQL in %s: %w", file.Name(), err)
-		}
+	return nil
+}
+
+// freezeTemplate vacuums and freezes the template database and flushes it to disk, so clones start without
+// pending hint bit, visibility map and dirty buffer work.
+func freezeTemplate(ctx context.Context, cfg Config, pool *pgxpool.Pool) error {
+	conn, err := pgx.Connect(ctx, cfg.url("postgres", cfg.Database))
+	if err != nil {
+		return fmt.Errorf("failed to connect to template database: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "VACUUM (FREEZE, ANALYZE)"); err != nil {
+		return fmt.Errorf("failed to vacuum template database: %w", err)
 	}
 
+	if _, err := pool.Exec(ctx, "CHECKPOINT"); err != nil {
+		return fmt.Errorf("failed to checkpoint: %w", err)
+	}
 	return nil
 }
 
+// ensureDatabase creates the named database unless it already exists, reporting whether it did.
+func ensureDatabase(ctx context.Context, pool *pgxpool.Pool, name, options string) (bool, error) {
+	var exists bool
+	if err := pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)", name).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to look up database %s: %w", name, err)
+	}
+	if exists {
+		return false, nil
+	}
+
+	if _, err := pool.Exec(ctx, fmt.Sprintf("CREATE DATABASE %s%s", pgx.Identifier{name}.Sanitize(), options)); err != nil {
+		return false, fmt.Errorf("failed to create database %s: %w", name, err)
+	}
+	return true, nil
+}
+
 func setupPgxPool(ctx context.Context, cfg Config) (*pgxpool.Pool, error) {
-	conn := fmt.Sprintf("postgres://%s:%s@%s:%d/postgres?sslmode=disable", cfg.User, cfg.Password, cfg.host, cfg.port)
+	conn := cfg.url("postgres", "postgres")
 
 	conf, err := pgxpool.ParseConfig(conn)
 	if err != nil {
 		return nil, err
 	}
 
-	// Limit to 1 connection because of create database from template approach. Will fail if multiple connections, since template requires exclusive access when creating.
-	conf.MaxConns = 1
+	conf.ConnConfig.RuntimeParams["application_name"] = applicationName
+	conf.ConnConfig.Tracer = cfg.Tracer
+
+	// Clones don't conflict with each other, see cloneTemplate.
+	conf.MaxConns = int32(cfg.adminConnections())
 
 	return pgxpool.NewWithConfig(ctx, conf)
 }
 
 func setupPostgresTestContainer(ctx context.Context, cfg Config) (testcontainers.Container, error) {
-	port := "5432/tcp"
+	pgContainer, err := testcontainers.GenericContainer(ctx, postgresContainerRequest(cfg))
+	if err != nil {
+		// Containers which did not become ready are returned along with the error.
+		if pgContainer != nil && cfg.reuseName == "" {
+			_ = pgContainer.Terminate(context.Background())
+		}
+		return nil, err
+	}
 
-	img := "postgres:17.2"
-	if cfg.Image != "" {
-		img = cfg.Image
+	return pgContainer, nil
+}
+
+// waitStrategy returns the configured wait strategy, or one waiting until the server accepts queries on port.
+func (cfg Config) waitStrategy(port string) wait.Strategy {
+	if cfg.WaitFor != nil {
+		return cfg.WaitFor
 	}
+	return wait.ForSQL(port, "pgx", func(host string, port string) string {
+		// testcontainers-go v0.42 passes the port as "<num>/<proto>" (e.g. "5432/tcp").
+		// Strip the protocol suffix so it doesn't leak into the URL path and corrupt the dbname.
+		portNum, _, _ := strings.Cut(port, "/")
+		cfg.host = host
+		cfg.port, _ = strconv.Atoi(portNum)
+		return cfg.url("postgres", cfg.Database)
+	}).WithStartupTimeout(cfg.startupTimeout())
+}
 
-	maxConnections := 1000
-	if cfg.MaxConnections != 0 {
-		maxConnections = cfg.MaxConnections
+// brrrLabel marks containers and pods started by brrr.
+const brrrLabel = "brrr"
+
+// labels returns the labels of the container or pod started for cfg.
+func (cfg Config) labels() map[string]string {
+	labels := cfg.reaperLabels()
+	maps.Copy(labels, cfg.Labels)
+	labels[brrrLabel] = "true"
+	return labels
+}
+
+// postgresContainerRequest describes the postgres test container for cfg.
+func postgresContainerRequest(cfg Config) testcontainers.GenericContainerRequest {
+	port := "5432/tcp"
+	if cfg.HostNetwork {
+		port = strconv.Itoa(cfg.HostPort) + "/tcp"
 	}
 
 	req := testcontainers.ContainerRequest{
-		Image:        img,
+		Image:        cfg.image(),
 		ExposedPorts: []string{port},
 		Env: map[string]string{
 			"POSTGRES_DB":       cfg.Database,
+			"POSTGRES_USER":     cfg.User,
 			"POSTGRES_PASSWORD": cfg.Password,
 			"PGDATA":            "/var/lib/pg/data",
 		},
-		Cmd: []string{"postgres", "-c", fmt.Sprintf("max_connections=%d", maxConnections)},
+		Cmd: cfg.postgresCmd(),
 		Tmpfs: map[string]string{
 			"/var/lib/pg/data": "rw",
 		},
-		WaitingFor: wait.ForSQL(port, "pgx", func(host string, port string) string {
-			// testcontainers-go v0.42 passes the port as "<num>/<proto>" (e.g. "5432/tcp").
-			// Strip the protocol suffix so it doesn't leak into the URL path and corrupt the dbname.
-			portNum, _, _ := strings.Cut(port, "/")
-			return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", cfg.User, cfg.Password, host, portNum, cfg.Database)
-		}).WithStartupTimeout(10 * time.Second),
+		Files:              cfg.files,
+		AlwaysPullImage:    cfg.alwaysPull(),
+		ConfigModifier:     cfg.containerConfig,
+		HostConfigModifier: cfg.hostConfig,
+		WaitingFor:         cfg.waitStrategy(port),
+	}
+
+	if args := cfg.initdbArgs(); args != "" {
+		req.Env["POSTGRES_INITDB_ARGS"] = args
+	}
+	if cfg.Timezone != "" {
+		req.Env["TZ"] = cfg.Timezone
+	}
+	if cfg.Network != "" {
+		req.Networks = []string{cfg.Network}
+		req.NetworkAliases = map[string][]string{cfg.Network: cfg.NetworkAliases}
+	}
+	if cfg.HostNetwork {
+		// Both the server and psql in the container default to PGPORT, which keeps them off the ports of the host.
+		req.Env["PGPORT"] = strconv.Itoa(cfg.HostPort)
 	}
 
+	// Images are pulled right before the container is created, so the pre-create hook marks the end of the pull.
+	start := time.Now()
+	req.LifecycleHooks = []testcontainers.ContainerLifecycleHooks{{
+		PreCreates: []testcontainers.ContainerRequestHook{
+			func(context.Context, testcontainers.ContainerRequest) error {
+				cfg.progress(StageImagePull, req.Image, start)
+				start = time.Now()
+				return nil
+			},
+		},
+		PostReadies: []testcontainers.ContainerHook{
+			func(_ context.Context, c testcontainers.Container) error {
+				cfg.progress(StageContainerStart, c.GetContainerID(), start)
+				return nil
+			},
+		},
+	}}
+
 	var logger log.Logger
 	if cfg.Logger != nil {
 		logger = &SlogAdapter{logger: cfg.Logger}
 	}
 
-	pgContainer, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+	if cfg.LogOutput != nil {
+		req.LogConsumerCfg = &testcontainers.LogConsumerConfig{
+			Consumers: []testcontainers.LogConsumer{logWriter{cfg.LogOutput}},
+		}
+	}
+	req.Name = cfg.ContainerName
+	req.Labels = cfg.labels()
+	if cfg.reuseName != "" {
+		req.Name = cfg.reuseName
+		req.Labels[reuseLabel] = "true"
+	}
+
+	return testcontainers.GenericContainerRequest{
 		ContainerRequest: req,
 		Logger:           logger,
 		Started:          true,
-	})
-	if err != nil {
-		return nil, err
+		Reuse:            cfg.reuseName != "",
 	}
+}
 
-	return pgContainer, nil
+// logWriter writes the log of the container to w.
+type logWriter struct {
+	w io.Writer
+}
+
+func (l logWriter) Accept(log testcontainers.Log) {
+	_, _ = l.Write(log.Content)
+}
+
+// Write writes p to w, ignoring errors so a failing Config.LogOutput does not stop the log from being read.
+func (l logWriter) Write(p []byte) (int, error) {
+	_, _ = l.w.Write(p)
+	return len(p), nil
 }
 
 type SlogAdapter struct {
@@ -2,30 +2,52 @@ package brrr_test
 
 import (
 	"context"
+	"errors"
+	"net"
 	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/moby/moby/client"
 	"github.com/modfin/brrr"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/network"
+	"github.com/testcontainers/testcontainers-go/wait"
 )
 
-var testContainer *brrr.Container
-
+// TestMain starts the container shared by the tests, which they get from brrr.Default. User and Password are
+// generated, see TestContainer_DefaultCredentials.
 func TestMain(m *testing.M) {
-	c, err := brrr.NewContainer(brrr.Config{
-		User:     "postgres",
-		Password: "postgres",
-		Database: "brrr_test",
-	})
+	os.Exit(brrr.Main(m, brrr.Config{Database: "brrr_test"}))
+}
+
+// newContainer starts a container for cfg, closed when t completes. Tests which don't depend on the server itself
+// build their template in the server of brrr.Default, see sharedServer.
+func newContainer(t *testing.T, cfg brrr.Config) *brrr.Container {
+	t.Helper()
+	c, err := brrr.NewContainer(cfg)
 	if err != nil {
-		panic("failed to start test container: " + err.Error())
-	}
-	testContainer = c
-	code := m.Run()
-	if err := c.Close(); err != nil {
-		panic("failed to close test container: " + err.Error())
+		t.Fatalf("NewContainer: %v", err)
 	}
-	os.Exit(code)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// sharedServer returns cfg set up to use the server of brrr.Default through ExternalDSN instead of starting one,
+// so only the template of cfg is built. Databases of different tests must be named differently.
+func sharedServer(cfg brrr.Config) brrr.Config {
+	info := brrr.Default().ConnectionInfo()
+	info.Database = "postgres"
+	cfg.ExternalDSN = info.URL()
+	return cfg
 }
 
 // TestNewContainer_StartsCleanly is the regression test for the wait.ForSQL URL
@@ -36,21 +58,28 @@ func TestMain(m *testing.M) {
 // If TestMain completes successfully, this test passes; it exists to name the
 // guarantee explicitly so future regressions surface as a named failure.
 func TestNewContainer_StartsCleanly(t *testing.T) {
-	if testContainer == nil {
+	if brrr.Default() == nil {
 		t.Fatal("test container was not initialized in TestMain")
 	}
 }
 
+func TestDefault(t *testing.T) {
+	// brrr.Main makes the container started for its config the default while the tests run.
+	if db := brrr.Default().ConnectionInfo().Database; db != "brrr_test" {
+		t.Errorf("expected the container of TestMain, got the one of database %s", db)
+	}
+}
+
 func TestContainer_NewInstance_IsUsable(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	di, err := testContainer.NewInstance(ctx)
+	di, err := brrr.Default().NewInstance(ctx)
 	if err != nil {
 		t.Fatalf("NewInstance: %v", err)
 	}
 	t.Cleanup(func() {
-		if err := testContainer.CloseInstance(context.Background(), di); err != nil {
+		if err := brrr.Default().CloseInstance(context.Background(), di); err != nil {
 			t.Errorf("CloseInstance: %v", err)
 		}
 	})
@@ -68,17 +97,17 @@ func TestContainer_NewInstance_InstancesAreIsolated(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	a, err := testContainer.NewInstance(ctx)
+	a, err := brrr.Default().NewInstance(ctx)
 	if err != nil {
 		t.Fatalf("NewInstance a: %v", err)
 	}
-	t.Cleanup(func() { _ = testContainer.CloseInstance(context.Background(), a) })
+	t.Cleanup(func() { _ = brrr.Default().CloseInstance(context.Background(), a) })
 
-	b, err := testContainer.NewInstance(ctx)
+	b, err := brrr.Default().NewInstance(ctx)
 	if err != nil {
 		t.Fatalf("NewInstance b: %v", err)
 	}
-	t.Cleanup(func() { _ = testContainer.CloseInstance(context.Background(), b) })
+	t.Cleanup(func() { _ = brrr.Default().CloseInstance(context.Background(), b) })
 
 	if a.Name == b.Name {
 		t.Fatalf("expected distinct instance names, both were %q", a.Name)
@@ -100,3 +129,1039 @@ func TestContainer_NewInstance_InstancesAreIsolated(t *testing.T) {
 		t.Fatal("expected isolation_probe to not exist on instance b; template contamination")
 	}
 }
+
+func TestContainer_Healthy(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := brrr.Default().Healthy(ctx); err != nil {
+		t.Fatalf("Healthy: %v", err)
+	}
+}
+
+func TestDatabaseInstance_ConnectionInfo(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	di, err := brrr.Default().NewInstance(ctx)
+	if err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+	t.Cleanup(func() { _ = brrr.Default().CloseInstance(context.Background(), di) })
+
+	info := di.ConnectionInfo()
+	if info.Database != di.Name {
+		t.Fatalf("expected database %q, got %q", di.Name, info.Database)
+	}
+	if info.Host == "" || info.Port == 0 {
+		t.Fatalf("expected a host address, got %s:%d", info.Host, info.Port)
+	}
+	if info.InternalIP == "" || info.InternalPort != 5432 {
+		t.Fatalf("expected an internal address, got %s:%d", info.InternalIP, info.InternalPort)
+	}
+}
+
+func TestContainer_DefaultCredentials(t *testing.T) {
+	// The container of TestMain is started without User and Password.
+	info := brrr.Default().ConnectionInfo()
+	if !strings.HasPrefix(info.User, "brrr_") || info.User == "brrr_" {
+		t.Errorf("expected a generated user, got %q", info.User)
+	}
+	if len(info.Password) != 32 {
+		t.Errorf("expected a generated password of 32 characters, got %q", info.Password)
+	}
+
+	// The generated credentials can log in.
+	info.Database = "postgres"
+	conn, err := pgx.Connect(t.Context(), info.URL())
+	if err != nil {
+		t.Fatalf("connect with the generated credentials: %v", err)
+	}
+	conn.Close(context.Background())
+}
+
+func TestContainer_Report(t *testing.T) {
+	r := brrr.Default().Report()
+	if r.ServerVersion == "" {
+		t.Fatal("expected server version to be reported")
+	}
+	if r.TemplateSize <= 0 {
+		t.Fatalf("expected a positive template size, got %d", r.TemplateSize)
+	}
+	if len(r.Fingerprint) != 64 {
+		t.Fatalf("expected a sha256 fingerprint, got %q", r.Fingerprint)
+	}
+	if _, err := r.JSON(); err != nil {
+		t.Fatalf("JSON: %v", err)
+	}
+}
+
+func TestContainer_Report_Usage(t *testing.T) {
+	c := newContainer(t, sharedServer(brrr.Config{Database: "brrr_usage", SeedPath: "testdata/seed"}))
+
+	ctx := context.Background()
+	di, err := c.NewInstance(ctx)
+	if err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+	leaked, err := c.NewInstance(ctx)
+	if err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+	if err := c.CloseInstance(ctx, di); err != nil {
+		t.Fatalf("CloseInstance: %v", err)
+	}
+
+	u := c.Report().Usage
+	if u.InstancesCreated != 2 || u.InstancesDropped != 1 {
+		t.Errorf("expected 2 instances created and 1 dropped, got %d and %d", u.InstancesCreated, u.InstancesDropped)
+	}
+	if len(u.Leaked) != 1 || !strings.HasPrefix(u.Leaked[0], leaked.Name) || !strings.Contains(u.Leaked[0], "container_test.go") {
+		t.Errorf("expected %s created in container_test.go to be leaked, got %v", leaked.Name, u.Leaked)
+	}
+	if u.AverageClone <= 0 || u.SlowestSeed == nil || u.Lifetime < u.AverageClone {
+		t.Errorf("expected clone, seed and lifetime durations, got %+v", u)
+	}
+}
+
+func TestConfig_FailOnLeak(t *testing.T) {
+	// Closing the container is part of the test, so it is not started with newContainer.
+	c, err := brrr.NewContainer(sharedServer(brrr.Config{Database: "brrr_leak", FailOnLeak: true}))
+	if err != nil {
+		t.Fatalf("NewContainer: %v", err)
+	}
+
+	t.Run("closed", func(t *testing.T) {
+		di := c.Instance(t)
+		leaked := c.Report().Usage.Leaked
+		if len(leaked) != 1 || !strings.HasPrefix(leaked[0], di.Name) || !strings.Contains(leaked[0], "TestConfig_FailOnLeak/closed") {
+			t.Errorf("expected %s to be tracked with its test, got %v", di.Name, leaked)
+		}
+	})
+	di, err := c.NewInstance(context.Background())
+	if err != nil {
+		c.Close()
+		t.Fatalf("NewInstance: %v", err)
+	}
+
+	var leakErr *brrr.LeakError
+	if err := c.Close(); !errors.As(err, &leakErr) {
+		t.Fatalf("expected a LeakError, got %v", err)
+	}
+	if len(leakErr.Instances) != 1 || !strings.HasPrefix(leakErr.Instances[0], di.Name) || !strings.Contains(leakErr.Instances[0], "container_test.go") {
+		t.Errorf("expected only %s created in container_test.go to be leaked, got %v", di.Name, leakErr.Instances)
+	}
+}
+
+func TestConfig_ServerParams(t *testing.T) {
+	c := newContainer(t, brrr.Config{
+		Database:     "brrr_params",
+		FastProfile:  true,
+		ServerParams: map[string]string{"log_statement": "all", "fsync": "on"},
+	})
+
+	di := c.Instance(t)
+	// ServerParams take precedence over FastProfile.
+	want := map[string]string{
+		"log_statement":      "all",
+		"fsync":              "on",
+		"synchronous_commit": "off",
+		"full_page_writes":   "off",
+		"autovacuum":         "off",
+	}
+	for setting, want := range want {
+		var value string
+		if err := di.Connection.QueryRow(context.Background(), "SELECT current_setting($1)", setting).Scan(&value); err != nil {
+			t.Fatalf("current_setting(%s): %v", setting, err)
+		}
+		if value != want {
+			t.Errorf("expected %s to be %s, got %s", setting, want, value)
+		}
+	}
+}
+
+func TestConfig_PostgresConf(t *testing.T) {
+	c := newContainer(t, brrr.Config{
+		Database:       "brrr_conf",
+		PostgresConf:   "testdata/postgresql.conf",
+		MaxConnections: 50,
+	})
+
+	ctx := context.Background()
+	di := c.Instance(t)
+	// max_connections is set by brrr, which takes precedence over the file.
+	for setting, want := range map[string]string{"work_mem": "7MB", "statement_timeout": "90s", "max_connections": "50"} {
+		var value string
+		if err := di.Connection.QueryRow(ctx, "SELECT current_setting($1)", setting).Scan(&value); err != nil {
+			t.Fatalf("current_setting(%s): %v", setting, err)
+		}
+		if value != want {
+			t.Errorf("expected %s to be %s, got %s", setting, want, value)
+		}
+	}
+}
+
+func TestConfig_FreezeTemplate(t *testing.T) {
+	c := newContainer(t, sharedServer(brrr.Config{
+		Database:       "brrr_freeze",
+		FreezeTemplate: true,
+		SeedFS: fstest.MapFS{
+			"01_schema.sql": {Data: []byte("CREATE TABLE items (id int PRIMARY KEY);")},
+			"02_items.sql":  {Data: []byte("INSERT INTO items SELECT generate_series(1, 100);")},
+		},
+	}))
+
+	// The catalog of the template, vacuumed and analyzed after seeding, is cloned into the instance.
+	di := c.Instance(t)
+	var tuples float32
+	var frozen bool
+	err := di.Connection.QueryRow(context.Background(), `
+		SELECT c.reltuples, age(c.relfrozenxid) < (SELECT max(age(xmin)) FROM items)
+		FROM pg_class c WHERE c.relname = 'items'`).Scan(&tuples, &frozen)
+	if err != nil {
+		t.Fatalf("look up items: %v", err)
+	}
+	if tuples != 100 {
+		t.Errorf("expected the template to be analyzed with 100 rows, got %v", tuples)
+	}
+	if !frozen {
+		t.Error("expected the rows of the template to be frozen")
+	}
+}
+
+func TestConfig_Extensions(t *testing.T) {
+	c := newContainer(t, sharedServer(brrr.Config{
+		Database:   "brrr_extensions",
+		Extensions: []string{"uuid-ossp", "citext", "earthdistance"},
+		SeedFuncCtx: func(ctx context.Context, conn *pgx.Conn, _ string) error {
+			_, err := conn.Exec(ctx, `CREATE TABLE users (id uuid PRIMARY KEY DEFAULT uuid_generate_v4(), email citext)`)
+			return err
+		},
+	}))
+
+	di := c.Instance(t)
+	var extensions []string
+	err := di.Connection.QueryRow(context.Background(), "SELECT array_agg(extname ORDER BY extname) FROM pg_extension WHERE extname <> 'plpgsql'").Scan(&extensions)
+	if err != nil {
+		t.Fatalf("list extensions: %v", err)
+	}
+	// earthdistance depends on cube, which is created along with it.
+	if want := []string{"citext", "cube", "earthdistance", "uuid-ossp"}; !slices.Equal(extensions, want) {
+		t.Errorf("expected extensions %v, got %v", want, extensions)
+	}
+}
+
+func TestConfig_Locale(t *testing.T) {
+	c := newContainer(t, brrr.Config{
+		Database:  "brrr_locale",
+		Locale:    "en_US.UTF-8",
+		Encoding:  "UTF8",
+		Collation: "C",
+	})
+
+	ctx := context.Background()
+	checkLocale := func(t *testing.T) {
+		di := c.Instance(t)
+		var encoding, collate, ctype string
+		err := di.Connection.QueryRow(ctx, `
+			SELECT pg_encoding_to_char(encoding), datcollate, datctype FROM pg_database WHERE datname = current_database()`,
+		).Scan(&encoding, &collate, &ctype)
+		if err != nil {
+			t.Fatalf("query database: %v", err)
+		}
+		if encoding != "UTF8" || collate != "C" || ctype != "en_US.UTF-8" {
+			t.Errorf("expected UTF8, C and en_US.UTF-8, got %s, %s and %s", encoding, collate, ctype)
+		}
+
+		var sorted []string
+		if err := di.Connection.QueryRow(ctx, "SELECT array_agg(s ORDER BY s) FROM unnest(ARRAY['b', 'B', 'a']) s").Scan(&sorted); err != nil {
+			t.Fatalf("sort: %v", err)
+		}
+		if want := []string{"B", "a", "b"}; !slices.Equal(sorted, want) {
+			t.Errorf("expected C collation to sort as %v, got %v", want, sorted)
+		}
+	}
+	t.Run("initdb", checkLocale)
+
+	// RefreshTemplate creates the template with CREATE DATABASE instead of initdb.
+	if err := c.RefreshTemplate(ctx); err != nil {
+		t.Fatalf("RefreshTemplate: %v", err)
+	}
+	t.Run("refresh", checkLocale)
+}
+
+func TestConfig_Timezone(t *testing.T) {
+	c := newContainer(t, brrr.Config{
+		Database: "brrr_timezone",
+		Timezone: "Asia/Kolkata",
+	})
+
+	di := c.Instance(t)
+	ctx := context.Background()
+	var timezone, date string
+	err := di.Connection.QueryRow(ctx, "SELECT current_setting('timezone'), '2024-01-01 20:00:00+00'::timestamptz::date::text").Scan(&timezone, &date)
+	if err != nil {
+		t.Fatalf("query timezone: %v", err)
+	}
+	if timezone != "Asia/Kolkata" || date != "2024-01-02" {
+		t.Errorf("expected Asia/Kolkata and the next day, got %s and %s", timezone, date)
+	}
+
+	// Connections made by the code under test use the server's timezone.
+	conn, err := pgx.Connect(ctx, di.URL())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer conn.Close(ctx)
+	if err := conn.QueryRow(ctx, "SELECT current_setting('timezone')").Scan(&timezone); err != nil {
+		t.Fatalf("query timezone: %v", err)
+	}
+	if timezone != "Asia/Kolkata" {
+		t.Errorf("expected the server timezone to be Asia/Kolkata, got %s", timezone)
+	}
+}
+
+func TestConfig_WaitFor(t *testing.T) {
+	c := newContainer(t, brrr.Config{
+		Database: "brrr_wait",
+		WaitFor: wait.ForAll(
+			wait.ForLog("database system is ready to accept connections").WithOccurrence(2),
+			wait.ForListeningPort("5432/tcp"),
+		).WithDeadline(time.Minute),
+	})
+
+	c.Instance(t)
+}
+
+func TestConfig_OnProgress(t *testing.T) {
+	var stages []string
+	newContainer(t, sharedServer(brrr.Config{
+		Database:       "brrr_progress",
+		MigrationsPath: "testdata/migrations",
+		SeedPath:       "testdata/seed",
+		SeedFuncCtx: func(context.Context, *pgx.Conn, string) error {
+			return nil
+		},
+		OnProgress: func(stage string, detail string, elapsed time.Duration) {
+			if elapsed < 0 {
+				t.Errorf("negative duration %s reported for %s", elapsed, stage)
+			}
+			stages = append(stages, stage+" "+detail)
+		},
+	}))
+
+	want := []string{
+		brrr.StageMigration + " 1",
+		brrr.StageMigration + " 2",
+		brrr.StageSeed + " 01_schema.sql",
+		brrr.StageSeed + " 02_dump.sql",
+		brrr.StageSeed + " 03_atomic.sql",
+		brrr.StageSeedFunc + " ",
+		brrr.StageTemplate + " brrr_progress",
+	}
+	if !slices.Equal(stages, want) {
+		t.Errorf("expected the stages\n%q\ngot\n%q", want, stages)
+	}
+}
+
+func TestConfig_StartupRetries(t *testing.T) {
+	var starts atomic.Int32
+	c, err := brrr.NewContainer(brrr.Config{
+		Database:       "brrr_startup",
+		StartupTimeout: time.Millisecond,
+		StartupRetries: 1,
+		OnProgress: func(stage string, _ string, _ time.Duration) {
+			if stage == brrr.StageImagePull {
+				starts.Add(1)
+			}
+		},
+	})
+	if err == nil {
+		c.Close()
+		t.Fatal("NewContainer succeeded although the server can't start within a millisecond")
+	}
+	if !errors.Is(err, brrr.ErrContainerStartTimeout) {
+		t.Errorf("got %v, want ErrContainerStartTimeout", err)
+	}
+	if n := starts.Load(); n != 2 {
+		t.Errorf("expected the container to be started twice, got %d", n)
+	}
+}
+
+func TestConfig_RegistryMirror(t *testing.T) {
+	c := newContainer(t, brrr.Config{
+		Database:       "brrr_mirror",
+		RegistryMirror: "docker.io/library",
+	})
+
+	if image := c.Report().Image; image != "docker.io/library/postgres:17.2" {
+		t.Errorf("expected the image to be pulled through the mirror, got %s", image)
+	}
+}
+
+func TestConfig_PullPolicy_Never(t *testing.T) {
+	// The image of the container of TestMain is present.
+	newContainer(t, brrr.Config{
+		Database:   "brrr_pull",
+		PullPolicy: brrr.PullNever,
+	})
+
+	missing, err := brrr.NewContainer(brrr.Config{
+		Database:   "brrr_pull",
+		Image:      "postgres:brrr-missing",
+		PullPolicy: brrr.PullNever,
+	})
+	if err == nil {
+		missing.Close()
+		t.Fatal("NewContainer succeeded with an image which is not present")
+	}
+	if !strings.Contains(err.Error(), "not present") {
+		t.Errorf("expected an error about the missing image, got %v", err)
+	}
+}
+
+func TestConfig_HostPort(t *testing.T) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("find free port: %v", err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	c := newContainer(t, brrr.Config{
+		Database: "brrr_host_port",
+		HostPort: port,
+	})
+
+	if got := c.ConnectionInfo().Port; got != port {
+		t.Errorf("expected the server on port %d, got %d", port, got)
+	}
+	di := c.Instance(t)
+	if err := di.Connection.Ping(context.Background()); err != nil {
+		t.Errorf("ping: %v", err)
+	}
+}
+
+func TestConfig_HostNetwork(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("host networking requires a linux docker host")
+	}
+
+	c := newContainer(t, brrr.Config{
+		Database:    "brrr_host_network",
+		HostNetwork: true,
+	})
+
+	di := c.Instance(t)
+	ctx := context.Background()
+	var port string
+	if err := di.Connection.QueryRow(ctx, "SELECT current_setting('port')").Scan(&port); err != nil {
+		t.Fatalf("query port: %v", err)
+	}
+	if want := strconv.Itoa(c.ConnectionInfo().Port); port != want {
+		t.Errorf("expected the server to listen on port %s of the host, got %s", want, port)
+	}
+}
+
+func TestConfig_Network(t *testing.T) {
+	ctx := context.Background()
+	nw, err := network.New(ctx)
+	if err != nil {
+		t.Fatalf("create network: %v", err)
+	}
+	t.Cleanup(func() { _ = nw.Remove(context.Background()) })
+
+	c := newContainer(t, brrr.Config{
+		Database:       "brrr_network",
+		Network:        nw.Name,
+		NetworkAliases: []string{"db"},
+	})
+
+	info := c.ConnectionInfo()
+	if !slices.Contains(info.Aliases[nw.Name], "db") {
+		t.Errorf("expected alias db in network %s, got %v", nw.Name, info.Aliases)
+	}
+	if info.InternalIP == "" {
+		t.Error("expected the address of the server in the network")
+	}
+	if err := c.Instance(t).Connection.Ping(ctx); err != nil {
+		t.Errorf("ping: %v", err)
+	}
+}
+
+func TestConfig_Labels(t *testing.T) {
+	ctx := context.Background()
+	run := strconv.FormatInt(time.Now().UnixNano(), 36)
+	newContainer(t, brrr.Config{
+		Database: "brrr_labels",
+		Labels:   map[string]string{"brrr.test.run": run},
+	})
+
+	cli, err := testcontainers.NewDockerClientWithOpts(ctx)
+	if err != nil {
+		t.Fatalf("docker client: %v", err)
+	}
+	defer cli.Close()
+	list, err := cli.ContainerList(ctx, client.ContainerListOptions{
+		Filters: make(client.Filters).Add("label", "brrr=true", "brrr.test.run="+run),
+	})
+	if err != nil {
+		t.Fatalf("list containers: %v", err)
+	}
+	if len(list.Items) != 1 {
+		t.Errorf("expected one container labeled with the run, got %d", len(list.Items))
+	}
+}
+
+func TestConfig_ResourceLimits(t *testing.T) {
+	c := newContainer(t, brrr.Config{
+		Database:    "brrr_resources",
+		MemoryLimit: 512 << 20,
+		CPULimit:    1,
+		ShmSize:     256 << 20,
+	})
+
+	di := c.Instance(t)
+	ctx := context.Background()
+	if _, err := di.Connection.Exec(ctx, "CREATE TEMP TABLE shm (size bigint)"); err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+	if _, err := di.Connection.Exec(ctx, "COPY shm FROM PROGRAM 'df --output=size -B1 /dev/shm | tail -n 1'"); err != nil {
+		t.Fatalf("read size of /dev/shm: %v", err)
+	}
+	var size int64
+	if err := di.Connection.QueryRow(ctx, "SELECT size FROM shm").Scan(&size); err != nil {
+		t.Fatalf("query size: %v", err)
+	}
+	if size != 256<<20 {
+		t.Errorf("expected a 256MB /dev/shm, got %d bytes", size)
+	}
+}
+
+func TestConfig_ContainerName(t *testing.T) {
+	ctx := context.Background()
+	name := "brrr-test-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	newContainer(t, brrr.Config{
+		Database:      "brrr_container_name",
+		ContainerName: name,
+	})
+
+	cli, err := testcontainers.NewDockerClientWithOpts(ctx)
+	if err != nil {
+		t.Fatalf("docker client: %v", err)
+	}
+	defer cli.Close()
+	res, err := cli.ContainerInspect(ctx, name, client.ContainerInspectOptions{})
+	if err != nil {
+		t.Fatalf("inspect container %s: %v", name, err)
+	}
+	if res.Container.State == nil || !res.Container.State.Running {
+		t.Errorf("expected container %s to be running", name)
+	}
+}
+
+// logBuffer is a buffer written by the log goroutine and read by the test.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestConfig_LogOutput(t *testing.T) {
+	var logs logBuffer
+	c := newContainer(t, brrr.Config{
+		Database:  "brrr_log_output",
+		LogOutput: &logs,
+	})
+
+	// Errors of the tests are logged by the server.
+	di := c.Instance(t)
+	_, _ = di.Connection.Exec(context.Background(), "SELECT * FROM brrr_missing_table")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(logs.String(), "brrr_missing_table") {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the server log to contain the failed query, got:\n%s", logs.String())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestContainer_NewInstance_DropsOnFailure(t *testing.T) {
+	// Connecting to the instance can't succeed within the deadline, after its database and role were created.
+	c := newContainer(t, sharedServer(brrr.Config{
+		Database:          "brrr_instance_failure",
+		UniqueCredentials: true,
+		ConnectDeadline:   time.Nanosecond,
+	}))
+
+	ctx := context.Background()
+	if _, err := c.NewInstance(ctx); err == nil {
+		t.Fatal("NewInstance succeeded without being able to connect")
+	}
+
+	info := c.ConnectionInfo()
+	info.Database = "postgres"
+	conn, err := pgx.Connect(ctx, info.URL())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer conn.Close(ctx)
+
+	var databases, roles int
+	err = conn.QueryRow(ctx, `
+		SELECT (SELECT count(*) FROM pg_database WHERE datname LIKE 'brrr\_instance\_failure\_%'),
+		       (SELECT count(*) FROM pg_roles WHERE rolname LIKE 'brrr\_instance\_failure\_%')`).Scan(&databases, &roles)
+	if err != nil {
+		t.Fatalf("look up instances: %v", err)
+	}
+	if databases != 0 || roles != 0 {
+		t.Errorf("%d databases and %d roles left behind by the failed instance", databases, roles)
+	}
+}
+
+func TestConfig_Backend_NotRegistered(t *testing.T) {
+	// The backend packages are not imported by the tests of the core package.
+	c, err := brrr.NewContainer(brrr.Config{
+		Database: "brrr_not_registered",
+		Backend:  brrr.Kubernetes,
+	})
+	if err == nil {
+		c.Close()
+		t.Fatal("NewContainer succeeded with a backend which is not registered")
+	}
+	if !strings.Contains(err.Error(), "github.com/modfin/brrr/kubernetes") {
+		t.Errorf("expected an error naming the package registering the backend, got %v", err)
+	}
+}
+
+func TestContainer_NewInstance_WithOwner(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	setup, err := brrr.Default().NewInstance(ctx)
+	if err != nil {
+		t.Fatalf("NewInstance setup: %v", err)
+	}
+	t.Cleanup(func() { _ = brrr.Default().CloseInstance(context.Background(), setup) })
+
+	// Roles are cluster wide, so any instance can create the owner.
+	_, err = setup.Connection.Exec(ctx, "DO $$ BEGIN CREATE ROLE brrr_owner; EXCEPTION WHEN duplicate_object THEN NULL; END $$")
+	if err != nil {
+		t.Fatalf("create role: %v", err)
+	}
+
+	di, err := brrr.Default().NewInstance(ctx, brrr.WithOwner("brrr_owner"), brrr.WithEncoding("UTF8"))
+	if err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+	t.Cleanup(func() { _ = brrr.Default().CloseInstance(context.Background(), di) })
+
+	var owner string
+	err = di.Connection.QueryRow(ctx, "SELECT pg_get_userbyid(datdba) FROM pg_database WHERE datname = current_database()").Scan(&owner)
+	if err != nil {
+		t.Fatalf("lookup owner: %v", err)
+	}
+	if owner != "brrr_owner" {
+		t.Fatalf("expected owner brrr_owner, got %q", owner)
+	}
+}
+
+func TestContainer_NewInstance_WithUniqueCredentials(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	di, err := brrr.Default().NewInstance(ctx, brrr.WithUniqueCredentials())
+	if err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+	t.Cleanup(func() { _ = brrr.Default().CloseInstance(context.Background(), di) })
+
+	info := di.ConnectionInfo()
+	if info.User != di.Name || info.Password == "" {
+		t.Fatalf("expected a dedicated role named %q, got user %q", di.Name, info.User)
+	}
+
+	var user string
+	if err := di.Connection.QueryRow(ctx, "SELECT current_user").Scan(&user); err != nil {
+		t.Fatalf("lookup current user: %v", err)
+	}
+	if user != di.Name {
+		t.Fatalf("expected connection as %q, got %q", di.Name, user)
+	}
+}
+
+func TestContainer_NewInstance_WithTxIsoLevel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	di, err := brrr.Default().NewInstance(ctx, brrr.WithTxIsoLevel(pgx.Serializable))
+	if err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+	t.Cleanup(func() { _ = brrr.Default().CloseInstance(context.Background(), di) })
+
+	var level string
+	if err := di.Connection.QueryRow(ctx, "SHOW default_transaction_isolation").Scan(&level); err != nil {
+		t.Fatalf("show isolation level: %v", err)
+	}
+	if level != "serializable" {
+		t.Fatalf("expected serializable, got %q", level)
+	}
+}
+
+func TestContainer_NewInstance_WithConnectionLimit(t *testing.T) {
+	ctx := context.Background()
+
+	// The limit only applies to regular roles, and the connection of the instance counts towards it.
+	di := brrr.Default().Instance(t, brrr.WithUniqueCredentials(), brrr.WithConnectionLimit(2))
+	conn, err := pgx.Connect(ctx, di.URL())
+	if err != nil {
+		t.Fatalf("connect within the limit: %v", err)
+	}
+	defer conn.Close(ctx)
+	if extra, err := pgx.Connect(ctx, di.URL()); err == nil {
+		extra.Close(ctx)
+		t.Fatal("connected beyond the connection limit")
+	} else if !strings.Contains(err.Error(), "too many connections") {
+		t.Errorf("expected the connection limit to be exceeded, got %v", err)
+	}
+
+	// Config.InstanceConnectionLimit is the default of every instance.
+	c := newContainer(t, sharedServer(brrr.Config{Database: "brrr_connection_limit", InstanceConnectionLimit: 3}))
+	var limit int
+	err = c.Instance(t).Connection.QueryRow(ctx, "SELECT datconnlimit FROM pg_database WHERE datname = current_database()").Scan(&limit)
+	if err != nil {
+		t.Fatalf("look up connection limit: %v", err)
+	}
+	if limit != 3 {
+		t.Errorf("expected a connection limit of 3, got %d", limit)
+	}
+}
+
+type countingTracer struct{ queries atomic.Int32 }
+
+func (ct *countingTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	ct.queries.Add(1)
+	return ctx
+}
+
+func (ct *countingTracer) TraceQueryEnd(context.Context, *pgx.Conn, pgx.TraceQueryEndData) {}
+
+func TestContainer_NewInstance_WithTracer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tracer := &countingTracer{}
+	di, err := brrr.Default().NewInstance(ctx, brrr.WithTracer(tracer))
+	if err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+	t.Cleanup(func() { _ = brrr.Default().CloseInstance(context.Background(), di) })
+
+	if _, err := di.Connection.Exec(ctx, "SELECT 1"); err != nil {
+		t.Fatalf("SELECT 1: %v", err)
+	}
+	if n := tracer.queries.Load(); n != 1 {
+		t.Fatalf("expected 1 traced query, got %d", n)
+	}
+}
+
+func TestContainer_Instance(t *testing.T) {
+	var name string
+	t.Run("instance", func(t *testing.T) {
+		di := brrr.Default().Instance(t)
+		name = di.Name
+		if _, err := di.Connection.Exec(t.Context(), "SELECT 1"); err != nil {
+			t.Fatalf("SELECT 1: %v", err)
+		}
+	})
+
+	di := brrr.Default().Instance(t)
+	var exists bool
+	if err := di.Connection.QueryRow(t.Context(), "SELECT EXISTS (SELECT FROM pg_database WHERE datname = $1)", name).Scan(&exists); err != nil {
+		t.Fatalf("look up database: %v", err)
+	}
+	if exists {
+		t.Fatalf("database %s was not dropped when its test completed", name)
+	}
+}
+
+func TestShared(t *testing.T) {
+	cfg := sharedServer(brrr.Config{Database: "brrr_shared"})
+
+	var wg sync.WaitGroup
+	containers := make([]*brrr.Container, 4)
+	for i := range containers {
+		wg.Go(func() {
+			c, err := brrr.Shared(cfg)
+			if err != nil {
+				t.Errorf("Shared: %v", err)
+			}
+			containers[i] = c
+		})
+	}
+	wg.Wait()
+	t.Cleanup(func() { _ = brrr.CloseShared() })
+
+	for _, c := range containers[1:] {
+		if c != containers[0] {
+			t.Fatal("Shared returned different containers")
+		}
+	}
+
+	// CloseShared resets the shared container, so it is started again.
+	if err := brrr.CloseShared(); err != nil {
+		t.Fatalf("CloseShared: %v", err)
+	}
+	c, err := brrr.Shared(cfg)
+	if err != nil {
+		t.Fatalf("Shared: %v", err)
+	}
+	if c == containers[0] {
+		t.Fatal("Shared returned the closed container")
+	}
+	if err := c.Healthy(t.Context()); err != nil {
+		t.Errorf("Healthy: %v", err)
+	}
+}
+
+func TestDatabaseInstance_DB(t *testing.T) {
+	di := brrr.Default().Instance(t)
+
+	if _, err := di.Connection.Exec(t.Context(), "CREATE TABLE shared (id int)"); err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+
+	var count int
+	if err := di.DB().QueryRowContext(t.Context(), "SELECT count(*) FROM shared").Scan(&count); err != nil {
+		t.Fatalf("query through database/sql: %v", err)
+	}
+	if di.DB() != di.DB() {
+		t.Fatal("expected DB to return the same handle")
+	}
+}
+
+func TestContainer_NewInstance_WithPool(t *testing.T) {
+	di := brrr.Default().Instance(t, brrr.WithPool(4))
+	if di.Pool == nil {
+		t.Fatal("expected a pool")
+	}
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Go(func() {
+			if _, err := di.Pool.Exec(t.Context(), "SELECT pg_sleep(0.1)"); err != nil {
+				t.Errorf("concurrent query: %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if got := di.Pool.Stat().MaxConns(); got != 4 {
+		t.Fatalf("expected 4 max connections, got %d", got)
+	}
+}
+
+func TestDatabaseInstance_URLAndDSN(t *testing.T) {
+	di := brrr.Default().Instance(t)
+
+	for _, connStr := range []string{di.URL(), di.DSN()} {
+		conn, err := pgx.Connect(t.Context(), connStr)
+		if err != nil {
+			t.Fatalf("connect with %q: %v", connStr, err)
+		}
+		var database string
+		err = conn.QueryRow(t.Context(), "SELECT current_database()").Scan(&database)
+		_ = conn.Close(context.Background())
+		if err != nil {
+			t.Fatalf("lookup database: %v", err)
+		}
+		if database != di.Name {
+			t.Fatalf("expected database %q, got %q", di.Name, database)
+		}
+	}
+}
+
+func TestDatabaseInstance_Close(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	di, err := brrr.Default().NewInstance(ctx)
+	if err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+	if err := di.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	info := brrr.Default().ConnectionInfo()
+	info.Database = "postgres"
+	conn, err := pgx.Connect(ctx, info.URL())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer conn.Close(context.Background())
+
+	var exists bool
+	if err := conn.QueryRow(ctx, "SELECT EXISTS (SELECT FROM pg_database WHERE datname = $1)", di.Name).Scan(&exists); err != nil {
+		t.Fatalf("look up database: %v", err)
+	}
+	if exists {
+		t.Fatalf("database %s was not dropped", di.Name)
+	}
+}
+
+func TestDatabaseInstance_Reset(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	di := brrr.Default().Instance(t, brrr.WithPool(2))
+	dsn := di.DSN()
+	db := di.DB()
+
+	if _, err := di.Connection.Exec(ctx, "CREATE TABLE reset_me (id int)"); err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+
+	if err := di.Reset(ctx); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	if di.DSN() != dsn {
+		t.Errorf("DSN changed from %q to %q", dsn, di.DSN())
+	}
+
+	for name, query := range map[string]func(string) error{
+		"Connection": func(q string) error { _, err := di.Connection.Exec(ctx, q); return err },
+		"Pool":       func(q string) error { _, err := di.Pool.Exec(ctx, q); return err },
+		"DB":         func(q string) error { _, err := db.ExecContext(ctx, q); return err },
+	} {
+		if err := query("SELECT 1"); err != nil {
+			t.Errorf("%s: query after Reset: %v", name, err)
+		}
+		if err := query("SELECT FROM reset_me"); err == nil {
+			t.Errorf("%s: table created before Reset still exists", name)
+		}
+	}
+}
+
+func TestContainer_NewInstance_Concurrent(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for range 16 {
+		wg.Go(func() {
+			di, err := brrr.Default().NewInstance(ctx)
+			if err != nil {
+				errs <- err
+				return
+			}
+			errs <- brrr.Default().CloseInstance(ctx, di)
+		})
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestContainer_WaitForIdle(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	di, err := brrr.Default().NewInstance(ctx)
+	if err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+	t.Cleanup(func() { _ = brrr.Default().CloseInstance(context.Background(), di) })
+
+	// The instance connection belongs to brrr and must not keep the container busy.
+	if err := brrr.Default().WaitForIdle(ctx); err != nil {
+		t.Fatalf("WaitForIdle: %v", err)
+	}
+}
+
+func TestNewContainer_QuotedDatabaseName(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	c := newContainer(t, sharedServer(brrr.Config{Database: "Brrr-Select"}))
+
+	di, err := c.NewInstance(ctx)
+	if err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+	if !strings.HasPrefix(di.Name, "Brrr-Select_") {
+		t.Errorf("instance name %q does not keep the template name as is", di.Name)
+	}
+	if err := c.CloseInstance(ctx, di); err != nil {
+		t.Fatalf("CloseInstance: %v", err)
+	}
+}
+
+func TestNewContainer_InvalidDatabaseName(t *testing.T) {
+	for _, name := range []string{"", strings.Repeat("a", 31)} {
+		c, err := brrr.NewContainer(brrr.Config{Database: name})
+		if err == nil {
+			c.Close()
+			t.Errorf("NewContainer succeeded with database name %q", name)
+		}
+	}
+}
+
+func TestContainer_CloseInstance_NotFound(t *testing.T) {
+	ctx := context.Background()
+	di, err := brrr.Default().NewInstance(ctx)
+	if err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+	if err := brrr.Default().CloseInstance(ctx, di); err != nil {
+		t.Fatalf("CloseInstance: %v", err)
+	}
+	if err := brrr.Default().CloseInstance(ctx, di); !errors.Is(err, brrr.ErrInstanceNotFound) {
+		t.Errorf("got %v closing an instance twice, want ErrInstanceNotFound", err)
+	}
+}
+
+func TestContainer_NewInstance_TemplateBusy(t *testing.T) {
+	c := newContainer(t, sharedServer(brrr.Config{Database: "brrr_busy"}))
+
+	// A session connected to the template, e.g. of a database tool, keeps it from being cloned.
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, c.ConnectionInfo().URL())
+	if err != nil {
+		t.Fatalf("connect to template: %v", err)
+	}
+	defer conn.Close(ctx)
+
+	if di, err := c.NewInstance(ctx); !errors.Is(err, brrr.ErrTemplateBusy) {
+		if err == nil {
+			_ = c.CloseInstance(ctx, di)
+		}
+		t.Fatalf("got %v cloning a template in use, want ErrTemplateBusy", err)
+	}
+
+	// Cloning succeeds once the session is gone.
+	conn.Close(ctx)
+	c.Instance(t)
+}
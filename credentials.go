@@ -0,0 +1,82 @@
+package brrr
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// createInstanceRole creates a login role named after the instance database, with privileges on everything in it.
+// Connecting to the database is revoked from PUBLIC, so only the role and superusers can connect.
+func createInstanceRole(ctx context.Context, cfg Config, admin *pgxpool.Conn, name string) (string, error) {
+	password, err := randomSecret()
+	if err != nil {
+		return "", err
+	}
+
+	// The role and the database share the name.
+	ident := pgx.Identifier{name}.Sanitize()
+	if _, err := admin.Exec(ctx, fmt.Sprintf("CREATE ROLE %s LOGIN PASSWORD %s", ident, quoteLiteral(password))); err != nil {
+		return "", fmt.Errorf("failed to create instance role: %w", err)
+	}
+	if err := grantInstanceRole(ctx, cfg, admin, name); err != nil {
+		return "", err
+	}
+	return password, nil
+}
+
+// grantInstanceRole grants the role created by createInstanceRole its privileges on the database of the same name.
+func grantInstanceRole(ctx context.Context, cfg Config, admin *pgxpool.Conn, name string) error {
+	ident := pgx.Identifier{name}.Sanitize()
+	for _, stmt := range []string{
+		fmt.Sprintf("REVOKE CONNECT, TEMPORARY ON DATABASE %s FROM PUBLIC", ident),
+		fmt.Sprintf("GRANT CONNECT, TEMPORARY, CREATE ON DATABASE %s TO %s", ident, ident),
+	} {
+		if _, err := admin.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to grant privileges to instance role: %w", err)
+		}
+	}
+
+	// Objects cloned from the template are owned by the template's owner, so the role is granted access to them.
+	conn, err := pgx.Connect(ctx, cfg.url("postgres", name))
+	if err != nil {
+		return fmt.Errorf("failed to connect to instance database: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	_, err = conn.Exec(ctx, fmt.Sprintf(`DO $$
+DECLARE s text;
+BEGIN
+	FOR s IN SELECT nspname FROM pg_namespace WHERE nspname NOT LIKE 'pg\_%%' AND nspname <> 'information_schema' LOOP
+		EXECUTE format('GRANT USAGE, CREATE ON SCHEMA %%I TO %%I', s, %[1]s);
+		EXECUTE format('GRANT ALL ON ALL TABLES IN SCHEMA %%I TO %%I', s, %[1]s);
+		EXECUTE format('GRANT ALL ON ALL SEQUENCES IN SCHEMA %%I TO %%I', s, %[1]s);
+		EXECUTE format('GRANT ALL ON ALL ROUTINES IN SCHEMA %%I TO %%I', s, %[1]s);
+	END LOOP;
+END $$`, quoteLiteral(name)))
+	if err != nil {
+		return fmt.Errorf("failed to grant privileges to instance role: %w", err)
+	}
+	return nil
+}
+
+// dropInstanceRole drops the role created by createInstanceRole.
+func dropInstanceRole(ctx context.Context, admin *pgxpool.Conn, name string) error {
+	if _, err := admin.Exec(ctx, fmt.Sprintf("DROP ROLE IF EXISTS %s", pgx.Identifier{name}.Sanitize())); err != nil {
+		return fmt.Errorf("failed to drop instance role: %w", err)
+	}
+	return nil
+}
+
+// randomSecret returns a random hex encoded secret with 128 bits of entropy.
+func randomSecret() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate secret: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,89 @@
+package brrr
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// csvOrderPrefix matches the optional ordering prefix of a CSV file name, e.g. "01_" of "01_users.csv".
+var csvOrderPrefix = regexp.MustCompile(`^[0-9]+_`)
+
+// csvTable returns the table a CSV file is loaded into, which is the file name without its extension and optional
+// ordering prefix, e.g. users for "01_users.csv" and audit.events for "audit.events.csv".
+func csvTable(name string) pgx.Identifier {
+	table := csvOrderPrefix.ReplaceAllString(strings.TrimSuffix(name, path.Ext(name)), "")
+	return pgx.Identifier(strings.Split(table, "."))
+}
+
+// LoadCSV loads the CSV files in the root of fsys into the tables they are named after with COPY, in one
+// transaction. The first line of a file names the columns the following lines are copied into. Files are loaded
+// ordered by file name, so parents can be loaded before their children by prefixing the names with a number, e.g.
+// "01_users.csv" and "02_orders.csv", which is not part of the table name. Tables may be qualified with their
+// schema, e.g. "audit.events.csv".
+//
+// LoadCSV is used for Config.CSVPath and Config.CSVFS, and can load fixtures into an instance through WithSeedFunc.
+func LoadCSV(ctx context.Context, conn *pgx.Conn, fsys fs.FS) error {
+	files, err := fs.Glob(fsys, "*.csv")
+	if err != nil {
+		return fmt.Errorf("failed to read directory: %w", err)
+	}
+	sort.Strings(files)
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	for _, name := range files {
+		if err := copyCSV(ctx, conn, fsys, name); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit CSV fixtures: %w", err)
+	}
+	return nil
+}
+
+// copyCSV copies the CSV file name of fsys into its table, streaming it from the file.
+func copyCSV(ctx context.Context, conn *pgx.Conn, fsys fs.FS, name string) error {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to read file %s: %w", name, err)
+	}
+	defer f.Close()
+
+	// The header is parsed here rather than with the HEADER option of COPY, which only skips it, so the columns may
+	// be in any order and columns with defaults may be left out.
+	r := bufio.NewReader(f)
+	line, err := r.ReadString('\n')
+	if err != nil && line == "" {
+		return fmt.Errorf("failed to read header of %s: %w", name, err)
+	}
+	header, err := csv.NewReader(strings.NewReader(line)).Read()
+	if err != nil {
+		return fmt.Errorf("failed to parse header of %s: %w", name, err)
+	}
+
+	columns := make([]string, len(header))
+	for i, column := range header {
+		columns[i] = pgx.Identifier{strings.TrimSpace(column)}.Sanitize()
+	}
+
+	sql := fmt.Sprintf("COPY %s (%s) FROM STDIN WITH (FORMAT csv)", csvTable(name).Sanitize(), strings.Join(columns, ", "))
+	if _, err := conn.PgConn().CopyFrom(ctx, r, sql); err != nil {
+		return fmt.Errorf("failed to copy %s: %w", name, err)
+	}
+	return nil
+}
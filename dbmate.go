@@ -0,0 +1,192 @@
+package brrr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// dbmateFile matches the names of dbmate migration files, capturing the version.
+var dbmateFile = regexp.MustCompile(`^(\d+)_.*\.sql$`)
+
+// dbmateDirective matches the -- migrate:up and -- migrate:down lines splitting a dbmate migration, capturing the
+// direction and its options.
+var dbmateDirective = regexp.MustCompile(`(?m)^--\s*migrate:(up|down)\b(.*)$`)
+
+// dbmateMigration is a parsed dbmate migration file.
+type dbmateMigration struct {
+	version  string
+	name     string
+	up, down dbmateSection
+}
+
+// dbmateSection is the up or down section of a dbmate migration.
+type dbmateSection struct {
+	sql string
+	// transaction is false when the section is annotated with transaction:false
+	transaction bool
+}
+
+// parseDbmateMigration parses the dbmate migration name with contents data.
+func parseDbmateMigration(name, version, data string) (dbmateMigration, error) {
+	m := dbmateMigration{version: version, name: name}
+
+	var hasUp bool
+	directives := dbmateDirective.FindAllStringSubmatchIndex(data, -1)
+	for i, loc := range directives {
+		end := len(data)
+		if i+1 < len(directives) {
+			end = directives[i+1][0]
+		}
+		section := dbmateSection{sql: data[loc[1]:end], transaction: true}
+		for _, option := range strings.Fields(data[loc[4]:loc[5]]) {
+			if option == "transaction:false" {
+				section.transaction = false
+			}
+		}
+
+		if data[loc[2]:loc[3]] == "up" {
+			m.up, hasUp = section, true
+		} else {
+			m.down = section
+		}
+	}
+	if !hasUp {
+		return m, fmt.Errorf("dbmate migration %s has no -- migrate:up section", name)
+	}
+	return m, nil
+}
+
+// dbmateSteps steps through dbmate migrations, recording them in schema_migrations like dbmate does, so the dbmate
+// CLI sees the database as up to date.
+type dbmateSteps struct {
+	conn       *pgx.Conn
+	migrations []dbmateMigration
+}
+
+func openDbmate(ctx context.Context, cfg Config, fsys fs.FS) (_ *dbmateSteps, err error) {
+	files, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	// Files are applied in name order like dbmate does, which fs.ReadDir returns them in.
+	var migrations []dbmateMigration
+	for _, file := range files {
+		match := dbmateFile.FindStringSubmatch(file.Name())
+		if file.IsDir() || match == nil {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, file.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file %s: %w", file.Name(), err)
+		}
+		m, err := parseDbmateMigration(file.Name(), match[1], string(data))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, m)
+	}
+	if len(migrations) == 0 {
+		return nil, errors.New("no dbmate migrations found")
+	}
+
+	conn, err := pgx.Connect(ctx, cfg.url("postgres", cfg.Database))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	_, err = conn.Exec(ctx, "CREATE TABLE IF NOT EXISTS public.schema_migrations (version varchar(128) PRIMARY KEY)")
+	if err != nil {
+		_ = conn.Close(context.Background())
+		return nil, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return &dbmateSteps{conn: conn, migrations: migrations}, nil
+}
+
+// applied reports whether m is recorded in schema_migrations.
+func (s *dbmateSteps) applied(ctx context.Context, m dbmateMigration) (bool, error) {
+	var applied bool
+	err := s.conn.QueryRow(ctx, "SELECT EXISTS (SELECT FROM public.schema_migrations WHERE version = $1)", m.version).Scan(&applied)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up dbmate migration %s: %w", m.name, err)
+	}
+	return applied, nil
+}
+
+func (s *dbmateSteps) Up(ctx context.Context) (uint64, bool, error) {
+	for _, m := range s.migrations {
+		applied, err := s.applied(ctx, m)
+		if err != nil {
+			return 0, false, err
+		}
+		if applied {
+			continue
+		}
+
+		err = s.exec(ctx, m.name, m.up, "INSERT INTO public.schema_migrations (version) VALUES ($1)", m.version)
+		if err != nil {
+			version, _, _ := dbmateVersion(m)
+			return 0, false, &MigrationError{Version: version, File: m.name, Err: err}
+		}
+		return dbmateVersion(m)
+	}
+	return 0, true, nil
+}
+
+func (s *dbmateSteps) Down(ctx context.Context) (uint64, bool, error) {
+	for i := len(s.migrations) - 1; i >= 0; i-- {
+		m := s.migrations[i]
+		applied, err := s.applied(ctx, m)
+		if err != nil {
+			return 0, false, err
+		}
+		if !applied {
+			continue
+		}
+
+		err = s.exec(ctx, m.name, m.down, "DELETE FROM public.schema_migrations WHERE version = $1", m.version)
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to revert dbmate migration %s: %w", m.name, err)
+		}
+		return dbmateVersion(m)
+	}
+	return 0, true, nil
+}
+
+// exec executes the statements of section one by one followed by the bookkeeping statement record, in one
+// transaction unless the section opts out.
+func (s *dbmateSteps) exec(ctx context.Context, name string, section dbmateSection, record, version string) error {
+	if !section.transaction {
+		if err := executeStatements(ctx, s.conn, name, strings.NewReader(section.sql)); err != nil {
+			return err
+		}
+		_, err := s.conn.Exec(ctx, record, version)
+		return err
+	}
+	return pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		if err := executeStatements(ctx, tx.Conn(), name, strings.NewReader(section.sql)); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, record, version)
+		return err
+	})
+}
+
+// dbmateVersion returns the version of m as a number.
+func dbmateVersion(m dbmateMigration) (uint64, bool, error) {
+	version, err := strconv.ParseUint(m.version, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid dbmate migration version %s: %w", m.version, err)
+	}
+	return version, false, nil
+}
+
+func (s *dbmateSteps) Close() error {
+	return s.conn.Close(context.Background())
+}
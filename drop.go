@@ -0,0 +1,71 @@
+package brrr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// dropJob is an instance database queued for dropping with Config.AsyncDrop.
+type dropJob struct {
+	name string
+	role bool
+	// release frees the quota slot of the instance once it is dropped
+	release bool
+}
+
+// errContainerClosed is returned by CloseInstance with Config.AsyncDrop after Close, when no worker drops the
+// database anymore.
+var errContainerClosed = errors.New("container is closed")
+
+// startDropWorker starts the background worker dropping the databases queued by CloseInstance.
+func (c *Container) startDropWorker() {
+	c.drops = make(chan dropJob, 64)
+	go func() {
+		for job := range c.drops {
+			if err := c.dropInstance(context.Background(), job.name, job.role); err != nil {
+				c.dropMu.Lock()
+				c.dropErrs = append(c.dropErrs, fmt.Errorf("failed to drop %s: %w", job.name, err))
+				c.dropMu.Unlock()
+			}
+			if job.release {
+				c.releaseInstance()
+			}
+			c.pendingDrops.Done()
+		}
+	}()
+}
+
+// queueDrop hands job to the drop worker, failing once Close stopped it.
+func (c *Container) queueDrop(job dropJob) error {
+	c.queueMu.Lock()
+	defer c.queueMu.Unlock()
+	if c.dropsClosed {
+		return fmt.Errorf("failed to drop %s: %w", job.name, errContainerClosed)
+	}
+	c.pendingDrops.Add(1)
+	c.drops <- job
+	return nil
+}
+
+// Drain waits for the databases queued by CloseInstance with Config.AsyncDrop to be dropped, and returns the errors
+// of the drops which failed since the last call. It returns right away without AsyncDrop.
+func (c *Container) Drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		c.pendingDrops.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	c.dropMu.Lock()
+	defer c.dropMu.Unlock()
+	err := errors.Join(c.dropErrs...)
+	c.dropErrs = nil
+	return err
+}
@@ -0,0 +1,74 @@
+package brrr_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/modfin/brrr"
+)
+
+func TestConfig_AsyncDrop(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	c := newContainer(t, sharedServer(brrr.Config{
+		Database:  "brrr_async",
+		AsyncDrop: true,
+	}))
+
+	var names []string
+	for range 3 {
+		di, err := c.NewInstance(ctx)
+		if err != nil {
+			t.Fatalf("NewInstance: %v", err)
+		}
+		names = append(names, di.Name)
+		if err := c.CloseInstance(ctx, di); err != nil {
+			t.Fatalf("CloseInstance: %v", err)
+		}
+	}
+	if err := c.Drain(ctx); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+
+	info := c.ConnectionInfo()
+	info.Database = "postgres"
+	conn, err := pgx.Connect(ctx, info.URL())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer conn.Close(context.Background())
+
+	var left int
+	if err := conn.QueryRow(ctx, "SELECT count(*) FROM pg_database WHERE datname = ANY($1)", names).Scan(&left); err != nil {
+		t.Fatalf("look up databases: %v", err)
+	}
+	if left != 0 {
+		t.Errorf("%d databases left after Drain", left)
+	}
+}
+
+func TestConfig_AsyncDrop_AfterClose(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	c, err := brrr.NewContainer(sharedServer(brrr.Config{
+		Database:  "brrr_async_closed",
+		AsyncDrop: true,
+	}))
+	if err != nil {
+		t.Fatalf("NewContainer: %v", err)
+	}
+
+	di, err := c.NewInstance(ctx)
+	if err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+	_ = c.Close()
+
+	if err := c.CloseInstance(ctx, di); err == nil {
+		t.Error("CloseInstance succeeded after Close")
+	}
+}
@@ -0,0 +1,209 @@
+package brrr
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	tcexec "github.com/testcontainers/testcontainers-go/exec"
+)
+
+// commandServer is implemented by servers which can run the postgres client tools, such as pg_restore, next to
+// the server.
+type commandServer interface {
+	// copyFile copies the file at hostPath to serverPath on the server.
+	copyFile(ctx context.Context, hostPath, serverPath string) error
+	// writeFile writes content to the file at serverPath on the server.
+	writeFile(ctx context.Context, content []byte, serverPath string) error
+	// readFile opens the file at serverPath on the server.
+	readFile(ctx context.Context, serverPath string) (io.ReadCloser, error)
+	// run runs cmd on the server and returns its combined output, which is included in the error if it fails.
+	run(ctx context.Context, cmd []string) ([]byte, error)
+}
+
+func (s *dockerServer) copyFile(ctx context.Context, hostPath, serverPath string) error {
+	return s.container.CopyFileToContainer(ctx, hostPath, serverPath, 0o644)
+}
+
+func (s *dockerServer) writeFile(ctx context.Context, content []byte, serverPath string) error {
+	return s.container.CopyToContainer(ctx, content, serverPath, 0o644)
+}
+
+func (s *dockerServer) readFile(ctx context.Context, serverPath string) (io.ReadCloser, error) {
+	return s.container.CopyFileFromContainer(ctx, serverPath)
+}
+
+func (s *dockerServer) run(ctx context.Context, cmd []string) ([]byte, error) {
+	code, r, err := s.container.Exec(ctx, cmd, tcexec.Multiplexed())
+	if err != nil {
+		return nil, fmt.Errorf("failed to run %s: %w", cmd[0], err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read output of %s: %w", cmd[0], err)
+	}
+	if code != 0 {
+		return out, fmt.Errorf("%s exited with code %d: %s", cmd[0], code, bytes.TrimSpace(out))
+	}
+	return out, nil
+}
+
+// customDumpMagic starts dumps in the custom format of pg_dump.
+const customDumpMagic = "PGDMP"
+
+// restoreDump restores the dump at cfg.DumpPath into cfg.Database on srv. Plain SQL dumps are executed statement by
+// statement like seed files, so they work with every backend. Custom format dumps are restored with pg_restore on
+// the server, which needs a backend that can run it.
+func restoreDump(ctx context.Context, cfg Config, srv server) (err error) {
+	ctx, span := cfg.startSpan(ctx, "brrr.dump.restore", databaseAttr(cfg.Database))
+	defer func() { endSpan(span, err) }()
+
+	start := time.Now()
+	f, err := os.Open(cfg.DumpPath)
+	if err != nil {
+		return fmt.Errorf("failed to read dump: %w", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	magic, err := r.Peek(len(customDumpMagic))
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read dump: %w", err)
+	}
+
+	cfg.logger().Debug("Restoring dump", "path", cfg.DumpPath)
+	if string(magic) == customDumpMagic {
+		err = pgRestore(ctx, cfg, srv)
+	} else {
+		err = func() error {
+			conn, err := pgx.Connect(ctx, cfg.url("postgres", cfg.Database))
+			if err != nil {
+				return fmt.Errorf("failed to connect to database: %w", err)
+			}
+			defer conn.Close(context.Background())
+
+			return executeFile(ctx, conn, path.Base(cfg.DumpPath), r)
+		}()
+	}
+	if err != nil {
+		return err
+	}
+	cfg.progress(StageDump, cfg.DumpPath, start)
+	cfg.logger().Info("Database dump restore complete", "database", cfg.Database)
+	return nil
+}
+
+// pgRestore restores the custom format dump at cfg.DumpPath into cfg.Database with pg_restore on srv. Ownership and
+// privileges of the dumped objects are not restored, as the roles of the dumped database rarely exist.
+func pgRestore(ctx context.Context, cfg Config, srv server) (err error) {
+	cmdSrv, ok := srv.(commandServer)
+	if !ok {
+		return fmt.Errorf("custom format dumps are not supported by the %s backend, dump as plain SQL instead", cfg.backend())
+	}
+
+	// Instances restore the dump concurrently with Migrate isolation, so each restore gets its own copy.
+	suffix, err := randomSecret()
+	if err != nil {
+		return err
+	}
+	dumpPath := "/tmp/brrr-" + suffix[:16] + ".dump"
+	if err := cmdSrv.copyFile(ctx, cfg.DumpPath, dumpPath); err != nil {
+		return fmt.Errorf("failed to copy dump to server: %w", err)
+	}
+	defer func() {
+		if _, rmErr := cmdSrv.run(context.Background(), []string{"rm", "-f", dumpPath}); err == nil && rmErr != nil {
+			err = fmt.Errorf("failed to remove dump from server: %w", rmErr)
+		}
+	}()
+
+	if _, err := cmdSrv.run(ctx, []string{"pg_restore", "--exit-on-error", "--no-owner", "--no-privileges",
+		"--username", cfg.User, "--dbname", cfg.Database, dumpPath}); err != nil {
+		return fmt.Errorf("failed to restore dump: %w", err)
+	}
+	return nil
+}
+
+// DumpTemplate writes a custom format pg_dump of the migrated and seeded template to w, which Config.DumpPath can
+// restore, e.g. to cache the template between CI pipelines. A clone of the template is dumped, so instances can be
+// created meanwhile. Only supported by the Docker backend, and not with Migrate isolation, which has no template.
+func (c *Container) DumpTemplate(ctx context.Context, w io.Writer) (err error) {
+	if c.cfg.isolation() == Migrate {
+		return errors.New("migrate isolation has no template to dump")
+	}
+	cmdSrv, ok := c.server.(commandServer)
+	if !ok {
+		return fmt.Errorf("dumping the template is not supported by the %s backend", c.cfg.backend())
+	}
+
+	suffix, err := randomSecret()
+	if err != nil {
+		return err
+	}
+	name := c.cfg.Database + "_dump_" + suffix[:8]
+
+	conn, err := c.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	if err := c.cloneTemplate(ctx, conn, instanceOptions{}, name); err != nil {
+		return err
+	}
+	defer func() {
+		_, dropErr := conn.Exec(context.Background(), fmt.Sprintf("DROP DATABASE %s WITH (FORCE)", pgx.Identifier{name}.Sanitize()))
+		if err == nil && dropErr != nil {
+			err = fmt.Errorf("failed to drop dumped clone: %w", dropErr)
+		}
+	}()
+
+	if err := c.dumpDatabase(ctx, cmdSrv, name, "custom", w); err != nil {
+		return fmt.Errorf("failed to dump template: %w", err)
+	}
+	return nil
+}
+
+// Dump writes a plain SQL pg_dump of the instance database to w, e.g. to inspect the data a test left behind.
+// Only supported by the Docker backend.
+func (di *DatabaseInstance) Dump(ctx context.Context, w io.Writer) error {
+	cmdSrv, ok := di.container.server.(commandServer)
+	if !ok {
+		return fmt.Errorf("dumping instances is not supported by the %s backend", di.container.cfg.backend())
+	}
+	if err := di.container.dumpDatabase(ctx, cmdSrv, di.Name, "plain", w); err != nil {
+		return fmt.Errorf("failed to dump instance %s: %w", di.Name, err)
+	}
+	return nil
+}
+
+// dumpDatabase writes a pg_dump of the database name in format to w, dumping to a file on the server first.
+func (c *Container) dumpDatabase(ctx context.Context, cmdSrv commandServer, name, format string, w io.Writer) (err error) {
+	dumpPath := "/tmp/" + name + ".dump"
+	if _, err := cmdSrv.run(ctx, []string{"pg_dump", "--format=" + format, "--username", c.cfg.User, "--dbname", name,
+		"--file", dumpPath}); err != nil {
+		return err
+	}
+	defer func() {
+		if _, rmErr := cmdSrv.run(context.Background(), []string{"rm", "-f", dumpPath}); err == nil && rmErr != nil {
+			err = fmt.Errorf("failed to remove dump from server: %w", rmErr)
+		}
+	}()
+
+	r, err := cmdSrv.readFile(ctx, dumpPath)
+	if err != nil {
+		return fmt.Errorf("failed to read dump from server: %w", err)
+	}
+	defer r.Close()
+
+	if _, err := io.Copy(w, r); err != nil {
+		return fmt.Errorf("failed to write dump: %w", err)
+	}
+	return nil
+}
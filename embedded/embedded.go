@@ -0,0 +1,164 @@
+// Package embedded registers the brrr.Embedded backend, which runs postgres as a local process from an embedded
+// distribution instead of a docker container:
+//
+//	import _ "github.com/modfin/brrr/embedded"
+package embedded
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+	"github.com/modfin/brrr"
+)
+
+func init() {
+	brrr.RegisterBackend(brrr.Embedded, func(_ context.Context, cfg brrr.Config, spec brrr.ServerSpec) (brrr.Server, error) {
+		return startServer(cfg, spec)
+	})
+}
+
+// server is a postgres server running as a local process from an embedded distribution.
+type server struct {
+	db   *embeddedpostgres.EmbeddedPostgres
+	port int
+	dir  string
+	log  io.Closer
+}
+
+func startServer(cfg brrr.Config, spec brrr.ServerSpec) (*server, error) {
+	start := time.Now()
+	port := cfg.HostPort
+	if port == 0 {
+		var err error
+		if port, err = freePort(); err != nil {
+			return nil, fmt.Errorf("failed to find a free port: %w", err)
+		}
+	}
+
+	// Each server gets its own directory so several containers can run side by side. The runtime directory is
+	// wiped when the server starts, so other files are kept next to it.
+	base, err := os.MkdirTemp("", "brrr-embedded-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create runtime directory: %w", err)
+	}
+
+	var logger io.WriteCloser = nopWriteCloser{io.Discard}
+	if cfg.Logger != nil {
+		logger = newSlogWriter(cfg.Logger)
+	}
+	if spec.LogOutput != nil {
+		logger = teeWriteCloser{WriteCloser: logger, out: spec.LogOutput}
+	}
+
+	params := spec.Params
+	if spec.Conf != nil {
+		path := filepath.Join(base, "postgresql.conf")
+		if err := os.WriteFile(path, spec.Conf, 0o600); err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to write postgresql.conf: %w", err), logger.Close(), os.RemoveAll(base))
+		}
+		params["config_file"] = path
+	}
+
+	epCfg := embeddedpostgres.DefaultConfig().
+		Port(uint32(port)).
+		Username(cfg.User).
+		Password(cfg.Password).
+		Database(cfg.Database).
+		RuntimePath(filepath.Join(base, "runtime")).
+		Locale(cfg.Locale).
+		StartParameters(params).
+		StartTimeout(spec.StartupTimeout).
+		Logger(logger)
+	if cfg.EmbeddedVersion != "" {
+		epCfg = epCfg.Version(embeddedpostgres.PostgresVersion(cfg.EmbeddedVersion))
+	}
+
+	db := embeddedpostgres.NewDatabase(epCfg)
+	if err := db.Start(); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to start embedded postgres: %w", err), logger.Close(), os.RemoveAll(base))
+	}
+
+	spec.Started(base, start)
+
+	return &server{db: db, port: port, dir: base, log: logger}, nil
+}
+
+func (s *server) Endpoint(context.Context) (string, int, error) {
+	return "localhost", s.port, nil
+}
+
+// Internal returns the loopback address, as the embedded server is only reachable from the local machine.
+func (s *server) Internal(context.Context) (string, map[string][]string, error) {
+	return "127.0.0.1", nil, nil
+}
+
+func (s *server) Healthy(context.Context) error {
+	conn, err := net.Dial("tcp", net.JoinHostPort("localhost", strconv.Itoa(s.port)))
+	if err != nil {
+		return fmt.Errorf("embedded postgres is not accepting connections: %w", err)
+	}
+	return conn.Close()
+}
+
+func (s *server) Terminate(context.Context) error {
+	return errors.Join(s.db.Stop(), s.log.Close(), os.RemoveAll(s.dir))
+}
+
+// freePort asks the kernel for a port that is currently free on localhost.
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// teeWriteCloser writes to out as well, which is not closed. Errors writing to out are ignored, so a failing
+// Config.LogOutput does not fail the server.
+type teeWriteCloser struct {
+	io.WriteCloser
+	out io.Writer
+}
+
+func (t teeWriteCloser) Write(p []byte) (int, error) {
+	_, _ = t.out.Write(p)
+	return t.WriteCloser.Write(p)
+}
+
+// maxLogLine is the longest server log line newSlogWriter logs, e.g. a statement logged with log_statement.
+const maxLogLine = 16 << 20
+
+// newSlogWriter returns a writer logging every line written to it on logger.
+func newSlogWriter(logger *slog.Logger) io.WriteCloser {
+	r, w := io.Pipe()
+	go func() {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(nil, maxLogLine)
+		for scanner.Scan() {
+			logger.Info(scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			// The rest is discarded, so the server does not block writing its log.
+			logger.Warn("Failed to read server log", "error", err)
+			_, _ = io.Copy(io.Discard, r)
+		}
+	}()
+	return w
+}
@@ -0,0 +1,69 @@
+package embedded
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// syncBuffer is a bytes.Buffer safe for the concurrent use by a logger and a test.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestSlogWriter(t *testing.T) {
+	var out syncBuffer
+	w := newSlogWriter(slog.New(slog.NewTextHandler(&out, nil)))
+
+	long := strings.Repeat("x", 100<<10)
+	if _, err := io.WriteString(w, "first line\n"+long+"\n"); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	// Lines beyond the limit stop the logging, but writes keep succeeding.
+	if _, err := io.WriteString(w, strings.Repeat("y", maxLogLine+1)+"\nlast line\n"); err != nil {
+		t.Fatalf("write after too long line: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	logged := out.String()
+	if !strings.Contains(logged, "first line") || !strings.Contains(logged, long) {
+		t.Errorf("expected the lines written to be logged, got %d bytes", len(logged))
+	}
+	if !strings.Contains(logged, "Failed to read server log") {
+		t.Error("expected the too long line to be reported")
+	}
+}
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, io.ErrClosedPipe }
+
+func TestTeeWriteCloser_IgnoresOutErrors(t *testing.T) {
+	var buf bytes.Buffer
+	w := teeWriteCloser{WriteCloser: nopWriteCloser{&buf}, out: failingWriter{}}
+	if _, err := io.WriteString(w, "line\n"); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if buf.String() != "line\n" {
+		t.Errorf("got %q, want the line written", buf.String())
+	}
+}
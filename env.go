@@ -0,0 +1,149 @@
+package brrr
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// envVars maps the environment variables read by ConfigFromEnv to the Config fields they set.
+var envVars = []struct {
+	name string
+	set  func(cfg *Config, value string) error
+}{
+	{"BRRR_BACKEND", envString(func(cfg *Config) *string { return (*string)(&cfg.Backend) })},
+	{"BRRR_IMAGE", envString(func(cfg *Config) *string { return &cfg.Image })},
+	{"BRRR_PULL_POLICY", envString(func(cfg *Config) *string { return (*string)(&cfg.PullPolicy) })},
+	{"BRRR_REGISTRY_MIRROR", envString(func(cfg *Config) *string { return &cfg.RegistryMirror })},
+	{"BRRR_EMBEDDED_VERSION", envString(func(cfg *Config) *string { return &cfg.EmbeddedVersion })},
+	{"BRRR_EXTERNAL_DSN", envString(func(cfg *Config) *string { return &cfg.ExternalDSN })},
+	{"BRRR_KUBE_CONFIG", envString(func(cfg *Config) *string { return &cfg.KubeConfig })},
+	{"BRRR_KUBE_NAMESPACE", envString(func(cfg *Config) *string { return &cfg.KubeNamespace })},
+	{"BRRR_USER", envString(func(cfg *Config) *string { return &cfg.User })},
+	{"BRRR_PASSWORD", envString(func(cfg *Config) *string { return &cfg.Password })},
+	{"BRRR_DATABASE", envString(func(cfg *Config) *string { return &cfg.Database })},
+	{"BRRR_ISOLATION", envString(func(cfg *Config) *string { return (*string)(&cfg.Isolation) })},
+	{"BRRR_LOCALE", envString(func(cfg *Config) *string { return &cfg.Locale })},
+	{"BRRR_ENCODING", envString(func(cfg *Config) *string { return &cfg.Encoding })},
+	{"BRRR_COLLATION", envString(func(cfg *Config) *string { return &cfg.Collation })},
+	{"BRRR_TIMEZONE", envString(func(cfg *Config) *string { return &cfg.Timezone })},
+	{"BRRR_POSTGRES_CONF", envString(func(cfg *Config) *string { return &cfg.PostgresConf })},
+	{"BRRR_CONTAINER_NAME", envString(func(cfg *Config) *string { return &cfg.ContainerName })},
+	{"BRRR_HOST_PORT", envInt(func(cfg *Config) *int { return &cfg.HostPort })},
+	{"BRRR_HOST_NETWORK", envBool(func(cfg *Config) *bool { return &cfg.HostNetwork })},
+	{"BRRR_NETWORK", envString(func(cfg *Config) *string { return &cfg.Network })},
+	{"BRRR_MEMORY_LIMIT", envInt64(func(cfg *Config) *int64 { return &cfg.MemoryLimit })},
+	{"BRRR_CPU_LIMIT", envFloat(func(cfg *Config) *float64 { return &cfg.CPULimit })},
+	{"BRRR_CPU_SHARES", envInt64(func(cfg *Config) *int64 { return &cfg.CPUShares })},
+	{"BRRR_SHM_SIZE", envInt64(func(cfg *Config) *int64 { return &cfg.ShmSize })},
+	{"BRRR_MAX_CONNECTIONS", envInt(func(cfg *Config) *int { return &cfg.MaxConnections })},
+	{"BRRR_FAST_PROFILE", envBool(func(cfg *Config) *bool { return &cfg.FastProfile })},
+	{"BRRR_DUMP_PATH", envString(func(cfg *Config) *string { return &cfg.DumpPath })},
+	{"BRRR_MIGRATIONS_PATH", envString(func(cfg *Config) *string { return &cfg.MigrationsPath })},
+	{"BRRR_MIGRATION_TOOL", envString(func(cfg *Config) *string { return (*string)(&cfg.MigrationTool) })},
+	{"BRRR_MIGRATION_TARGET_VERSION", envUint(func(cfg *Config) *uint { return &cfg.MigrationTargetVersion })},
+	{"BRRR_SEED_PATH", envString(func(cfg *Config) *string { return &cfg.SeedPath })},
+	{"BRRR_CSV_PATH", envString(func(cfg *Config) *string { return &cfg.CSVPath })},
+	{"BRRR_MAX_INSTANCES", envInt(func(cfg *Config) *int { return &cfg.MaxInstances })},
+	{"BRRR_INSTANCE_QUOTA_WAIT", envQuotaWait},
+	{"BRRR_INSTANCE_TTL", envDuration(func(cfg *Config) *time.Duration { return &cfg.InstanceTTL })},
+	{"BRRR_KEEP_STALE_INSTANCES", envBool(func(cfg *Config) *bool { return &cfg.KeepStaleInstances })},
+	{"BRRR_FAIL_ON_LEAK", envBool(func(cfg *Config) *bool { return &cfg.FailOnLeak })},
+	{"BRRR_ASYNC_DROP", envBool(func(cfg *Config) *bool { return &cfg.AsyncDrop })},
+	{"BRRR_FREEZE_TEMPLATE", envBool(func(cfg *Config) *bool { return &cfg.FreezeTemplate })},
+	{"BRRR_REUSE", envBool(func(cfg *Config) *bool { return &cfg.Reuse })},
+	{"BRRR_FAILURE_DUMP_DIR", envString(func(cfg *Config) *string { return &cfg.FailureDumpDir })},
+	{"BRRR_KEEP_ON_FAILURE", envBool(func(cfg *Config) *bool { return &cfg.KeepOnFailure })},
+	{"BRRR_PERSISTENT", envBool(func(cfg *Config) *bool { return &cfg.Persistent })},
+	{"BRRR_ADMIN_CONNECTIONS", envInt(func(cfg *Config) *int { return &cfg.AdminConnections })},
+	{"BRRR_DISABLE_REAPER", envBool(func(cfg *Config) *bool { return &cfg.DisableReaper })},
+	{"BRRR_REAPER_PRIVILEGED", envBool(func(cfg *Config) *bool { return &cfg.ReaperPrivileged })},
+	{"BRRR_REAPER_REGISTRY", envString(func(cfg *Config) *string { return &cfg.ReaperRegistry })},
+	{"BRRR_SESSION", envString(func(cfg *Config) *string { return &cfg.Session })},
+	{"BRRR_STARTUP_TIMEOUT", envDuration(func(cfg *Config) *time.Duration { return &cfg.StartupTimeout })},
+	{"BRRR_STARTUP_RETRIES", envInt(func(cfg *Config) *int { return &cfg.StartupRetries })},
+	{"BRRR_CONNECT_RETRIES", envInt(func(cfg *Config) *int { return &cfg.ConnectRetries })},
+	{"BRRR_CONNECT_BACKOFF", envDuration(func(cfg *Config) *time.Duration { return &cfg.ConnectBackoff })},
+	{"BRRR_CONNECT_DEADLINE", envDuration(func(cfg *Config) *time.Duration { return &cfg.ConnectDeadline })},
+}
+
+func envString(field func(*Config) *string) func(*Config, string) error {
+	return func(cfg *Config, value string) error {
+		*field(cfg) = value
+		return nil
+	}
+}
+
+func envInt(field func(*Config) *int) func(*Config, string) error {
+	return func(cfg *Config, value string) (err error) {
+		*field(cfg), err = strconv.Atoi(value)
+		return err
+	}
+}
+
+func envUint(field func(*Config) *uint) func(*Config, string) error {
+	return func(cfg *Config, value string) error {
+		n, err := strconv.ParseUint(value, 10, 0)
+		*field(cfg) = uint(n)
+		return err
+	}
+}
+
+func envInt64(field func(*Config) *int64) func(*Config, string) error {
+	return func(cfg *Config, value string) (err error) {
+		*field(cfg), err = strconv.ParseInt(value, 10, 64)
+		return err
+	}
+}
+
+func envFloat(field func(*Config) *float64) func(*Config, string) error {
+	return func(cfg *Config, value string) (err error) {
+		*field(cfg), err = strconv.ParseFloat(value, 64)
+		return err
+	}
+}
+
+func envBool(field func(*Config) *bool) func(*Config, string) error {
+	return func(cfg *Config, value string) (err error) {
+		*field(cfg), err = strconv.ParseBool(value)
+		return err
+	}
+}
+
+func envDuration(field func(*Config) *time.Duration) func(*Config, string) error {
+	return func(cfg *Config, value string) (err error) {
+		*field(cfg), err = time.ParseDuration(value)
+		return err
+	}
+}
+
+// envQuotaWait parses BRRR_INSTANCE_QUOTA_WAIT, which is a duration or forever for InstanceQuotaWaitForever.
+func envQuotaWait(cfg *Config, value string) (err error) {
+	if value == "forever" {
+		cfg.InstanceQuotaWait = InstanceQuotaWaitForever
+		return nil
+	}
+	cfg.InstanceQuotaWait, err = time.ParseDuration(value)
+	return err
+}
+
+// ConfigFromEnv returns cfg with fields overridden by BRRR_* environment variables, so CI pipelines can tweak
+// tests without recompiling them. Variables are named after the field in upper snake case, e.g. BRRR_IMAGE,
+// BRRR_MAX_CONNECTIONS, BRRR_KUBE_CONFIG or BRRR_EXTERNAL_DSN. Durations use time.ParseDuration syntax, and
+// BRRR_INSTANCE_QUOTA_WAIT=forever sets InstanceQuotaWaitForever.
+//
+// Precedence, from highest to lowest: set environment variables, fields set in cfg, and the defaults documented
+// on each field. Variables set to the empty string are ignored.
+func ConfigFromEnv(cfg Config) (Config, error) {
+	for _, v := range envVars {
+		value := os.Getenv(v.name)
+		if value == "" {
+			continue
+		}
+		if err := v.set(&cfg, value); err != nil {
+			return cfg, fmt.Errorf("invalid %s: %w", v.name, err)
+		}
+	}
+	return cfg, nil
+}
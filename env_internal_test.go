@@ -0,0 +1,36 @@
+package brrr
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+// upperSnake converts a field name to upper snake case, keeping initialisms together, e.g. ExternalDSN to
+// EXTERNAL_DSN and CSVPath to CSV_PATH.
+func upperSnake(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) &&
+			(!unicode.IsUpper(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+func TestEnvVars_FieldNames(t *testing.T) {
+	fields := map[string]bool{}
+	typ := reflect.TypeFor[Config]()
+	for i := range typ.NumField() {
+		fields["BRRR_"+upperSnake(typ.Field(i).Name)] = true
+	}
+	for _, v := range envVars {
+		if !fields[v.name] {
+			t.Errorf("%s is not named after a field of Config in upper snake case", v.name)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package brrr_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/modfin/brrr"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("BRRR_IMAGE", "postgres:16")
+	t.Setenv("BRRR_MAX_CONNECTIONS", "50")
+	t.Setenv("BRRR_CONNECT_DEADLINE", "5s")
+	t.Setenv("BRRR_MIGRATIONS_PATH", "")
+
+	cfg, err := brrr.ConfigFromEnv(brrr.Config{Image: "postgres:17", Database: "app", MigrationsPath: "migrations"})
+	if err != nil {
+		t.Fatalf("ConfigFromEnv: %v", err)
+	}
+	if cfg.Image != "postgres:16" || cfg.MaxConnections != 50 || cfg.ConnectDeadline != 5*time.Second {
+		t.Errorf("environment did not override the config: %+v", cfg)
+	}
+	if cfg.Database != "app" || cfg.MigrationsPath != "migrations" {
+		t.Errorf("fields without variables were changed: %+v", cfg)
+	}
+
+	t.Setenv("BRRR_MIGRATION_TARGET_VERSION", "3")
+	if cfg, err := brrr.ConfigFromEnv(brrr.Config{}); err != nil || cfg.MigrationTargetVersion != 3 {
+		t.Errorf("BRRR_MIGRATION_TARGET_VERSION=3 set MigrationTargetVersion to %d, %v", cfg.MigrationTargetVersion, err)
+	}
+
+	t.Setenv("BRRR_INSTANCE_QUOTA_WAIT", "forever")
+	if cfg, err := brrr.ConfigFromEnv(brrr.Config{}); err != nil || cfg.InstanceQuotaWait != brrr.InstanceQuotaWaitForever {
+		t.Errorf("BRRR_INSTANCE_QUOTA_WAIT=forever set InstanceQuotaWait to %v, %v", cfg.InstanceQuotaWait, err)
+	}
+
+	t.Setenv("BRRR_MAX_CONNECTIONS", "many")
+	if _, err := brrr.ConfigFromEnv(brrr.Config{}); err == nil {
+		t.Error("expected an error for an invalid BRRR_MAX_CONNECTIONS")
+	}
+}
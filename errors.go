@@ -0,0 +1,56 @@
+package brrr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrTemplateBusy is returned by NewInstance when the template can't be cloned because other sessions stay
+	// connected to it, e.g. a database tool left open on it. Retrying later may succeed.
+	ErrTemplateBusy = errors.New("template database is in use by other sessions")
+
+	// ErrInstanceNotFound is returned when the database of an instance no longer exists, e.g. because the instance
+	// was closed already.
+	ErrInstanceNotFound = errors.New("instance database does not exist")
+
+	// ErrContainerStartTimeout is returned by NewContainer when the server is not ready before the setup context or
+	// the startup wait strategy times out.
+	ErrContainerStartTimeout = errors.New("postgres server did not start in time")
+)
+
+// MigrationError is returned when a migration of the template or an instance fails.
+type MigrationError struct {
+	// Version of the failed migration, zero if the tool does not report it, such as for a Migrator.
+	Version uint64
+	// File of the failed migration, empty if the tool does not report it.
+	File string
+	// Err is the error of the migration tool.
+	Err error
+}
+
+func (e *MigrationError) Error() string {
+	switch {
+	case e.File != "":
+		return fmt.Sprintf("migration %s failed: %v", e.File, e.Err)
+	case e.Version != 0:
+		return fmt.Sprintf("migration %d failed: %v", e.Version, e.Err)
+	default:
+		return fmt.Sprintf("migration failed: %v", e.Err)
+	}
+}
+
+func (e *MigrationError) Unwrap() error {
+	return e.Err
+}
+
+// LeakError is returned by Close with Config.FailOnLeak when instances were never closed.
+type LeakError struct {
+	// Instances lists the instances which were not closed as "name (created at file:line)".
+	Instances []string
+}
+
+func (e *LeakError) Error() string {
+	return fmt.Sprintf("%d instances were not closed: %s", len(e.Instances), strings.Join(e.Instances, ", "))
+}
@@ -0,0 +1,49 @@
+package brrr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ExecCommand runs cmd inside the container and returns its combined output, e.g. for setup which must run next
+// to the server, such as creating the directory of a tablespace. It fails if cmd exits with a non-zero code,
+// including the output in the error. Only supported by the Docker backend.
+func (c *Container) ExecCommand(ctx context.Context, cmd ...string) ([]byte, error) {
+	if len(cmd) == 0 {
+		return nil, errors.New("no command to run")
+	}
+	cmdSrv, ok := c.server.(commandServer)
+	if !ok {
+		return nil, fmt.Errorf("running commands is not supported by the %s backend", c.cfg.backend())
+	}
+	return cmdSrv.run(ctx, cmd)
+}
+
+// ExecPSQL runs the script sql with psql inside the container, connected to the template database as Config.User,
+// and returns its output. The script may mix statements and psql meta-commands such as \copy, which are not
+// available over a client connection. Execution stops at the first failing command, and instances are not created
+// meanwhile. Only supported by the Docker backend.
+func (c *Container) ExecPSQL(ctx context.Context, sql string) ([]byte, error) {
+	cmdSrv, ok := c.server.(commandServer)
+	if !ok {
+		return nil, fmt.Errorf("running psql is not supported by the %s backend", c.cfg.backend())
+	}
+
+	// psql runs the script from a file, as --command takes either a single meta-command or only SQL.
+	suffix, err := randomSecret()
+	if err != nil {
+		return nil, err
+	}
+	path := "/tmp/brrr-" + suffix[:16] + ".sql"
+	if err := cmdSrv.writeFile(ctx, []byte(sql), path); err != nil {
+		return nil, fmt.Errorf("failed to copy script to server: %w", err)
+	}
+	defer func() { _, _ = cmdSrv.run(context.Background(), []string{"rm", "-f", path}) }()
+
+	// Clones fail while psql is connected to the template, so they wait like for a refresh.
+	c.templateMu.Lock()
+	defer c.templateMu.Unlock()
+	return cmdSrv.run(ctx, []string{"psql", "--no-psqlrc", "--set", "ON_ERROR_STOP=1", "--username", c.cfg.User,
+		"--dbname", c.cfg.Database, "--file", path})
+}
@@ -0,0 +1,46 @@
+package brrr_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/modfin/brrr"
+)
+
+func TestContainer_ExecPSQL(t *testing.T) {
+	ctx := context.Background()
+	out, err := brrr.Default().ExecPSQL(ctx, "SELECT current_database()")
+	if err != nil {
+		t.Fatalf("ExecPSQL: %v", err)
+	}
+	if !strings.Contains(string(out), "brrr_test") {
+		t.Errorf("expected psql to connect to the template database, got:\n%s", out)
+	}
+
+	// Meta-commands and statements can be mixed in one script.
+	out, err = brrr.Default().ExecPSQL(ctx, "\\echo brrr_meta\nSELECT 'brrr_' || 'sql';\n\\conninfo\n")
+	if err != nil {
+		t.Fatalf("ExecPSQL: %v", err)
+	}
+	for _, want := range []string{"brrr_meta", "brrr_sql", "brrr_test"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("expected %q in the output of psql, got:\n%s", want, out)
+		}
+	}
+
+	if _, err := brrr.Default().ExecPSQL(ctx, "SELECT * FROM brrr_missing_table"); err == nil ||
+		!strings.Contains(err.Error(), "brrr_missing_table") {
+		t.Errorf("expected the error of psql, got %v", err)
+	}
+}
+
+func TestContainer_ExecCommand(t *testing.T) {
+	out, err := brrr.Default().ExecCommand(context.Background(), "pg_config", "--version")
+	if err != nil {
+		t.Fatalf("ExecCommand: %v", err)
+	}
+	if !strings.HasPrefix(string(out), "PostgreSQL") {
+		t.Errorf("unexpected output of pg_config: %s", out)
+	}
+}
@@ -0,0 +1,29 @@
+package brrr
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// createExtensions creates the Config.Extensions in cfg.Database, along with the extensions they depend on.
+func createExtensions(ctx context.Context, cfg Config) error {
+	if len(cfg.Extensions) == 0 {
+		return nil
+	}
+
+	conn, err := pgx.Connect(ctx, cfg.url("postgres", cfg.Database))
+	if err != nil {
+		return fmt.Errorf("failed to connect to database for extensions: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	for _, ext := range cfg.Extensions {
+		if _, err := conn.Exec(ctx, fmt.Sprintf("CREATE EXTENSION IF NOT EXISTS %s CASCADE", pgx.Identifier{ext}.Sanitize())); err != nil {
+			return fmt.Errorf("failed to create extension %s: %w", ext, err)
+		}
+	}
+	cfg.logger().Info("Database extensions created", "database", cfg.Database, "extensions", cfg.Extensions)
+	return nil
+}
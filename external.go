@@ -0,0 +1,56 @@
+package brrr
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// externalServer is a postgres server provided by the environment, such as a CI service container, and reached
+// through Config.ExternalDSN. It is never stopped by brrr.
+type externalServer struct {
+	host string
+	port int
+}
+
+// externalCredentials fills in the user and password of cfg from Config.ExternalDSN where they are empty, and
+// returns the server the DSN points at.
+func externalCredentials(cfg Config) (Config, *externalServer, error) {
+	connCfg, err := pgconn.ParseConfig(cfg.ExternalDSN)
+	if err != nil {
+		return cfg, nil, fmt.Errorf("failed to parse external DSN: %w", err)
+	}
+	if cfg.User == "" {
+		cfg.User = connCfg.User
+	}
+	if cfg.Password == "" {
+		cfg.Password = connCfg.Password
+	}
+	return cfg, &externalServer{host: connCfg.Host, port: int(connCfg.Port)}, nil
+}
+
+func (s *externalServer) endpoint(context.Context) (string, int, error) {
+	return s.host, s.port, nil
+}
+
+// internal returns the address from the DSN, as nothing more is known about how the server is reachable.
+func (s *externalServer) internal(context.Context) (string, map[string][]string, error) {
+	return s.host, nil, nil
+}
+
+func (s *externalServer) healthy(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(s.host, strconv.Itoa(s.port)))
+	if err != nil {
+		return fmt.Errorf("external postgres is not accepting connections: %w", err)
+	}
+	return conn.Close()
+}
+
+// terminate leaves the server running, as its lifecycle is managed by whoever provided it.
+func (s *externalServer) terminate(context.Context) error {
+	return nil
+}
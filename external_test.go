@@ -0,0 +1,69 @@
+package brrr_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/modfin/brrr"
+)
+
+func TestConfig_ExternalDSN(t *testing.T) {
+	// The server of the shared test container stands in for one provided by the environment.
+	info := brrr.Default().ConnectionInfo()
+	dsn := fmt.Sprintf("postgres://%s:%s@%s:%d/postgres?sslmode=disable", info.User, info.Password, info.Host, info.Port)
+
+	for range 2 {
+		c, err := brrr.NewContainer(brrr.Config{ExternalDSN: dsn, Database: "brrr_external"})
+		if err != nil {
+			t.Fatalf("NewContainer: %v", err)
+		}
+		if got := c.Report().Backend; got != brrr.External {
+			t.Errorf("expected the external backend, got %q", got)
+		}
+
+		di, err := c.NewInstance(t.Context())
+		if err != nil {
+			t.Fatalf("NewInstance: %v", err)
+		}
+		if err := c.CloseInstance(t.Context(), di); err != nil {
+			t.Fatalf("CloseInstance: %v", err)
+		}
+		if err := c.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+	}
+
+	if err := brrr.Default().Healthy(t.Context()); err != nil {
+		t.Fatalf("external server was affected by Close: %v", err)
+	}
+}
+
+func TestConfig_ExternalDSN_ForeignDatabase(t *testing.T) {
+	info := brrr.Default().ConnectionInfo()
+	info.Database = "postgres"
+	conn, err := pgx.Connect(t.Context(), info.URL())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer conn.Close(context.Background())
+	if _, err := conn.Exec(t.Context(), "CREATE DATABASE brrr_foreign"); err != nil {
+		t.Fatalf("create database: %v", err)
+	}
+
+	dsn := fmt.Sprintf("postgres://%s:%s@%s:%d/postgres?sslmode=disable", info.User, info.Password, info.Host, info.Port)
+	c, err := brrr.NewContainer(brrr.Config{ExternalDSN: dsn, Database: "brrr_foreign"})
+	if err == nil {
+		c.Close()
+		t.Fatal("NewContainer replaced a database not built by brrr")
+	}
+
+	var exists bool
+	if err := conn.QueryRow(t.Context(), "SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = 'brrr_foreign')").Scan(&exists); err != nil {
+		t.Fatalf("look up database: %v", err)
+	}
+	if !exists {
+		t.Error("database not built by brrr was dropped")
+	}
+}
@@ -0,0 +1,175 @@
+package brrr
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Factory inserts rows of type T into instances, built from defaults with per call overrides, and returns them as
+// inserted, including the values generated by the database such as ids.
+//
+// Fields of T are mapped to columns of the table like pgx.RowToStructByName maps rows to structs: by their db tag,
+// or else by the column matching the field name case insensitively and ignoring underscores, so UserID maps to
+// user_id. The fields of embedded structs are mapped as fields of T. Fields tagged db:"-" and unexported fields
+// are skipped. Fields holding their zero value are left out of the INSERT, so the columns get their defaults.
+type Factory[T any] struct {
+	// Table the rows are inserted into, optionally qualified with its schema.
+	Table string
+
+	// Defaults returns the row to start from, given a sequence number counting the rows created by the factory from
+	// 1, for unique values such as fmt.Sprintf("user%d@example.com", n). Will start from the zero value if empty.
+	Defaults func(n int) T
+
+	// Associations are run after the overrides of every row, to create the rows it references. Will ignore if empty.
+	Associations []Association[T]
+
+	seq atomic.Int64
+}
+
+// Association prepares row for insertion into di, typically by creating a row it references, see BelongsTo.
+type Association[T any] func(ctx context.Context, di *DatabaseInstance, row *T) error
+
+// BelongsTo returns an association creating a parent row with the factory parent when the foreign key returned by
+// key is still zero, and setting it to the value id returns for the created parent.
+func BelongsTo[T, P any, K comparable](parent *Factory[P], key func(row *T) *K, id func(parent P) K) Association[T] {
+	return func(ctx context.Context, di *DatabaseInstance, row *T) error {
+		var zero K
+		if *key(row) != zero {
+			return nil
+		}
+		p, err := parent.Create(ctx, di)
+		if err != nil {
+			return err
+		}
+		*key(row) = id(p)
+		return nil
+	}
+}
+
+// Create inserts a row into di, built from the defaults with the overrides applied in order, and returns it as
+// inserted.
+func (f *Factory[T]) Create(ctx context.Context, di *DatabaseInstance, overrides ...func(row *T)) (T, error) {
+	var row T
+	if f.Defaults != nil {
+		row = f.Defaults(int(f.seq.Add(1)))
+	}
+	for _, override := range overrides {
+		override(&row)
+	}
+	for _, associate := range f.Associations {
+		if err := associate(ctx, di, &row); err != nil {
+			return row, fmt.Errorf("failed to create association of %s: %w", f.Table, err)
+		}
+	}
+
+	table := pgx.Identifier(strings.Split(f.Table, ".")).Sanitize()
+	rows, err := di.Connection.Query(ctx, fmt.Sprintf("SELECT * FROM %s LIMIT 0", table))
+	if err != nil {
+		return row, fmt.Errorf("failed to look up columns of %s: %w", f.Table, err)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return row, fmt.Errorf("failed to look up columns of %s: %w", f.Table, err)
+	}
+
+	columns, values, all, err := factoryColumns(row, rows.FieldDescriptions())
+	if err != nil {
+		return row, fmt.Errorf("failed to map %s to %s: %w", reflect.TypeOf(row), f.Table, err)
+	}
+
+	sql := fmt.Sprintf("INSERT INTO %s DEFAULT VALUES RETURNING %s", table, strings.Join(all, ", "))
+	if len(columns) > 0 {
+		params := make([]string, len(columns))
+		for i := range params {
+			params[i] = fmt.Sprintf("$%d", i+1)
+		}
+		sql = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) RETURNING %s",
+			table, strings.Join(columns, ", "), strings.Join(params, ", "), strings.Join(all, ", "))
+	}
+
+	rows, err = di.Connection.Query(ctx, sql, values...)
+	if err != nil {
+		return row, fmt.Errorf("failed to insert into %s: %w", f.Table, err)
+	}
+	created, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[T])
+	if err != nil {
+		return row, fmt.Errorf("failed to insert into %s: %w", f.Table, err)
+	}
+	return created, nil
+}
+
+// CreateMany inserts n rows into di like Create, applying the same overrides to each.
+func (f *Factory[T]) CreateMany(ctx context.Context, di *DatabaseInstance, n int, overrides ...func(row *T)) ([]T, error) {
+	rows := make([]T, 0, n)
+	for range n {
+		row, err := f.Create(ctx, di, overrides...)
+		if err != nil {
+			return rows, err
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// factoryColumns returns the quoted columns and values of the non-zero fields of row, and all its quoted columns,
+// matched against the columns of the table in fields.
+func factoryColumns(row any, fields []pgconn.FieldDescription) (columns []string, values []any, all []string, err error) {
+	v := reflect.ValueOf(row)
+	if v.Kind() != reflect.Struct {
+		return nil, nil, nil, fmt.Errorf("factory rows must be structs, got %s", v.Type())
+	}
+	return structColumns(v, fields)
+}
+
+// structColumns is factoryColumns for the struct v.
+func structColumns(v reflect.Value, fields []pgconn.FieldDescription) (columns []string, values []any, all []string, err error) {
+	for i := range v.NumField() {
+		field := v.Type().Field(i)
+		// Embedded structs are flattened, even unexported ones, but embedded pointers are not.
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			c, vals, a, err := structColumns(v.Field(i), fields)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			columns, values, all = append(columns, c...), append(values, vals...), append(all, a...)
+			continue
+		}
+
+		tag, tagged := field.Tag.Lookup("db")
+		name, _, _ := strings.Cut(tag, ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if !tagged {
+			if name = factoryColumn(fields, field.Name); name == "" {
+				return nil, nil, nil, fmt.Errorf("no column matches field %s", field.Name)
+			}
+		}
+
+		column := pgx.Identifier{name}.Sanitize()
+		all = append(all, column)
+		if !v.Field(i).IsZero() {
+			columns = append(columns, column)
+			values = append(values, v.Field(i).Interface())
+		}
+	}
+	return columns, values, all, nil
+}
+
+// factoryColumn returns the column in fields matching the untagged field name like pgx matches them, or "" if none
+// does.
+func factoryColumn(fields []pgconn.FieldDescription, name string) string {
+	name = strings.ReplaceAll(name, "_", "")
+	for _, fd := range fields {
+		if strings.EqualFold(strings.ReplaceAll(fd.Name, "_", ""), name) {
+			return fd.Name
+		}
+	}
+	return ""
+}
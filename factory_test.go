@@ -0,0 +1,124 @@
+package brrr_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/modfin/brrr"
+)
+
+type user struct {
+	ID    int64  `db:"id"`
+	Email string `db:"email"`
+	Admin bool   `db:"admin"`
+}
+
+type order struct {
+	ID     int64     `db:"id"`
+	UserID int64     `db:"user_id"`
+	Total  float64   `db:"total"`
+	Placed time.Time `db:"placed_at"`
+}
+
+func TestFactory(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	c := newContainer(t, sharedServer(brrr.Config{
+		Database: "brrr_factory",
+		SeedFS: fstest.MapFS{"01_schema.sql": {Data: []byte(`
+			CREATE TABLE users (id bigserial PRIMARY KEY, email text NOT NULL UNIQUE, admin bool NOT NULL DEFAULT false);
+			CREATE TABLE orders (
+				id bigserial PRIMARY KEY,
+				user_id bigint NOT NULL REFERENCES users,
+				total float8 NOT NULL,
+				placed_at timestamptz NOT NULL DEFAULT now()
+			);`)}},
+	}))
+
+	di, err := c.NewInstance(ctx)
+	if err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+	defer c.CloseInstance(context.Background(), di)
+
+	users := &brrr.Factory[user]{
+		Table: "users",
+		Defaults: func(n int) user {
+			return user{Email: fmt.Sprintf("user%d@example.com", n)}
+		},
+	}
+	orders := &brrr.Factory[order]{
+		Table:    "orders",
+		Defaults: func(int) order { return order{Total: 9.99} },
+		Associations: []brrr.Association[order]{
+			brrr.BelongsTo(users, func(o *order) *int64 { return &o.UserID }, func(u user) int64 { return u.ID }),
+		},
+	}
+
+	admin, err := users.Create(ctx, di, func(u *user) { u.Admin = true })
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if admin.ID == 0 || !admin.Admin || admin.Email != "user1@example.com" {
+		t.Errorf("got %+v, want a generated id, admin and the first email", admin)
+	}
+
+	created, err := orders.CreateMany(ctx, di, 2)
+	if err != nil {
+		t.Fatalf("CreateMany: %v", err)
+	}
+	if created[0].UserID == created[1].UserID || created[0].Placed.IsZero() {
+		t.Errorf("got %+v, want orders of separate users with defaulted timestamps", created)
+	}
+
+	own, err := orders.Create(ctx, di, func(o *order) { o.UserID = admin.ID })
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if own.UserID != admin.ID {
+		t.Errorf("got user %d, want %d", own.UserID, admin.ID)
+	}
+
+	var count int
+	if err := di.Connection.QueryRow(ctx, "SELECT count(*) FROM users").Scan(&count); err != nil {
+		t.Fatalf("count users: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("got %d users, want 3", count)
+	}
+}
+
+type timestamps struct {
+	CreatedAt time.Time
+}
+
+type comment struct {
+	ID     int64
+	UserID int64
+	Body   string
+	timestamps
+}
+
+func TestFactory_UntaggedFields(t *testing.T) {
+	di := brrr.Default().Instance(t)
+	ctx := t.Context()
+	_, err := di.Connection.Exec(ctx, `
+		CREATE TABLE comments (id bigserial PRIMARY KEY, user_id bigint NOT NULL, body text NOT NULL,
+			created_at timestamptz NOT NULL DEFAULT now())`)
+	if err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+
+	comments := &brrr.Factory[comment]{Table: "comments"}
+	created, err := comments.Create(ctx, di, func(c *comment) { c.UserID, c.Body = 7, "first" })
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if created.ID == 0 || created.UserID != 7 || created.Body != "first" || created.CreatedAt.IsZero() {
+		t.Errorf("got %+v, want a generated id, user 7, the body and a defaulted timestamp", created)
+	}
+}
@@ -0,0 +1,108 @@
+package brrr
+
+import (
+	"fmt"
+	"strings"
+)
+
+var (
+	fakeFirstNames = []string{"Alice", "Bob", "Carla", "David", "Emma", "Farid", "Greta", "Hiro", "Ines", "Jonas",
+		"Karin", "Liam", "Maja", "Noah", "Olivia", "Per", "Quinn", "Rosa", "Sven", "Tove"}
+	fakeLastNames = []string{"Andersson", "Berg", "Chen", "Dahl", "Eriksson", "Fischer", "Garcia", "Holm", "Ivanova",
+		"Johansson", "Kim", "Lindqvist", "Martin", "Nilsson", "Okafor", "Persson", "Rossi", "Smith", "Tanaka", "Weber"}
+	fakeCities = []string{"Stockholm", "Gothenburg", "Oslo", "Copenhagen", "Helsinki", "Berlin", "Amsterdam", "London",
+		"Paris", "Madrid", "Lisbon", "Vienna", "Prague", "Warsaw", "Dublin"}
+	fakeCountries = []string{"Sweden", "Norway", "Denmark", "Finland", "Germany", "Netherlands", "United Kingdom",
+		"France", "Spain", "Portugal", "Austria", "Czechia", "Poland", "Ireland"}
+	fakeStreets = []string{"Main Street", "Church Road", "Park Avenue", "Station Road", "Mill Lane", "High Street",
+		"Harbour Road", "Birch Way", "Lake View", "King Street"}
+	fakeCompanies = []string{"Acme", "Globex", "Initech", "Umbrella", "Hooli", "Vandelay", "Stark", "Wayne", "Tyrell",
+		"Cyberdyne"}
+	fakeWords = []string{"lorem", "ipsum", "dolor", "sit", "amet", "consectetur", "adipiscing", "elit", "sed", "do",
+		"eiusmod", "tempor", "incididunt", "ut", "labore", "et", "dolore", "magna", "aliqua"}
+)
+
+// fakePick returns an expression picking an element of values for row g.i. The salt varies the pick between
+// columns, so the first and last name of a row are not always the same pair.
+func fakePick(values []string, salt string) string {
+	literals := make([]string, len(values))
+	for i, v := range values {
+		literals[i] = quoteLiteral(v)
+	}
+	return fmt.Sprintf("(ARRAY[%s])[%s %% %d + 1]", strings.Join(literals, ", "), fakeHash(salt), len(values))
+}
+
+// fakeHash returns an expression for a non-negative pseudo-random integer for row g.i, stable between runs.
+func fakeHash(salt string) string {
+	return fmt.Sprintf("(hashtext(g.i::text || %s)::bigint & 2147483647)", quoteLiteral(salt))
+}
+
+// fakeValue returns an expression for a realistic looking value of the column in row g.i, if its name and type
+// suggest what it holds. Values which are likely to be unique, such as emails and usernames, include the row number.
+// Other columns with a unique constraint are left to syntheticValue.
+func (c syntheticColumn) fakeValue() (string, bool) {
+	name := strings.ReplaceAll(strings.ToLower(c.name), "_", "")
+	first, last := fakePick(fakeFirstNames, "first"), fakePick(fakeLastNames, "last")
+
+	var expr string
+	// distinct is set for values including the row number, which can fill columns with unique constraints.
+	var distinct bool
+	switch c.category {
+	case "S":
+		switch {
+		case strings.Contains(name, "email"):
+			expr = fmt.Sprintf("lower(%s || '.' || %s) || g.i || '@example.com'", first, last)
+			distinct = true
+		case name == "firstname" || name == "givenname":
+			expr = first
+		case name == "lastname" || name == "surname" || name == "familyname":
+			expr = last
+		case name == "username" || name == "login" || name == "handle":
+			expr = fmt.Sprintf("lower(%s) || g.i", first)
+			distinct = true
+		case name == "name" || name == "fullname" || name == "displayname":
+			expr = fmt.Sprintf("%s || ' ' || %s", first, last)
+		case strings.Contains(name, "phone") || strings.Contains(name, "mobile"):
+			expr = fmt.Sprintf("'+46 70 ' || lpad((%s %% 10000000)::text, 7, '0')", fakeHash("phone"))
+		case name == "city" || name == "town":
+			expr = fakePick(fakeCities, "city")
+		case name == "country":
+			expr = fakePick(fakeCountries, "country")
+		case name == "street" || strings.Contains(name, "address"):
+			expr = fmt.Sprintf("(%s %% 200 + 1) || ' ' || %s", fakeHash("street"), fakePick(fakeStreets, "street"))
+		case name == "zip" || name == "zipcode" || name == "postalcode" || name == "postcode":
+			expr = fmt.Sprintf("lpad((%s %% 100000)::text, 5, '0')", fakeHash("zip"))
+		case strings.Contains(name, "company") || name == "organization" || name == "organisation":
+			expr = fmt.Sprintf("%s || ' ' || (ARRAY['AB', 'Inc', 'Ltd', 'GmbH'])[%s %% 4 + 1]", fakePick(fakeCompanies, "company"), fakeHash("suffix"))
+		case name == "url" || name == "website" || name == "homepage":
+			expr = fmt.Sprintf("'https://' || lower(%s) || g.i || '.example.com'", fakePick(fakeCompanies, "url"))
+			distinct = true
+		case name == "title" || name == "subject":
+			expr = fmt.Sprintf("initcap(%s || ' ' || %s)", fakePick(fakeWords, "title1"), fakePick(fakeWords, "title2"))
+		case name == "description" || name == "body" || name == "comment" || name == "note" || name == "notes" || name == "text":
+			expr = fmt.Sprintf("initcap(%s) || ' ' || %s || ' ' || %s || ' ' || %s || '.'",
+				fakePick(fakeWords, "text1"), fakePick(fakeWords, "text2"), fakePick(fakeWords, "text3"), fakePick(fakeWords, "text4"))
+		}
+	case "N":
+		switch {
+		case name == "age":
+			expr = fmt.Sprintf("18 + %s %% 70", fakeHash("age"))
+		case name == "price" || name == "amount" || name == "total" || name == "cost" || name == "balance":
+			expr = fmt.Sprintf("round((%s %% 100000) / 100.0, 2)", fakeHash(name))
+		case name == "quantity" || name == "qty":
+			expr = fmt.Sprintf("1 + %s %% 20", fakeHash("quantity"))
+		}
+	case "D":
+		switch {
+		case strings.Contains(name, "birth") || name == "dob":
+			expr = fmt.Sprintf("date '1950-01-01' + (%s %% 20000)::int", fakeHash("birth"))
+		case strings.HasSuffix(name, "at") || strings.HasSuffix(name, "date") || strings.HasSuffix(name, "time"):
+			expr = fmt.Sprintf("timestamp '2024-01-01' - (%s %% 31536000) * interval '1 second'", fakeHash(name))
+		}
+	}
+	// Distinct values could be cut short by the length of the type, which syntheticValue avoids.
+	if expr == "" || (c.unique && (!distinct || c.length > 0)) {
+		return "", false
+	}
+	return fmt.Sprintf("(%s)::%s", expr, c.typ), true
+}
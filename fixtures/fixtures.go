@@ -0,0 +1,242 @@
+// Package fixtures loads declarative YAML or JSON fixtures into brrr databases.
+//
+// A fixture file maps tables to their rows, either as a list or keyed by a label other rows reference them by:
+//
+//	users:
+//	  alice:
+//	    name: Alice
+//	    settings: {theme: dark}
+//	orders:
+//	  - user_id: $users:alice
+//	    placed_at: 2024-01-02T15:04:05Z
+//
+// Values are converted to the column types by postgres, so nested objects can fill json columns and strings any
+// type with a text representation. A string of the form $table:label is replaced by the primary key of the row with
+// the label, and $table:label.column by its column, which must have been inserted before, in the same or an earlier
+// file. Strings starting with $$ are inserted with the first dollar sign removed.
+//
+// Rows are inserted in the order of the files, ordered by name, and of the tables and rows in them. Columns left
+// out of a row get their default, so generated keys can be referenced through labels.
+package fixtures
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/modfin/brrr"
+	"gopkg.in/yaml.v3"
+)
+
+// Load inserts the fixtures of the .yaml, .yml and .json files in the root of fsys using conn, in one transaction.
+func Load(ctx context.Context, conn *pgx.Conn, fsys fs.FS) error {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		switch path.Ext(entry.Name()) {
+		case ".yaml", ".yml", ".json":
+			if !entry.IsDir() {
+				files = append(files, entry.Name())
+			}
+		}
+	}
+	sort.Strings(files)
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	l := loader{tx: tx, rows: map[string]map[string]any{}, keys: map[string]string{}}
+	for _, name := range files {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return fmt.Errorf("failed to read file %s: %w", name, err)
+		}
+		if err := l.loadFile(ctx, data); err != nil {
+			return fmt.Errorf("failed to load fixtures of %s: %w", name, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit fixtures: %w", err)
+	}
+	return nil
+}
+
+// Template returns a function loading the fixtures of fsys into the template, for Config.SeedFuncCtx.
+func Template(fsys fs.FS) func(ctx context.Context, conn *pgx.Conn, connStr string) error {
+	return func(ctx context.Context, conn *pgx.Conn, _ string) error {
+		return Load(ctx, conn, fsys)
+	}
+}
+
+// Instance returns an option loading the fixtures of fsys into a single instance, on top of the template.
+func Instance(fsys fs.FS) brrr.InstanceOption {
+	return brrr.WithSeedFunc(func(ctx context.Context, conn *pgx.Conn) error {
+		return Load(ctx, conn, fsys)
+	})
+}
+
+// loader inserts fixtures, remembering the labelled rows for references.
+type loader struct {
+	tx pgx.Tx
+	// rows are the inserted labelled rows, keyed by table and label separated by a colon.
+	rows map[string]map[string]any
+	// keys are the primary key columns of the tables referenced so far.
+	keys map[string]string
+}
+
+func (l *loader) loadFile(ctx context.Context, data []byte) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	tables := doc.Content[0]
+	if tables.Kind != yaml.MappingNode {
+		return errors.New("fixtures must map tables to their rows")
+	}
+
+	for i := 0; i < len(tables.Content); i += 2 {
+		table, rows := tables.Content[i].Value, tables.Content[i+1]
+		switch rows.Kind {
+		case yaml.SequenceNode:
+			for _, row := range rows.Content {
+				if err := l.insert(ctx, table, "", row); err != nil {
+					return err
+				}
+			}
+		case yaml.MappingNode:
+			for j := 0; j < len(rows.Content); j += 2 {
+				if err := l.insert(ctx, table, rows.Content[j].Value, rows.Content[j+1]); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("rows of table %s must be a list or a mapping of labels to rows", table)
+		}
+	}
+	return nil
+}
+
+// insert inserts the row of node into table, and remembers it by label unless that is empty.
+func (l *loader) insert(ctx context.Context, table, label string, node *yaml.Node) error {
+	var row map[string]any
+	if err := node.Decode(&row); err != nil {
+		return fmt.Errorf("failed to decode row %s of table %s: %w", label, table, err)
+	}
+
+	columns := make([]string, 0, len(row))
+	for column, value := range row {
+		resolved, err := l.resolve(ctx, value)
+		if err != nil {
+			return fmt.Errorf("row %s of table %s: %w", label, table, err)
+		}
+		row[column] = resolved
+		columns = append(columns, pgx.Identifier{column}.Sanitize())
+	}
+	sort.Strings(columns)
+
+	values, err := json.Marshal(row)
+	if err != nil {
+		return fmt.Errorf("failed to encode row %s of table %s: %w", label, table, err)
+	}
+
+	// The row is converted to the column types by jsonb_populate_record, and only the given columns are inserted so
+	// the others get their defaults.
+	ident := tableIdentifier(table).Sanitize()
+	list := strings.Join(columns, ", ")
+	sql := fmt.Sprintf("INSERT INTO %s AS r DEFAULT VALUES RETURNING to_jsonb(r)", ident)
+	var args []any
+	if len(columns) > 0 {
+		sql = fmt.Sprintf("INSERT INTO %s AS r (%s) SELECT %s FROM jsonb_populate_record(NULL::%s, $1) RETURNING to_jsonb(r)", ident, list, list, ident)
+		args = []any{string(values)}
+	}
+
+	var inserted map[string]any
+	if err := l.tx.QueryRow(ctx, sql, args...).Scan(&inserted); err != nil {
+		return fmt.Errorf("failed to insert row %s into %s: %w", label, table, err)
+	}
+	if label != "" {
+		l.rows[table+":"+label] = inserted
+	}
+	return nil
+}
+
+// resolve returns value with references replaced by the values they refer to.
+func (l *loader) resolve(ctx context.Context, value any) (any, error) {
+	s, ok := value.(string)
+	if !ok || !strings.HasPrefix(s, "$") {
+		return value, nil
+	}
+	if strings.HasPrefix(s, "$$") {
+		return s[1:], nil
+	}
+
+	table, label, ok := strings.Cut(s[1:], ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid reference %q, want $table:label or $table:label.column", s)
+	}
+	label, column, hasColumn := strings.Cut(label, ".")
+	row, ok := l.rows[table+":"+label]
+	if !ok {
+		return nil, fmt.Errorf("reference %q to a row which is not inserted yet", s)
+	}
+
+	if !hasColumn {
+		var err error
+		if column, err = l.primaryKey(ctx, table); err != nil {
+			return nil, fmt.Errorf("reference %q: %w", s, err)
+		}
+	}
+	v, ok := row[column]
+	if !ok {
+		return nil, fmt.Errorf("reference %q to a column which does not exist", s)
+	}
+	return v, nil
+}
+
+// primaryKey returns the column of the single column primary key of table.
+func (l *loader) primaryKey(ctx context.Context, table string) (string, error) {
+	if key, ok := l.keys[table]; ok {
+		return key, nil
+	}
+
+	rows, err := l.tx.Query(ctx, `
+		SELECT a.attname
+		FROM pg_index i
+		JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY (i.indkey)
+		WHERE i.indrelid = $1::regclass AND i.indisprimary`, tableIdentifier(table).Sanitize())
+	if err != nil {
+		return "", fmt.Errorf("failed to look up primary key of %s: %w", table, err)
+	}
+	keys, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return "", fmt.Errorf("failed to look up primary key of %s: %w", table, err)
+	}
+	if len(keys) != 1 {
+		return "", fmt.Errorf("table %s has no single column primary key, reference a column with $table:label.column", table)
+	}
+
+	l.keys[table] = keys[0]
+	return keys[0], nil
+}
+
+// tableIdentifier returns the identifier of table, which may be qualified with its schema.
+func tableIdentifier(table string) pgx.Identifier {
+	return pgx.Identifier(strings.Split(table, "."))
+}
@@ -0,0 +1,87 @@
+package fixtures_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/modfin/brrr"
+	"github.com/modfin/brrr/fixtures"
+)
+
+var schema = fstest.MapFS{"01_schema.sql": {Data: []byte(`
+	CREATE TABLE users (id serial PRIMARY KEY, name text NOT NULL, settings jsonb);
+	CREATE TABLE orders (
+		id serial PRIMARY KEY,
+		user_id int NOT NULL REFERENCES users,
+		total numeric NOT NULL,
+		placed_at timestamptz NOT NULL DEFAULT now(),
+		note text
+	);`)}}
+
+func newContainer(t *testing.T, database string) *brrr.Container {
+	t.Helper()
+
+	c, err := brrr.NewContainer(brrr.Config{
+		User:        "postgres",
+		Password:    "postgres",
+		Database:    database,
+		SeedFS:      schema,
+		SeedFuncCtx: fixtures.Template(os.DirFS("testdata")),
+	})
+	if err != nil {
+		t.Fatalf("NewContainer: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestTemplate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	c := newContainer(t, "brrr_fixtures")
+	di, err := c.NewInstance(ctx)
+	if err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+	defer c.CloseInstance(context.Background(), di)
+
+	var aliceOrders, bobOrders int
+	if err := di.Connection.QueryRow(ctx, `
+		SELECT count(*) FILTER (WHERE u.name = 'Alice' AND o.placed_at = '2024-01-02T15:04:05Z'),
+		       count(*) FILTER (WHERE u.name = 'Bob' AND o.note = '$5 off')
+		FROM orders o JOIN users u ON u.id = o.user_id`).Scan(&aliceOrders, &bobOrders); err != nil {
+		t.Fatalf("count orders: %v", err)
+	}
+	if aliceOrders != 1 || bobOrders != 1 {
+		t.Errorf("got %d orders of Alice and %d of Bob, want 1 of each", aliceOrders, bobOrders)
+	}
+
+	var theme string
+	if err := di.Connection.QueryRow(ctx, "SELECT settings->>'theme' FROM users WHERE name = 'Alice'").Scan(&theme); err != nil {
+		t.Fatalf("select settings: %v", err)
+	}
+	if theme != "dark" {
+		t.Errorf("got theme %q, want dark", theme)
+	}
+}
+
+func TestInstance_UnknownReference(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	c := newContainer(t, "brrr_fixtures_ref")
+	_, err := c.NewInstance(ctx, fixtures.Instance(fstest.MapFS{
+		"orders.yaml": {Data: []byte("orders:\n  - user_id: $users:carol\n    total: 1\n")},
+	}))
+	if err == nil {
+		t.Fatal("NewInstance succeeded with a reference to a missing row")
+	}
+	if !strings.Contains(err.Error(), "$users:carol") {
+		t.Errorf("error does not name the reference: %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+// Package goose registers the brrr.Goose migration tool, which runs pressly/goose migrations:
+//
+//	import _ "github.com/modfin/brrr/goose"
+package goose
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/modfin/brrr"
+	pgoose "github.com/pressly/goose/v3"
+)
+
+func init() {
+	brrr.RegisterMigrationTool(brrr.Goose, open)
+}
+
+// steps steps through goose migrations.
+type steps struct {
+	db       *sql.DB
+	provider *pgoose.Provider
+}
+
+func open(_ context.Context, dsn string, fsys fs.FS) (brrr.MigrationSteps, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database connection: %w", err)
+	}
+
+	provider, err := pgoose.NewProvider(pgoose.DialectPostgres, db, fsys)
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to load goose migrations: %w", err)
+	}
+	return &steps{db: db, provider: provider}, nil
+}
+
+func (s *steps) Up(ctx context.Context) (uint64, bool, error) {
+	res, err := s.provider.UpByOne(ctx)
+	var partial *pgoose.PartialError
+	if errors.As(err, &partial) && partial.Failed != nil && partial.Failed.Source != nil {
+		return 0, false, &brrr.MigrationError{Version: uint64(partial.Failed.Source.Version), File: partial.Failed.Source.Path, Err: partial.Err}
+	}
+	return gooseResult(res, err)
+}
+
+func (s *steps) Down(ctx context.Context) (uint64, bool, error) {
+	return gooseResult(s.provider.Down(ctx))
+}
+
+func gooseResult(res *pgoose.MigrationResult, err error) (uint64, bool, error) {
+	if errors.Is(err, pgoose.ErrNoNextVersion) {
+		return 0, true, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to run goose migration: %w", err)
+	}
+	return uint64(res.Source.Version), false, nil
+}
+
+func (s *steps) Close() error {
+	return errors.Join(s.provider.Close(), s.db.Close())
+}
@@ -0,0 +1,34 @@
+package brrr
+
+import (
+	"context"
+	"fmt"
+)
+
+// Healthy verifies that the postgres server is running, the admin pool can reach the server and the template
+// database is still flagged as a template. The returned error names the first check that failed.
+func (c *Container) Healthy(ctx context.Context) error {
+	if err := c.server.healthy(ctx); err != nil {
+		return err
+	}
+
+	if err := c.pool.Ping(ctx); err != nil {
+		return fmt.Errorf("failed to reach database server: %w", err)
+	}
+
+	template := c.cfg.Database
+	if c.snapshot != nil {
+		template = snapshotName(c.cfg)
+	}
+
+	var isTemplate bool
+	err := c.pool.QueryRow(ctx, "SELECT datistemplate FROM pg_database WHERE datname = $1", template).Scan(&isTemplate)
+	if err != nil {
+		return fmt.Errorf("failed to look up template database %s: %w", template, err)
+	}
+	if !isTemplate {
+		return fmt.Errorf("database %s is not flagged as a template", template)
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package brrr
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Hook is called at a point of the template lifecycle with a superuser connection to the database being built.
+// conn.Config().ConnString() is its DSN.
+type Hook func(ctx context.Context, conn *pgx.Conn) error
+
+// InstanceHook is called around the lifecycle of the instance database name, with a superuser connection to the
+// maintenance database of the server.
+type InstanceHook func(ctx context.Context, conn *pgx.Conn, name string) error
+
+// runHook calls hook, if set, with a connection to cfg.Database. point names the hook in errors.
+func runHook(ctx context.Context, cfg Config, point string, hook Hook) error {
+	if hook == nil {
+		return nil
+	}
+
+	conn, err := pgx.Connect(ctx, cfg.url("postgres", cfg.Database))
+	if err != nil {
+		return fmt.Errorf("failed to connect to database for %s: %w", point, err)
+	}
+	defer conn.Close(context.Background())
+
+	if err := hook(ctx, conn); err != nil {
+		return fmt.Errorf("%s failed: %w", point, err)
+	}
+	return nil
+}
+
+// runInstanceHook calls hook, if set, for the instance database name with conn. point names the hook in errors.
+func runInstanceHook(ctx context.Context, conn *pgx.Conn, point string, hook InstanceHook, name string) error {
+	if hook == nil {
+		return nil
+	}
+	if err := hook(ctx, conn, name); err != nil {
+		return fmt.Errorf("%s failed for %s: %w", point, name, err)
+	}
+	return nil
+}
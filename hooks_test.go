@@ -0,0 +1,116 @@
+package brrr_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/modfin/brrr"
+)
+
+func TestConfig_Hooks(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	var calls []string
+	hook := func(point string) brrr.Hook {
+		return func(ctx context.Context, conn *pgx.Conn) error {
+			calls = append(calls, point)
+			return nil
+		}
+	}
+	instanceHook := func(point string) brrr.InstanceHook {
+		return func(ctx context.Context, conn *pgx.Conn, name string) error {
+			var exists bool
+			err := conn.QueryRow(ctx, "SELECT EXISTS (SELECT FROM pg_database WHERE datname = $1)", name).Scan(&exists)
+			if exists {
+				t.Errorf("%s: database %s exists", point, name)
+			}
+			calls = append(calls, point)
+			return err
+		}
+	}
+
+	c := newContainer(t, sharedServer(brrr.Config{
+		Database: "brrr_hooks",
+		BeforeMigrate: func(ctx context.Context, conn *pgx.Conn) error {
+			calls = append(calls, "BeforeMigrate")
+			_, err := conn.Exec(ctx, "CREATE EXTENSION IF NOT EXISTS citext")
+			return err
+		},
+		AfterMigrate:         hook("AfterMigrate"),
+		BeforeSeed:           hook("BeforeSeed"),
+		TemplateFinalize:     hook("TemplateFinalize"),
+		AfterTemplateReady:   hook("AfterTemplateReady"),
+		BeforeInstanceCreate: instanceHook("BeforeInstanceCreate"),
+		AfterInstanceDrop:    instanceHook("AfterInstanceDrop"),
+		SeedFS: fstest.MapFS{
+			"01_users.sql": {Data: []byte("CREATE TABLE users (email citext PRIMARY KEY);")},
+		},
+	}))
+
+	di, err := c.NewInstance(ctx)
+	if err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+	if err := c.CloseInstance(ctx, di); err != nil {
+		t.Fatalf("CloseInstance: %v", err)
+	}
+
+	want := []string{"BeforeMigrate", "AfterMigrate", "BeforeSeed", "TemplateFinalize", "AfterTemplateReady",
+		"BeforeInstanceCreate", "AfterInstanceDrop"}
+	if !slices.Equal(calls, want) {
+		t.Errorf("got hooks called in order %v, want %v", calls, want)
+	}
+}
+
+func TestConfig_TemplateFinalize(t *testing.T) {
+	c := newContainer(t, sharedServer(brrr.Config{
+		Database: "brrr_finalize",
+		SeedFS: fstest.MapFS{
+			"01_audit.sql": {Data: []byte(`
+				CREATE TABLE ddl_log (command text);
+				CREATE FUNCTION log_ddl() RETURNS event_trigger LANGUAGE plpgsql AS $$
+				BEGIN
+					INSERT INTO ddl_log VALUES (tg_tag);
+				END $$;`)},
+		},
+		// Event triggers require a superuser, which migrations may not run as.
+		TemplateFinalize: func(ctx context.Context, conn *pgx.Conn) error {
+			_, err := conn.Exec(ctx, "CREATE EVENT TRIGGER log_ddl ON ddl_command_end EXECUTE FUNCTION log_ddl()")
+			return err
+		},
+	}))
+
+	di := c.Instance(t)
+	ctx := context.Background()
+	if _, err := di.Connection.Exec(ctx, "CREATE TABLE things (id int)"); err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+	var command string
+	if err := di.Connection.QueryRow(ctx, "SELECT command FROM ddl_log").Scan(&command); err != nil {
+		t.Fatalf("expected the event trigger of the template in the instance: %v", err)
+	}
+	if command != "CREATE TABLE" {
+		t.Errorf("expected CREATE TABLE to be logged, got %s", command)
+	}
+
+	failed, err := brrr.NewContainer(sharedServer(brrr.Config{
+		Database: "brrr_finalize_failed",
+		TemplateFinalize: func(context.Context, *pgx.Conn) error {
+			return errors.New("finalize failed")
+		},
+	}))
+	if err == nil {
+		failed.Close()
+		t.Fatal("NewContainer succeeded although TemplateFinalize failed")
+	}
+	if !strings.Contains(err.Error(), "finalize failed") {
+		t.Errorf("expected the error of TemplateFinalize, got %v", err)
+	}
+}
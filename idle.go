@@ -0,0 +1,44 @@
+package brrr
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// applicationName identifies the connections brrr makes itself in pg_stat_activity.
+const applicationName = "brrr"
+
+// WaitForIdle blocks until no connections other than brrr's own remain to any existing instance database, so
+// suites can let background goroutines of the code under test finish before closing instances and the container.
+func (c *Container) WaitForIdle(ctx context.Context) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		c.mu.Lock()
+		names := make([]string, 0, len(c.instances))
+		for name := range c.instances {
+			names = append(names, name)
+		}
+		c.mu.Unlock()
+
+		var busy int
+		err := c.pool.QueryRow(ctx, `
+			SELECT count(*) FROM pg_stat_activity
+			WHERE datname = ANY($1) AND application_name <> $2 AND pid <> pg_backend_pid()`,
+			names, applicationName).Scan(&busy)
+		if err != nil {
+			return fmt.Errorf("failed to list connections: %w", err)
+		}
+		if busy == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d connections still open: %w", busy, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
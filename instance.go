@@ -0,0 +1,133 @@
+package brrr
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// resetsKey is the key of the PgConn custom data holding the DatabaseInstance.resets a DB connection was made at.
+const resetsKey = "brrr.resets"
+
+// Close closes the connections to the instance and drops its database, like CloseInstance on the container it
+// was created by.
+func (di *DatabaseInstance) Close(ctx context.Context) error {
+	return di.container.CloseInstance(ctx, di)
+}
+
+// DB returns a database/sql handle for the instance database, backed by the pgx stdlib driver, for code written
+// against database/sql. It is opened on first use and closed by CloseInstance.
+func (di *DatabaseInstance) DB() *sql.DB {
+	di.dbMu.Lock()
+	defer di.dbMu.Unlock()
+	if di.db == nil {
+		connCfg := di.Connection.Config()
+		// Connections of the code under test are not brrr's own, see WaitForIdle.
+		delete(connCfg.RuntimeParams, "application_name")
+		di.db = stdlib.OpenDB(*connCfg,
+			stdlib.OptionAfterConnect(func(_ context.Context, conn *pgx.Conn) error {
+				conn.PgConn().CustomData()[resetsKey] = di.resets.Load()
+				return nil
+			}),
+			// Connections made before Reset point at the dropped database, so they are replaced.
+			stdlib.OptionResetSession(func(_ context.Context, conn *pgx.Conn) error {
+				if conn.PgConn().CustomData()[resetsKey] != di.resets.Load() {
+					return driver.ErrBadConn
+				}
+				return nil
+			}),
+		)
+	}
+	return di.db
+}
+
+// Reset drops the instance database and clones it from the template again under the same name, so one instance
+// can be reused across subtests without a NewInstance and CloseInstance round trip. Name, ConnectionInfo, URL and
+// DSN stay the same. Connection is replaced by a new connection, while Pool and the handle returned by DB are kept
+// and reconnect on their next use. Reset must not be called while the instance is in use.
+func (di *DatabaseInstance) Reset(ctx context.Context) error {
+	return di.container.resetInstance(ctx, di)
+}
+
+// resetInstance implements DatabaseInstance.Reset.
+func (c *Container) resetInstance(ctx context.Context, di *DatabaseInstance) error {
+	if err := di.Connection.Close(ctx); err != nil {
+		return fmt.Errorf("failed to close database connection: %w", err)
+	}
+	di.resets.Add(1)
+	if di.Pool != nil {
+		di.Pool.Reset()
+	}
+
+	if c.snapshot != nil {
+		if err := c.snapshot.Restore(ctx); err != nil {
+			return fmt.Errorf("failed to restore database from snapshot: %w", err)
+		}
+	} else if err := c.recreateDatabase(ctx, di); err != nil {
+		return err
+	}
+
+	cfg := c.cfg
+	cfg.User, cfg.Password = di.info.User, di.info.Password
+	conn, err := c.connect(ctx, cfg.url("postgres", di.Name), di.opts.tracer)
+	if err != nil {
+		return err
+	}
+	di.Connection = conn
+	return nil
+}
+
+// recreateDatabase drops the database of di and creates it again, with the options di was created with.
+func (c *Container) recreateDatabase(ctx context.Context, di *DatabaseInstance) error {
+	conn, err := c.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	_, err = conn.Exec(ctx, fmt.Sprintf("DROP DATABASE %s WITH (FORCE)", pgx.Identifier{di.Name}.Sanitize()))
+	if isUndefinedDatabase(err) {
+		return fmt.Errorf("failed to drop database: %w: %w", ErrInstanceNotFound, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to drop database: %w", err)
+	}
+	if err := c.createInstanceDatabase(ctx, conn, di.opts, di.Name); err != nil {
+		return err
+	}
+	if di.role {
+		return grantInstanceRole(ctx, c.cfg, conn, di.Name)
+	}
+	return nil
+}
+
+// closeDB closes the handle opened by DB, if any.
+func (di *DatabaseInstance) closeDB() error {
+	di.dbMu.Lock()
+	defer di.dbMu.Unlock()
+	if di.db == nil {
+		return nil
+	}
+	return di.db.Close()
+}
+
+// openInstancePool opens the pool requested with WithPool to connStr.
+func openInstancePool(ctx context.Context, connStr string, o instanceOptions) (*pgxpool.Pool, error) {
+	poolCfg, err := pgxpool.ParseConfig(connStr)
+	if err != nil {
+		return nil, err
+	}
+	poolCfg.MaxConns = o.poolMaxConns
+	poolCfg.ConnConfig.Tracer = o.tracer
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open instance pool: %w", err)
+	}
+	return pool, nil
+}
@@ -0,0 +1,44 @@
+package brrr
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestDatabaseInstance_DB_ConcurrentClose(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+	go servePostgres(l)
+
+	conn, err := pgx.Connect(t.Context(), connStr(l.Addr().(*net.TCPAddr).Port))
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer conn.Close(context.Background())
+
+	// The TTL reaper closes instances concurrently with the test using them.
+	for i := range 20 {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			di := &DatabaseInstance{Connection: conn}
+			var wg sync.WaitGroup
+			wg.Go(func() { di.DB() })
+			wg.Go(func() {
+				if err := di.closeDB(); err != nil {
+					t.Errorf("closeDB: %v", err)
+				}
+			})
+			wg.Wait()
+			if err := di.closeDB(); err != nil {
+				t.Errorf("closeDB: %v", err)
+			}
+		})
+	}
+}
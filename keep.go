@@ -0,0 +1,40 @@
+package brrr
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// keepInstance closes the connections of the instance of a failed test without dropping its database, see
+// Config.KeepOnFailure.
+func (c *Container) keepInstance(di *DatabaseInstance) {
+	if c.snapshot != nil {
+		// The restored database is left as is until the next instance is restored.
+		_ = c.closeRestoredInstance(context.Background(), di)
+		return
+	}
+
+	if di.reaper != nil {
+		di.reaper.Stop()
+	}
+	if c.untrack(di.Name) {
+		c.releaseInstance()
+	}
+	_ = di.closeDB()
+	if di.Pool != nil {
+		di.Pool.Close()
+	}
+	_ = di.Connection.Close(context.Background())
+}
+
+// keep leaves the container of failed tests running instead of terminating it, and prints how to reach it, see
+// Config.KeepOnFailure.
+func (c *Container) keep() {
+	id := "unknown"
+	if docker, ok := c.server.(*dockerServer); ok {
+		id = docker.container.GetContainerID()
+	}
+	fmt.Fprintf(os.Stderr, "brrr: tests failed, keeping container %s with the template at %s\n", id, c.cfg.url("postgres", c.cfg.Database))
+	fmt.Fprintf(os.Stderr, "brrr: remove it with docker rm -f %s\n", id)
+}
@@ -0,0 +1,85 @@
+package brrr_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/moby/moby/client"
+	"github.com/modfin/brrr"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+// failedTest is a test which reports having failed, and runs its cleanups when asked to.
+type failedTest struct {
+	*testing.T
+	cleanups []func()
+}
+
+func (f *failedTest) Failed() bool        { return true }
+func (f *failedTest) Cleanup(fn func())   { f.cleanups = append(f.cleanups, fn) }
+func (f *failedTest) Logf(string, ...any) {}
+
+func TestConfig_KeepOnFailure(t *testing.T) {
+	ctx := context.Background()
+	name := "brrr-keep-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	cli, err := testcontainers.NewDockerClientWithOpts(ctx)
+	if err != nil {
+		t.Fatalf("docker client: %v", err)
+	}
+	defer cli.Close()
+	t.Cleanup(func() {
+		_, _ = cli.ContainerRemove(context.Background(), name, client.ContainerRemoveOptions{Force: true})
+	})
+
+	c, err := brrr.NewContainer(brrr.Config{
+		Database:      "brrr_keep",
+		ContainerName: name,
+		KeepOnFailure: true,
+	})
+	if err != nil {
+		t.Fatalf("NewContainer: %v", err)
+	}
+
+	failed := &failedTest{T: t}
+	di := c.Instance(failed)
+	url := di.URL()
+	for i := len(failed.cleanups) - 1; i >= 0; i-- {
+		failed.cleanups[i]()
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	conn, err := pgx.Connect(ctx, url)
+	if err != nil {
+		t.Fatalf("expected the database of the failed test to be kept: %v", err)
+	}
+	conn.Close(ctx)
+}
+
+func TestDatabaseInstance_DumpOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	failed := &failedTest{T: t}
+	di := brrr.Default().Instance(failed)
+	di.DumpOnFailure(failed, dir)
+	if _, err := di.Connection.Exec(context.Background(), "CREATE TABLE evidence (id int); INSERT INTO evidence VALUES (42);"); err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+	for i := len(failed.cleanups) - 1; i >= 0; i-- {
+		failed.cleanups[i]()
+	}
+
+	dump, err := os.ReadFile(filepath.Join(dir, t.Name()+"_"+di.Name+".sql"))
+	if err != nil {
+		t.Fatalf("read dump: %v", err)
+	}
+	if !strings.Contains(string(dump), "CREATE TABLE public.evidence") {
+		t.Errorf("expected the dump to contain the table of the failed test")
+	}
+}
@@ -0,0 +1,223 @@
+// Package kubernetes registers the brrr.Kubernetes backend, which runs postgres in a pod provisioned through the
+// Kubernetes API, for test processes running in-cluster:
+//
+//	import _ "github.com/modfin/brrr/kubernetes"
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/modfin/brrr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+func init() {
+	brrr.RegisterBackend(brrr.Kubernetes, start)
+}
+
+// server is a postgres server running in a pod provisioned through the Kubernetes API.
+// The pod is reached on its pod IP, so the test process is expected to run inside the cluster.
+type server struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+	ip        string
+	// stopLogs stops following the log of the pod, nil without Config.LogOutput
+	stopLogs context.CancelFunc
+}
+
+// start connects to the cluster of the configured kubeconfig and starts the server in it.
+func start(ctx context.Context, cfg brrr.Config, spec brrr.ServerSpec) (brrr.Server, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if cfg.KubeConfig != "" {
+		rules.ExplicitPath = cfg.KubeConfig
+	}
+	// Falls back to the in-cluster service account when no kubeconfig is found.
+	clientCfg := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{})
+
+	restCfg, err := clientCfg.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubernetes config: %w", err)
+	}
+
+	namespace := cfg.KubeNamespace
+	if namespace == "" {
+		namespace, _, err = clientCfg.Namespace()
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve kubernetes namespace: %w", err)
+		}
+	}
+
+	client, err := kubernetes.NewForConfig(restCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	return startServer(ctx, client, namespace, cfg, spec)
+}
+
+// startServer creates the postgres pod in namespace and waits for it to become ready.
+func startServer(ctx context.Context, client kubernetes.Interface, namespace string, cfg brrr.Config, spec brrr.ServerSpec) (*server, error) {
+	start := time.Now()
+	pod, err := client.CoreV1().Pods(namespace).Create(ctx, postgresPod(cfg, spec), metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create postgres pod: %w", err)
+	}
+
+	s := &server{client: client, namespace: namespace, name: pod.Name}
+
+	err = wait.PollUntilContextTimeout(ctx, 500*time.Millisecond, spec.StartupTimeout, true, func(ctx context.Context) (bool, error) {
+		pod, err := client.CoreV1().Pods(namespace).Get(ctx, s.name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if pod.Status.Phase == corev1.PodFailed || pod.Status.Phase == corev1.PodSucceeded {
+			return false, fmt.Errorf("pod exited with phase %s", pod.Status.Phase)
+		}
+		s.ip = pod.Status.PodIP
+		return podReady(pod) && s.ip != "", nil
+	})
+	if err != nil {
+		_ = s.Terminate(context.Background())
+		return nil, fmt.Errorf("failed waiting for postgres pod %s/%s: %w", namespace, s.name, err)
+	}
+	spec.Started(namespace+"/"+s.name, start)
+
+	if spec.LogOutput != nil {
+		var logCtx context.Context
+		logCtx, s.stopLogs = context.WithCancel(context.Background())
+		go s.followLogs(logCtx, spec)
+	}
+
+	return s, nil
+}
+
+// postgresPod describes a pod equivalent to the docker test container, data directory in memory included.
+func postgresPod(cfg brrr.Config, spec brrr.ServerSpec) *corev1.Pod {
+	labels := spec.Labels
+	labels["app.kubernetes.io/managed-by"] = "brrr"
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "brrr-",
+			Labels:       labels,
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyNever,
+			Containers: []corev1.Container{{
+				Name:  "postgres",
+				Image: spec.Image,
+				Args:  append([]string{"postgres"}, spec.Args...),
+				Env: []corev1.EnvVar{
+					{Name: "POSTGRES_DB", Value: cfg.Database},
+					{Name: "POSTGRES_USER", Value: cfg.User},
+					{Name: "POSTGRES_PASSWORD", Value: cfg.Password},
+					{Name: "PGDATA", Value: "/var/lib/pg/data"},
+					{Name: "POSTGRES_INITDB_ARGS", Value: spec.InitdbArgs},
+					{Name: "TZ", Value: cfg.Timezone},
+				},
+				Ports: []corev1.ContainerPort{{Name: "postgres", ContainerPort: 5432}},
+				// Probing over TCP skips the temporary socket-only server the entrypoint runs during initdb.
+				ReadinessProbe: &corev1.Probe{
+					ProbeHandler: corev1.ProbeHandler{
+						Exec: &corev1.ExecAction{Command: []string{"pg_isready", "-h", "127.0.0.1", "-U", cfg.User, "-d", cfg.Database}},
+					},
+					PeriodSeconds: 1,
+				},
+				VolumeMounts: []corev1.VolumeMount{{Name: "pgdata", MountPath: "/var/lib/pg/data"}},
+			}},
+			Volumes: []corev1.Volume{{
+				Name: "pgdata",
+				VolumeSource: corev1.VolumeSource{
+					EmptyDir: &corev1.EmptyDirVolumeSource{Medium: corev1.StorageMediumMemory},
+				},
+			}},
+		},
+	}
+	if cfg.ContainerName != "" {
+		pod.GenerateName, pod.Name = "", cfg.ContainerName
+	}
+	setPodResources(cfg, pod)
+	return pod
+}
+
+// setPodResources applies the resource limits of cfg to the postgres container of pod.
+func setPodResources(cfg brrr.Config, pod *corev1.Pod) {
+	c := &pod.Spec.Containers[0]
+	if cfg.MemoryLimit != 0 || cfg.CPULimit != 0 {
+		c.Resources.Limits = corev1.ResourceList{}
+	}
+	if cfg.MemoryLimit != 0 {
+		c.Resources.Limits[corev1.ResourceMemory] = *resource.NewQuantity(cfg.MemoryLimit, resource.BinarySI)
+	}
+	if cfg.CPULimit != 0 {
+		c.Resources.Limits[corev1.ResourceCPU] = *resource.NewMilliQuantity(int64(cfg.CPULimit*1000), resource.DecimalSI)
+	}
+
+	// Pods get a 64MB /dev/shm from the runtime, so a larger one is mounted from memory.
+	if cfg.ShmSize != 0 {
+		c.VolumeMounts = append(c.VolumeMounts, corev1.VolumeMount{Name: "shm", MountPath: "/dev/shm"})
+		pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+			Name: "shm",
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{
+					Medium:    corev1.StorageMediumMemory,
+					SizeLimit: resource.NewQuantity(cfg.ShmSize, resource.BinarySI),
+				},
+			},
+		})
+	}
+}
+
+func podReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func (s *server) Endpoint(context.Context) (string, int, error) {
+	return s.ip, 5432, nil
+}
+
+func (s *server) Internal(context.Context) (string, map[string][]string, error) {
+	return s.ip, nil, nil
+}
+
+func (s *server) Healthy(ctx context.Context) error {
+	pod, err := s.client.CoreV1().Pods(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get pod %s/%s: %w", s.namespace, s.name, err)
+	}
+	if !podReady(pod) {
+		return fmt.Errorf("pod %s/%s is not ready (phase %s)", s.namespace, s.name, pod.Status.Phase)
+	}
+	return nil
+}
+
+// followLogs copies the log of the pod to Config.LogOutput until ctx is cancelled or the pod is gone.
+func (s *server) followLogs(ctx context.Context, spec brrr.ServerSpec) {
+	stream, err := s.client.CoreV1().Pods(s.namespace).GetLogs(s.name, &corev1.PodLogOptions{Container: "postgres", Follow: true}).Stream(ctx)
+	if err != nil {
+		spec.Logger.Warn("Failed to follow the log of the postgres pod", "pod", s.name, "error", err)
+		return
+	}
+	defer stream.Close()
+	_, _ = io.Copy(spec.LogOutput, stream)
+}
+
+func (s *server) Terminate(ctx context.Context) error {
+	if s.stopLogs != nil {
+		s.stopLogs()
+	}
+	var grace int64
+	return s.client.CoreV1().Pods(s.namespace).Delete(ctx, s.name, metav1.DeleteOptions{GracePeriodSeconds: &grace})
+}
@@ -0,0 +1,120 @@
+package kubernetes
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modfin/brrr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// fakeCluster returns a fake clientset whose pods are scheduled with the phase and conditions set by schedule.
+func fakeCluster(schedule func(pod *corev1.Pod)) *fake.Clientset {
+	client := fake.NewClientset()
+	client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		pod := action.(k8stesting.CreateAction).GetObject().(*corev1.Pod)
+		if pod.Name == "" {
+			pod.Name = pod.GenerateName + "test"
+		}
+		schedule(pod)
+		return false, pod, nil
+	})
+	return client
+}
+
+func testSpec() brrr.ServerSpec {
+	return brrr.ServerSpec{
+		Image:          "postgres:17.2",
+		Args:           []string{"-c", "max_connections=1000"},
+		InitdbArgs:     "--locale=C",
+		Labels:         map[string]string{"brrr": "true"},
+		StartupTimeout: 5 * time.Second,
+		Logger:         slog.New(slog.DiscardHandler),
+	}
+}
+
+func TestStartServer(t *testing.T) {
+	ctx := context.Background()
+	client := fakeCluster(func(pod *corev1.Pod) {
+		pod.Status.Phase = corev1.PodRunning
+		pod.Status.PodIP = "10.0.0.7"
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	})
+
+	cfg := brrr.Config{
+		User:        "postgres",
+		Password:    "postgres",
+		Database:    "brrr_kubernetes",
+		MemoryLimit: 1 << 30,
+		CPULimit:    1.5,
+		ShmSize:     256 << 20,
+	}
+	s, err := startServer(ctx, client, "ci", cfg, testSpec())
+	if err != nil {
+		t.Fatalf("startServer: %v", err)
+	}
+
+	host, port, err := s.Endpoint(ctx)
+	if err != nil || host != "10.0.0.7" || port != 5432 {
+		t.Errorf("Endpoint = %s, %d, %v, want 10.0.0.7, 5432", host, port, err)
+	}
+	if err := s.Healthy(ctx); err != nil {
+		t.Errorf("Healthy: %v", err)
+	}
+
+	pod, err := client.CoreV1().Pods("ci").Get(ctx, s.name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if pod.Labels["brrr"] != "true" || pod.Labels["app.kubernetes.io/managed-by"] != "brrr" {
+		t.Errorf("labels = %v", pod.Labels)
+	}
+	c := pod.Spec.Containers[0]
+	if want := []string{"postgres", "-c", "max_connections=1000"}; !slices.Equal(c.Args, want) {
+		t.Errorf("args = %v, want %v", c.Args, want)
+	}
+	if !slices.Contains(c.Env, corev1.EnvVar{Name: "POSTGRES_DB", Value: "brrr_kubernetes"}) ||
+		!slices.Contains(c.Env, corev1.EnvVar{Name: "POSTGRES_INITDB_ARGS", Value: "--locale=C"}) {
+		t.Errorf("env = %v", c.Env)
+	}
+	if memory := c.Resources.Limits[corev1.ResourceMemory]; memory.Value() != 1<<30 {
+		t.Errorf("memory limit = %s, want 1Gi", memory.String())
+	}
+	if cpu := c.Resources.Limits[corev1.ResourceCPU]; cpu.MilliValue() != 1500 {
+		t.Errorf("cpu limit = %s, want 1500m", cpu.String())
+	}
+	if !slices.ContainsFunc(c.VolumeMounts, func(m corev1.VolumeMount) bool { return m.MountPath == "/dev/shm" }) {
+		t.Errorf("volume mounts = %v, want /dev/shm", c.VolumeMounts)
+	}
+
+	if err := s.Terminate(ctx); err != nil {
+		t.Fatalf("Terminate: %v", err)
+	}
+	if _, err := client.CoreV1().Pods("ci").Get(ctx, s.name, metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("Get after Terminate = %v, want not found", err)
+	}
+}
+
+func TestStartServer_PodFailed(t *testing.T) {
+	ctx := context.Background()
+	client := fakeCluster(func(pod *corev1.Pod) {
+		pod.Status.Phase = corev1.PodFailed
+	})
+
+	_, err := startServer(ctx, client, "ci", brrr.Config{ContainerName: "brrr-failed"}, testSpec())
+	if err == nil || !strings.Contains(err.Error(), "phase Failed") {
+		t.Fatalf("startServer = %v, want an error about the failed pod", err)
+	}
+	if _, err := client.CoreV1().Pods("ci").Get(ctx, "brrr-failed", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("Get = %v, want the failed pod to be deleted", err)
+	}
+}
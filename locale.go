@@ -0,0 +1,68 @@
+package brrr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// initdbArgs returns the arguments of initdb selecting the configured locale, encoding and collation.
+func (cfg Config) initdbArgs() string {
+	var args []string
+	if cfg.Locale != "" {
+		args = append(args, "--locale="+cfg.Locale)
+	}
+	if cfg.Encoding != "" {
+		args = append(args, "--encoding="+cfg.Encoding)
+	}
+	if cfg.Collation != "" {
+		args = append(args, "--lc-collate="+cfg.Collation)
+	}
+	return strings.Join(args, " ")
+}
+
+// createDatabaseOptions returns the options of CREATE DATABASE selecting the configured locale, encoding and
+// collation, for servers which were not initialized with them. Databases can only differ from the server's
+// defaults when created from template0.
+func (cfg Config) createDatabaseOptions() string {
+	if cfg.Locale == "" && cfg.Encoding == "" && cfg.Collation == "" {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString(" TEMPLATE template0")
+	// LOCALE sets both LC_COLLATE and LC_CTYPE and can't be combined with either, so the locale only sets the
+	// latter when a collation is given.
+	switch {
+	case cfg.Locale != "" && cfg.Collation != "":
+		fmt.Fprintf(&b, " LC_CTYPE %s", quoteLiteral(cfg.Locale))
+	case cfg.Locale != "":
+		fmt.Fprintf(&b, " LOCALE %s", quoteLiteral(cfg.Locale))
+	}
+	if cfg.Encoding != "" {
+		fmt.Fprintf(&b, " ENCODING %s", quoteLiteral(cfg.Encoding))
+	}
+	if cfg.Collation != "" {
+		fmt.Fprintf(&b, " LC_COLLATE %s", quoteLiteral(cfg.Collation))
+	}
+	return b.String()
+}
+
+// migrateOptions returns o with the configured locale, encoding and collation as defaults, and the template
+// instances are created from with Migrate isolation. Databases differing from the server's defaults are created
+// from template0, the others from template1.
+func (cfg Config) migrateOptions(o instanceOptions) (instanceOptions, string) {
+	if o.encoding == "" {
+		o.encoding = cfg.Encoding
+	}
+	if o.lcCollate == "" && o.lcCtype == "" {
+		o.lcCtype = cfg.Locale
+		o.lcCollate = cfg.Locale
+		if cfg.Collation != "" {
+			o.lcCollate = cfg.Collation
+		}
+	}
+	if o.encoding != "" || o.lcCollate != "" || o.lcCtype != "" || o.icuLocale != "" {
+		return o, "template0"
+	}
+	return o, "template1"
+}
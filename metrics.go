@@ -0,0 +1,91 @@
+package brrr
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// cloneBuckets are the upper bounds of Metrics.CloneBuckets, doubling from 5ms to about 10s.
+var cloneBuckets = [...]time.Duration{
+	5 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 80 * time.Millisecond,
+	160 * time.Millisecond, 320 * time.Millisecond, 640 * time.Millisecond, 1280 * time.Millisecond,
+	2560 * time.Millisecond, 5120 * time.Millisecond, 10240 * time.Millisecond,
+}
+
+// metrics count the instances of a container and the time taken to clone them, see Container.Metrics.
+type metrics struct {
+	created atomic.Int64
+	dropped atomic.Int64
+
+	mu        sync.Mutex
+	clones    uint64
+	cloneTime time.Duration
+	// buckets counts the clones per bucket of cloneBuckets, not cumulatively
+	buckets [len(cloneBuckets)]uint64
+}
+
+// observeClone records a clone of the template which took d.
+func (m *metrics) observeClone(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clones++
+	m.cloneTime += d
+	for i, bound := range cloneBuckets {
+		if d <= bound {
+			m.buckets[i]++
+			break
+		}
+	}
+}
+
+// Metrics are the counters of a container, see Container.Metrics.
+type Metrics struct {
+	// Database is the name of the template database.
+	Database string
+
+	InstancesCreated int64
+	InstancesDropped int64
+	// InstancesActive is the number of instances not yet closed.
+	InstancesActive int
+
+	// Clones is the number of times the template was cloned, and CloneTime the total time taken.
+	Clones    uint64
+	CloneTime time.Duration
+	// CloneBuckets counts the clones which took at most the key, cumulatively like a prometheus histogram, for
+	// bounds doubling from 5ms to about 10s.
+	CloneBuckets map[time.Duration]uint64
+
+	// Pool is the state of brrr's admin connection pool, e.g. to spot contention for it.
+	Pool *pgxpool.Stat
+}
+
+// Metrics returns the instances created and dropped, the time taken to clone the template, the number of active
+// instances and the contention of brrr's admin connection pool, e.g. to graph the churn of test databases in nightly
+// suites. They are exported to prometheus by the collector of github.com/modfin/brrr/metrics.
+func (c *Container) Metrics() Metrics {
+	c.mu.Lock()
+	active := len(c.instances)
+	c.mu.Unlock()
+
+	m := Metrics{
+		Database:         c.cfg.Database,
+		InstancesCreated: c.metrics.created.Load(),
+		InstancesDropped: c.metrics.dropped.Load(),
+		InstancesActive:  active,
+		CloneBuckets:     make(map[time.Duration]uint64, len(cloneBuckets)),
+		Pool:             c.pool.Stat(),
+	}
+
+	c.metrics.mu.Lock()
+	defer c.metrics.mu.Unlock()
+	m.Clones, m.CloneTime = c.metrics.clones, c.metrics.cloneTime
+	var count uint64
+	for i, bound := range cloneBuckets {
+		count += c.metrics.buckets[i]
+		m.CloneBuckets[bound] = count
+	}
+	return m
+}
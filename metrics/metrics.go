@@ -0,0 +1,78 @@
+// Package metrics exports the metrics of a brrr.Container to prometheus, so only importers of this package depend
+// on the prometheus client.
+package metrics
+
+import (
+	"github.com/modfin/brrr"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// collector is the prometheus collector of a container, see NewCollector.
+type collector struct {
+	c *brrr.Container
+
+	created          *prometheus.Desc
+	dropped          *prometheus.Desc
+	clone            *prometheus.Desc
+	active           *prometheus.Desc
+	acquires         *prometheus.Desc
+	emptyAcquires    *prometheus.Desc
+	acquireDuration  *prometheus.Desc
+	acquiredConns    *prometheus.Desc
+	maxConns         *prometheus.Desc
+	canceledAcquires *prometheus.Desc
+}
+
+// NewCollector returns a prometheus collector of brrr.Container.Metrics. Metrics are labeled with the template
+// database name, so collectors of several containers can be registered with the same registry.
+func NewCollector(c *brrr.Container) prometheus.Collector {
+	labels := prometheus.Labels{"database": c.Metrics().Database}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc("brrr_"+name, help, nil, labels)
+	}
+
+	return &collector{
+		c:                c,
+		created:          desc("instances_created_total", "Number of instances created."),
+		dropped:          desc("instances_dropped_total", "Number of instance databases dropped."),
+		clone:            desc("clone_duration_seconds", "Time taken to clone the template into an instance database."),
+		active:           desc("instances_active", "Number of instances not yet closed."),
+		acquires:         desc("admin_pool_acquires_total", "Number of connections acquired from the admin pool."),
+		emptyAcquires:    desc("admin_pool_empty_acquires_total", "Number of admin pool acquires which had to wait for a connection."),
+		acquireDuration:  desc("admin_pool_acquire_seconds_total", "Total time spent acquiring connections from the admin pool."),
+		acquiredConns:    desc("admin_pool_acquired_connections", "Number of admin pool connections currently in use."),
+		maxConns:         desc("admin_pool_max_connections", "Maximum number of admin pool connections."),
+		canceledAcquires: desc("admin_pool_canceled_acquires_total", "Number of admin pool acquires cancelled by their context."),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (m *collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{m.created, m.dropped, m.clone, m.active, m.acquires, m.emptyAcquires,
+		m.acquireDuration, m.acquiredConns, m.maxConns, m.canceledAcquires} {
+		ch <- desc
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (m *collector) Collect(ch chan<- prometheus.Metric) {
+	metrics := m.c.Metrics()
+	ch <- prometheus.MustNewConstMetric(m.created, prometheus.CounterValue, float64(metrics.InstancesCreated))
+	ch <- prometheus.MustNewConstMetric(m.dropped, prometheus.CounterValue, float64(metrics.InstancesDropped))
+
+	buckets := make(map[float64]uint64, len(metrics.CloneBuckets))
+	for bound, count := range metrics.CloneBuckets {
+		buckets[bound.Seconds()] = count
+	}
+	ch <- prometheus.MustNewConstHistogram(m.clone, metrics.Clones, metrics.CloneTime.Seconds(), buckets)
+
+	ch <- prometheus.MustNewConstMetric(m.active, prometheus.GaugeValue, float64(metrics.InstancesActive))
+
+	stat := metrics.Pool
+	ch <- prometheus.MustNewConstMetric(m.acquires, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(m.emptyAcquires, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(m.acquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(m.acquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(m.maxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(m.canceledAcquires, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+}
@@ -0,0 +1,73 @@
+package metrics_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/modfin/brrr"
+	"github.com/modfin/brrr/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestNewCollector(t *testing.T) {
+	c, err := brrr.NewContainer(brrr.Config{
+		User:     "postgres",
+		Password: "postgres",
+		Database: "brrr_metrics",
+		SeedPath: "../testdata/seed",
+	})
+	if err != nil {
+		t.Fatalf("NewContainer: %v", err)
+	}
+	defer c.Close()
+
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(metrics.NewCollector(c)); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	ctx := context.Background()
+	di, err := c.NewInstance(ctx)
+	if err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+	if _, err := c.NewInstance(ctx); err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+	if err := c.CloseInstance(ctx, di); err != nil {
+		t.Fatalf("CloseInstance: %v", err)
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	values := map[string]float64{}
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			switch {
+			case m.GetCounter() != nil:
+				values[family.GetName()] = m.GetCounter().GetValue()
+			case m.GetGauge() != nil:
+				values[family.GetName()] = m.GetGauge().GetValue()
+			case m.GetHistogram() != nil:
+				values[family.GetName()] = float64(m.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+
+	want := map[string]float64{
+		"brrr_instances_created_total": 2,
+		"brrr_instances_dropped_total": 1,
+		"brrr_clone_duration_seconds":  2,
+		"brrr_instances_active":        1,
+	}
+	for name, value := range want {
+		if values[name] != value {
+			t.Errorf("%s = %v, want %v", name, values[name], value)
+		}
+	}
+	if values["brrr_admin_pool_acquires_total"] < 3 {
+		t.Errorf("brrr_admin_pool_acquires_total = %v, want at least 3", values["brrr_admin_pool_acquires_total"])
+	}
+}
@@ -0,0 +1,128 @@
+package brrr_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/modfin/brrr"
+	_ "github.com/modfin/brrr/goose"
+	_ "github.com/modfin/brrr/tern"
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddNamedMigrationContext("00002_insert_widget.go", func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "INSERT INTO widgets (id, name) VALUES (1, 'sprocket')")
+		return err
+	}, nil)
+}
+
+func TestConfig_MigrationTool_Goose(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	c := newContainer(t, sharedServer(brrr.Config{
+		Database:       "brrr_goose",
+		MigrationsPath: "testdata/goose",
+		MigrationTool:  brrr.Goose,
+	}))
+
+	di := c.Instance(t)
+	var name string
+	if err := di.Connection.QueryRow(ctx, "SELECT name FROM widgets WHERE id = 1").Scan(&name); err != nil {
+		t.Fatalf("query migrated table: %v", err)
+	}
+	if name != "sprocket" {
+		t.Errorf("got name %q, want %q", name, "sprocket")
+	}
+	if got := len(c.Report().Migrations); got != 2 {
+		t.Errorf("report has %d migrations, want 2", got)
+	}
+}
+
+func TestConfig_MigrationTool_Tern(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	c := newContainer(t, sharedServer(brrr.Config{
+		Database:       "brrr_tern",
+		MigrationsPath: "testdata/tern",
+		MigrationTool:  brrr.Tern,
+	}))
+
+	di := c.Instance(t)
+	var name string
+	if err := di.Connection.QueryRow(ctx, "SELECT name FROM gadgets WHERE id = 1").Scan(&name); err != nil {
+		t.Fatalf("query migrated table: %v", err)
+	}
+	if name != "widget" {
+		t.Errorf("got name %q, want %q", name, "widget")
+	}
+	if got := len(c.Report().Migrations); got != 2 {
+		t.Errorf("report has %d migrations, want 2", got)
+	}
+}
+
+func TestConfig_MigrationTool_Dbmate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	c := newContainer(t, sharedServer(brrr.Config{
+		Database:       "brrr_dbmate",
+		MigrationsPath: "testdata/dbmate",
+		MigrationTool:  brrr.Dbmate,
+	}))
+
+	di := c.Instance(t)
+	var name string
+	if err := di.Connection.QueryRow(ctx, "SELECT name FROM gizmos WHERE id = 1").Scan(&name); err != nil {
+		t.Fatalf("query migrated table: %v", err)
+	}
+	if name != "doohickey" {
+		t.Errorf("got name %q, want %q", name, "doohickey")
+	}
+
+	rows, err := di.Connection.Query(ctx, "SELECT version FROM schema_migrations ORDER BY version")
+	if err != nil {
+		t.Fatalf("query schema_migrations: %v", err)
+	}
+	versions, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		t.Fatalf("query schema_migrations: %v", err)
+	}
+	if len(versions) != 2 || versions[0] != "20240101120000" || versions[1] != "20240102120000" {
+		t.Errorf("got versions %v, want both migrations recorded", versions)
+	}
+}
+
+func TestConfig_Migrator(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	var migrated bool
+	c := newContainer(t, sharedServer(brrr.Config{
+		Database: "brrr_migrator",
+		Migrator: brrr.MigratorFunc(func(ctx context.Context, dsn string) error {
+			conn, err := pgx.Connect(ctx, dsn)
+			if err != nil {
+				return err
+			}
+			defer conn.Close(context.Background())
+
+			migrated = true
+			_, err = conn.Exec(ctx, "CREATE TABLE things (id int PRIMARY KEY)")
+			return err
+		}),
+	}))
+
+	if !migrated {
+		t.Fatal("Migrator was not called")
+	}
+	di := c.Instance(t)
+	if _, err := di.Connection.Exec(ctx, "INSERT INTO things VALUES (1)"); err != nil {
+		t.Errorf("insert into migrated table: %v", err)
+	}
+}
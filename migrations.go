@@ -0,0 +1,281 @@
+package brrr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/pgx/v5"
+	"github.com/golang-migrate/migrate/v4/source"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// MigrationTool selects the tool running the migrations of the template database.
+type MigrationTool string
+
+const (
+	// GolangMigrate runs golang-migrate migrations, pairs of <version>_<name>.up.sql and .down.sql files.
+	GolangMigrate MigrationTool = "golang-migrate"
+	// Goose runs pressly/goose migrations, SQL files annotated with -- +goose Up, together with the Go migrations
+	// registered in goose's global registry, e.g. with goose.AddMigrationContext. It is registered by importing
+	// github.com/modfin/brrr/goose.
+	Goose MigrationTool = "goose"
+	// Tern runs jackc/tern migrations, numbered SQL files with the down migration below a
+	// ---- create above / drop below ---- line. It is registered by importing github.com/modfin/brrr/tern.
+	Tern MigrationTool = "tern"
+	// Dbmate runs dbmate migrations, SQL files with -- migrate:up and -- migrate:down sections. Applied versions are
+	// recorded in schema_migrations like dbmate does.
+	Dbmate MigrationTool = "dbmate"
+)
+
+// migrationTool returns the configured migration tool, or the default one.
+func (cfg Config) migrationTool() MigrationTool {
+	if cfg.MigrationTool == "" {
+		return GolangMigrate
+	}
+	return cfg.MigrationTool
+}
+
+// targetReached reports whether version, the migration version just applied, is the MigrationTargetVersion, so
+// migrating stops. Going past the target means no migration has its version.
+func (cfg Config) targetReached(version uint64) (bool, error) {
+	target := uint64(cfg.MigrationTargetVersion)
+	switch {
+	case target == 0 || version < target:
+		return false, nil
+	case version == target:
+		return true, nil
+	default:
+		return false, cfg.targetNotFound()
+	}
+}
+
+// targetNotFound is the error for a MigrationTargetVersion no migration has.
+func (cfg Config) targetNotFound() error {
+	return fmt.Errorf("migration target version %d not found", cfg.MigrationTargetVersion)
+}
+
+// Migrator migrates a database with a mechanism of the user's choosing, see Config.Migrator.
+type Migrator interface {
+	// Migrate migrates the database at dsn, a postgres:// URL with superuser credentials.
+	Migrate(ctx context.Context, dsn string) error
+}
+
+// MigratorFunc adapts a function to the Migrator interface.
+type MigratorFunc func(ctx context.Context, dsn string) error
+
+func (f MigratorFunc) Migrate(ctx context.Context, dsn string) error {
+	return f(ctx, dsn)
+}
+
+// MigrationSteps applies the migrations of a migration tool to a database one at a time, so progress can be
+// reported per migration.
+type MigrationSteps interface {
+	// Up applies the next migration and returns its version, or done when all are applied. A failed migration is
+	// reported as a *MigrationError.
+	Up(ctx context.Context) (version uint64, done bool, err error)
+	// Down reverts the last applied migration and returns its version, or done when none are applied.
+	Down(ctx context.Context) (version uint64, done bool, err error)
+	Close() error
+}
+
+// MigrationToolFunc opens the migrations in fsys to apply them to the database at dsn, a postgres:// URL with
+// superuser credentials.
+type MigrationToolFunc func(ctx context.Context, dsn string, fsys fs.FS) (MigrationSteps, error)
+
+var (
+	migrationToolsMu sync.RWMutex
+	migrationTools   = map[MigrationTool]MigrationToolFunc{}
+)
+
+// RegisterMigrationTool makes a migration tool available to Config.MigrationTool. It is called from the init
+// function of the package implementing the tool, so only importers of that package pay for its dependencies. Like
+// sql.Register, it panics if open is nil or tool is registered twice.
+func RegisterMigrationTool(tool MigrationTool, open MigrationToolFunc) {
+	migrationToolsMu.Lock()
+	defer migrationToolsMu.Unlock()
+	if open == nil {
+		panic("brrr: RegisterMigrationTool open is nil")
+	}
+	if _, dup := migrationTools[tool]; dup || tool == GolangMigrate || tool == Dbmate {
+		panic("brrr: RegisterMigrationTool called twice for migration tool " + string(tool))
+	}
+	migrationTools[tool] = open
+}
+
+// registeredMigrationTool returns the open function registered for tool.
+func registeredMigrationTool(tool MigrationTool) (MigrationToolFunc, error) {
+	migrationToolsMu.RLock()
+	defer migrationToolsMu.RUnlock()
+	open, ok := migrationTools[tool]
+	switch {
+	case ok:
+		return open, nil
+	case tool == Goose || tool == Tern:
+		return nil, fmt.Errorf("the %s migration tool is not registered, import github.com/modfin/brrr/%s", tool, tool)
+	default:
+		return nil, fmt.Errorf("unknown migration tool %q", tool)
+	}
+}
+
+// openMigrationSteps opens the configured migration tool against the database of cfg.
+func openMigrationSteps(ctx context.Context, cfg Config) (MigrationSteps, error) {
+	tool := cfg.migrationTool()
+	if tool == GolangMigrate {
+		return openGolangMigrate(cfg)
+	}
+
+	fsys, err := sourceFS(cfg, cfg.MigrationsFS, cfg.MigrationsPath)
+	if err != nil {
+		return nil, err
+	}
+	if tool == Dbmate {
+		return openDbmate(ctx, cfg, fsys)
+	}
+	open, err := registeredMigrationTool(tool)
+	if err != nil {
+		return nil, err
+	}
+	return open(ctx, cfg.url("postgres", cfg.Database), fsys)
+}
+
+// runMigrations migrates the template database with the configured Migrator or migration tool.
+func runMigrations(ctx context.Context, cfg Config) (err error) {
+	ctx, span := cfg.startSpan(ctx, "brrr.migrate", databaseAttr(cfg.Database), attribute.String("brrr.migration_tool", string(cfg.migrationTool())))
+	defer func() { endSpan(span, err) }()
+
+	if cfg.Migrator != nil {
+		start := time.Now()
+		if err := cfg.Migrator.Migrate(ctx, cfg.url("postgres", cfg.Database)); err != nil {
+			return &MigrationError{Err: err}
+		}
+		cfg.progress(StageMigration, "", start)
+		return nil
+	}
+
+	steps, err := openMigrationSteps(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := steps.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	for {
+		start := time.Now()
+		version, done, err := steps.Up(ctx)
+		if err != nil {
+			var migrationErr *MigrationError
+			if !errors.As(err, &migrationErr) {
+				err = &MigrationError{Err: err}
+			}
+			return err
+		}
+		if done {
+			break
+		}
+		cfg.progress(StageMigration, strconv.FormatUint(version, 10), start)
+
+		if reached, err := cfg.targetReached(version); reached || err != nil {
+			return err
+		}
+	}
+	if cfg.MigrationTargetVersion != 0 {
+		return cfg.targetNotFound()
+	}
+	return nil
+}
+
+// golangMigrateSteps steps through golang-migrate migrations.
+type golangMigrateSteps struct {
+	m *migrate.Migrate
+	// fsys holds the migration files, to name the file of a failed migration.
+	fsys fs.FS
+}
+
+// openGolangMigrate sets up golang-migrate to migrate the database with the migrations from MigrationsFS or
+// MigrationsPath.
+func openGolangMigrate(cfg Config) (*golangMigrateSteps, error) {
+	if cfg.MigrationsFS != nil {
+		src, err := iofs.New(cfg.MigrationsFS, ".")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migrations: %w", err)
+		}
+		m, err := migrate.NewWithSourceInstance("iofs", src, cfg.url("pgx5", cfg.Database))
+		if err != nil {
+			return nil, err
+		}
+		return &golangMigrateSteps{m: m, fsys: cfg.MigrationsFS}, nil
+	}
+
+	absPath := cfg.MigrationsPath
+	if !filepath.IsAbs(absPath) {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		absPath = filepath.Join(wd, absPath)
+	}
+
+	cfg.logger().Debug("Executing migrations", "path", absPath)
+
+	m, err := migrate.New("file://"+absPath, cfg.url("pgx5", cfg.Database))
+	if err != nil {
+		return nil, err
+	}
+	return &golangMigrateSteps{m: m, fsys: os.DirFS(absPath)}, nil
+}
+
+func (s *golangMigrateSteps) Up(context.Context) (uint64, bool, error) {
+	err := s.m.Steps(1)
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, migrate.ErrNoChange) {
+		return 0, true, nil
+	}
+	if err != nil {
+		// A failed migration leaves the database dirty at its version.
+		version, _, _ := s.m.Version()
+		return 0, false, &MigrationError{Version: uint64(version), File: s.upFile(version), Err: err}
+	}
+	version, _, err := s.m.Version()
+	return uint64(version), false, err
+}
+
+// upFile returns the name of the up migration file of version, or an empty string if it can't be found.
+func (s *golangMigrateSteps) upFile(version uint) string {
+	entries, err := fs.ReadDir(s.fsys, ".")
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		if m, err := source.DefaultParse(entry.Name()); err == nil && m.Version == version && m.Direction == source.Up {
+			return entry.Name()
+		}
+	}
+	return ""
+}
+
+func (s *golangMigrateSteps) Down(context.Context) (uint64, bool, error) {
+	version, _, err := s.m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, true, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return uint64(version), false, s.m.Steps(-1)
+}
+
+func (s *golangMigrateSteps) Close() error {
+	return errors.Join(s.m.Close())
+}
@@ -0,0 +1,147 @@
+package brrr_test
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/modfin/brrr"
+)
+
+//go:embed testdata/migrations
+var migrations embed.FS
+
+func TestConfig_MigrationsFS(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	fsys, err := fs.Sub(migrations, "testdata/migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newContainer(t, sharedServer(brrr.Config{
+		Database:     "brrr_migrations_fs",
+		MigrationsFS: fsys,
+	}))
+
+	di := c.Instance(t)
+	var name string
+	if err := di.Connection.QueryRow(ctx, "SELECT name FROM items WHERE id = 1").Scan(&name); err != nil {
+		t.Fatalf("query migrated table: %v", err)
+	}
+	if name != "first" {
+		t.Errorf("got name %q, want %q", name, "first")
+	}
+	if got := len(c.Report().Migrations); got != 2 {
+		t.Errorf("report has %d migrations, want 2", got)
+	}
+}
+
+func TestConfig_MigrationTargetVersion(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	c := newContainer(t, sharedServer(brrr.Config{
+		Database:               "brrr_migration_target",
+		MigrationsPath:         "testdata/migrations",
+		MigrationTargetVersion: 1,
+	}))
+
+	di := c.Instance(t)
+	var items int
+	if err := di.Connection.QueryRow(ctx, "SELECT count(*) FROM items").Scan(&items); err != nil {
+		t.Fatalf("query migrated table: %v", err)
+	}
+	if items != 0 {
+		t.Errorf("got %d items, want migration 2 not to be applied", items)
+	}
+}
+
+func TestConfig_MigrationTargetVersion_NotFound(t *testing.T) {
+	c, err := brrr.NewContainer(sharedServer(brrr.Config{
+		Database:               "brrr_migration_missing",
+		MigrationsPath:         "testdata/migrations",
+		MigrationTargetVersion: 3,
+	}))
+	if err == nil {
+		c.Close()
+		t.Fatal("NewContainer succeeded with a missing target version")
+	}
+}
+
+func TestConfig_Isolation_Migrate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	c := newContainer(t, sharedServer(brrr.Config{
+		Database:       "brrr_migrate",
+		Isolation:      brrr.Migrate,
+		MigrationsPath: "testdata/migrations",
+	}))
+
+	for range 2 {
+		di := c.Instance(t)
+		var items int
+		if err := di.Connection.QueryRow(ctx, "SELECT count(*) FROM items").Scan(&items); err != nil {
+			t.Fatalf("query migrated table: %v", err)
+		}
+		if items != 1 {
+			t.Errorf("got %d items, want 1", items)
+		}
+
+		var fromTemplate bool
+		err := di.Connection.QueryRow(ctx, "SELECT datistemplate FROM pg_database WHERE datname = 'brrr_migrate'").Scan(&fromTemplate)
+		if err != nil {
+			t.Fatalf("look up template: %v", err)
+		}
+		if fromTemplate {
+			t.Error("a template was built with Migrate isolation")
+		}
+	}
+}
+
+func TestConfig_Isolation_Migrate_Collation(t *testing.T) {
+	c := newContainer(t, sharedServer(brrr.Config{
+		Database:       "brrr_migrate_collation",
+		Isolation:      brrr.Migrate,
+		Collation:      "C",
+		MigrationsPath: "testdata/migrations",
+	}))
+
+	di := c.Instance(t)
+	var collate string
+	if err := di.Connection.QueryRow(t.Context(), "SELECT datcollate FROM pg_database WHERE datname = current_database()").Scan(&collate); err != nil {
+		t.Fatalf("look up collation: %v", err)
+	}
+	if collate != "C" {
+		t.Errorf("got collation %q, want C", collate)
+	}
+}
+
+func TestConfig_MigrationsFS_MigrationError(t *testing.T) {
+	c, err := brrr.NewContainer(sharedServer(brrr.Config{
+		Database: "brrr_migration_error",
+		MigrationsFS: fstest.MapFS{
+			"000001_ok.up.sql":       {Data: []byte("CREATE TABLE a (id int);")},
+			"000001_ok.down.sql":     {Data: []byte("DROP TABLE a;")},
+			"000002_broken.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+			"000002_broken.down.sql": {Data: []byte("")},
+		},
+	}))
+	if err == nil {
+		c.Close()
+		t.Fatal("NewContainer succeeded with a broken migration")
+	}
+
+	var migrationErr *brrr.MigrationError
+	if !errors.As(err, &migrationErr) {
+		t.Fatalf("error is not a MigrationError: %v", err)
+	}
+	if migrationErr.Version != 2 || migrationErr.File != "000002_broken.up.sql" {
+		t.Errorf("got failed migration %d in %q, want 2 in 000002_broken.up.sql", migrationErr.Version, migrationErr.File)
+	}
+}
@@ -0,0 +1,167 @@
+package brrr
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// InstanceOption configures a single database instance created by NewInstance.
+type InstanceOption func(*instanceOptions)
+
+type instanceOptions struct {
+	encoding  string
+	lcCollate string
+	lcCtype   string
+	icuLocale string
+	owner     string
+	connLimit int
+	isoLevel  pgx.TxIsoLevel
+	tracer    pgx.QueryTracer
+
+	poolMaxConns int32
+	template     string
+	ttl          time.Duration
+
+	seedFiles []string
+	seedFuncs []func(ctx context.Context, conn *pgx.Conn) error
+
+	uniqueCredentials bool
+}
+
+// WithEncoding sets the character set encoding of the cloned database.
+//
+// Postgres only allows encodings and locales differing from the template's when cloning template0, so these
+// options are mostly useful to assert on the error, or together with a template built with the same settings.
+func WithEncoding(encoding string) InstanceOption {
+	return func(o *instanceOptions) {
+		o.encoding = encoding
+	}
+}
+
+// WithCollation sets LC_COLLATE and LC_CTYPE of the cloned database. An empty ctype leaves it at the template's.
+func WithCollation(collate, ctype string) InstanceOption {
+	return func(o *instanceOptions) {
+		o.lcCollate = collate
+		o.lcCtype = ctype
+	}
+}
+
+// WithICULocale makes the cloned database use the ICU locale provider with the given locale.
+func WithICULocale(locale string) InstanceOption {
+	return func(o *instanceOptions) {
+		o.icuLocale = locale
+	}
+}
+
+// WithOwner sets the role owning the cloned database.
+func WithOwner(role string) InstanceOption {
+	return func(o *instanceOptions) {
+		o.owner = role
+	}
+}
+
+// WithConnectionLimit creates the cloned database with a CONNECTION LIMIT, so connection leaks in the code under
+// test fail loudly. The connection held by the DatabaseInstance counts towards the limit, and superusers are
+// not subject to it, so the code under test must connect as a regular role.
+func WithConnectionLimit(n int) InstanceOption {
+	return func(o *instanceOptions) {
+		o.connLimit = n
+	}
+}
+
+// WithTxIsoLevel sets the default transaction isolation level of the cloned database, e.g. pgx.Serializable, so
+// code under test runs at the same level as in production, including its serialization failures.
+func WithTxIsoLevel(level pgx.TxIsoLevel) InstanceOption {
+	return func(o *instanceOptions) {
+		o.isoLevel = level
+	}
+}
+
+// WithTracer installs tracer on the instance connection instead of Config.Tracer. A nil tracer disables tracing.
+func WithTracer(tracer pgx.QueryTracer) InstanceOption {
+	return func(o *instanceOptions) {
+		o.tracer = tracer
+	}
+}
+
+// WithPool additionally opens a pool of at most maxConns connections to the cloned database, available as
+// DatabaseInstance.Pool, for code under test which runs queries concurrently.
+func WithPool(maxConns int32) InstanceOption {
+	return func(o *instanceOptions) {
+		o.poolMaxConns = maxConns
+	}
+}
+
+// WithTemplate clones the instance from the template called name in Config.Templates, instead of the default one.
+func WithTemplate(name string) InstanceOption {
+	return func(o *instanceOptions) {
+		o.template = name
+	}
+}
+
+// WithUniqueCredentials creates a dedicated login role with a random password for the instance, with privileges
+// on only its database. The instance connection and ConnectionInfo use the role, so code under test handed its
+// credentials can't reach the databases of other tests.
+func WithUniqueCredentials() InstanceOption {
+	return func(o *instanceOptions) {
+		o.uniqueCredentials = true
+	}
+}
+
+func newInstanceOptions(cfg Config, opts []InstanceOption) instanceOptions {
+	o := instanceOptions{
+		connLimit:         cfg.InstanceConnectionLimit,
+		isoLevel:          cfg.InstanceTxIsoLevel,
+		tracer:            cfg.Tracer,
+		uniqueCredentials: cfg.UniqueCredentials,
+		ttl:               cfg.InstanceTTL,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// createDatabaseSQL returns the statement cloning template into name with the options applied.
+func (o instanceOptions) createDatabaseSQL(name, template string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "CREATE DATABASE %s TEMPLATE %s", pgx.Identifier{name}.Sanitize(), pgx.Identifier{template}.Sanitize())
+	if o.owner != "" {
+		fmt.Fprintf(&b, " OWNER %s", pgx.Identifier{o.owner}.Sanitize())
+	}
+	if o.encoding != "" {
+		fmt.Fprintf(&b, " ENCODING %s", quoteLiteral(o.encoding))
+	}
+	if o.lcCollate != "" {
+		fmt.Fprintf(&b, " LC_COLLATE %s", quoteLiteral(o.lcCollate))
+	}
+	if o.lcCtype != "" {
+		fmt.Fprintf(&b, " LC_CTYPE %s", quoteLiteral(o.lcCtype))
+	}
+	if o.icuLocale != "" {
+		fmt.Fprintf(&b, " LOCALE_PROVIDER icu ICU_LOCALE %s", quoteLiteral(o.icuLocale))
+	}
+	if o.connLimit > 0 {
+		fmt.Fprintf(&b, " CONNECTION LIMIT %d", o.connLimit)
+	}
+	return b.String()
+}
+
+// alterDatabaseSQL returns the statements applying the options which can't be given when creating the database
+// name. The settings apply to connections made after they are executed.
+func (o instanceOptions) alterDatabaseSQL(name string) []string {
+	var stmts []string
+	if o.isoLevel != "" {
+		stmts = append(stmts, fmt.Sprintf("ALTER DATABASE %s SET default_transaction_isolation TO %s", pgx.Identifier{name}.Sanitize(), quoteLiteral(string(o.isoLevel))))
+	}
+	return stmts
+}
+
+// quoteLiteral quotes s as an SQL string literal.
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
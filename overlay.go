@@ -0,0 +1,79 @@
+package brrr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// WithSeedFiles executes the SQL files at paths, in order, in the instance database after it is created, on top of
+// what it got from the template. It keeps the rows only a few tests need out of the shared template.
+func WithSeedFiles(paths ...string) InstanceOption {
+	return func(o *instanceOptions) {
+		o.seedFiles = append(o.seedFiles, paths...)
+	}
+}
+
+// WithSeedFunc calls fn with a connection to the instance database after it is created and the files of
+// WithSeedFiles are executed, on top of what it got from the template.
+func WithSeedFunc(fn func(ctx context.Context, conn *pgx.Conn) error) InstanceOption {
+	return func(o *instanceOptions) {
+		o.seedFuncs = append(o.seedFuncs, fn)
+	}
+}
+
+// NewInstanceWithSeed creates a new database instance like NewInstance, and executes the SQL files at paths in it
+// before returning it. It is short for NewInstance with WithSeedFiles.
+func (c *Container) NewInstanceWithSeed(ctx context.Context, paths ...string) (*DatabaseInstance, error) {
+	return c.NewInstance(ctx, WithSeedFiles(paths...))
+}
+
+// seedInstance applies the seed overlays of o to the database name, as the admin user. The database is dropped
+// again if seeding it fails.
+func (c *Container) seedInstance(ctx context.Context, conn *pgxpool.Conn, o instanceOptions, name string) (err error) {
+	if len(o.seedFiles) == 0 && len(o.seedFuncs) == 0 {
+		return nil
+	}
+	defer func() {
+		if err != nil {
+			_, dropErr := conn.Exec(context.Background(), fmt.Sprintf("DROP DATABASE %s WITH (FORCE)", pgx.Identifier{name}.Sanitize()))
+			err = errors.Join(err, dropErr)
+		}
+	}()
+
+	seedConn, err := c.connect(ctx, c.cfg.url("postgres", name), o.tracer)
+	if err != nil {
+		return err
+	}
+	defer seedConn.Close(context.Background())
+
+	for _, path := range o.seedFiles {
+		err := func() error {
+			f, err := os.Open(path)
+			if err != nil {
+				return fmt.Errorf("failed to read seed file %s: %w", path, err)
+			}
+			defer f.Close()
+
+			r, err := renderSeed(c.cfg, path, f)
+			if err != nil {
+				return err
+			}
+			return executeFile(ctx, seedConn, path, r)
+		}()
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, fn := range o.seedFuncs {
+		if err := fn(ctx, seedConn); err != nil {
+			return fmt.Errorf("failed to seed instance: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package brrr
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Preset configures a Config for a postgres distribution, such as PostGIS, selecting its image and enabling its
+// extensions. Presets are applied in order at setup, and leave fields set in the Config as they are.
+type Preset func(cfg *Config)
+
+// applyPresets returns cfg with its presets applied. Slices and maps are copied before presets add to them, so
+// configs sharing them are not affected.
+func (cfg Config) applyPresets() Config {
+	if len(cfg.Presets) == 0 {
+		return cfg
+	}
+	cfg.Extensions = slices.Clone(cfg.Extensions)
+	cfg.ServerParams = maps.Clone(cfg.ServerParams)
+	for _, preset := range cfg.Presets {
+		preset(&cfg)
+	}
+	return cfg
+}
+
+// presetImage sets the image of cfg unless one is set.
+func presetImage(cfg *Config, image string) {
+	if cfg.Image == "" {
+		cfg.Image = image
+	}
+}
+
+// presetExtensions adds extensions to cfg which it doesn't have yet.
+func presetExtensions(cfg *Config, extensions ...string) {
+	for _, ext := range extensions {
+		if !slices.Contains(cfg.Extensions, ext) {
+			cfg.Extensions = append(cfg.Extensions, ext)
+		}
+	}
+}
+
+// presetServerParam sets the server parameter key of cfg to value unless it is set.
+func presetServerParam(cfg *Config, key, value string) {
+	if _, ok := cfg.ServerParams[key]; ok {
+		return
+	}
+	if cfg.ServerParams == nil {
+		cfg.ServerParams = map[string]string{}
+	}
+	cfg.ServerParams[key] = value
+}
+
+// presetStartupTimeout sets the time the server may take to start for cfg unless it is set.
+func presetStartupTimeout(cfg *Config, timeout time.Duration) {
+	if cfg.StartupTimeout == 0 {
+		cfg.StartupTimeout = timeout
+	}
+}
+
+// PostGIS runs the postgis/postgis image and enables the postgis and postgis_topology extensions in the template.
+// The image initializes PostGIS in the database before it starts accepting connections, so the server is given
+// longer to start. The postgis images are only published for amd64.
+func PostGIS() Preset {
+	return func(cfg *Config) {
+		presetImage(cfg, "postgis/postgis:17-3.5")
+		presetExtensions(cfg, "postgis", "postgis_topology")
+		presetStartupTimeout(cfg, time.Minute)
+	}
+}
+
+// PgVector runs the pgvector/pgvector image and enables the vector extension in the template, for embedding
+// workloads. See VectorDimensions to check the dimensions of seeded vectors.
+func PgVector() Preset {
+	return func(cfg *Config) {
+		presetImage(cfg, "pgvector/pgvector:pg17")
+		presetExtensions(cfg, "vector")
+	}
+}
+
+// VectorDimensions returns a Config.ValidateTemplate query finding the rows of table whose vector column does not
+// have dims dimensions, e.g. seeded embeddings of a different model. Columns declared with dimensions, such as
+// vector(1536), are checked by postgres already, but plain vector columns accept any. table may be qualified with
+// its schema.
+func VectorDimensions(table, column string, dims int) string {
+	col := pgx.Identifier{column}.Sanitize()
+	return fmt.Sprintf("SELECT ctid, vector_dims(%s) AS dims FROM %s WHERE vector_dims(%s) <> %d",
+		col, pgx.Identifier(strings.Split(table, ".")).Sanitize(), col, dims)
+}
+
+// TimescaleDB runs the timescale/timescaledb image with the timescaledb library preloaded and enables the
+// extension in the template, so hypertables can be created. The background workers running policies and
+// continuous aggregates are disabled, as they connect to the template and would keep it from being cloned; tests
+// depending on a job can run it with CALL run_job.
+func TimescaleDB() Preset {
+	return func(cfg *Config) {
+		presetImage(cfg, "timescale/timescaledb:latest-pg17")
+		presetServerParam(cfg, "shared_preload_libraries", "timescaledb")
+		presetServerParam(cfg, "timescaledb.max_background_workers", "0")
+		presetServerParam(cfg, "timescaledb.telemetry_level", "off")
+		presetExtensions(cfg, "timescaledb")
+		presetStartupTimeout(cfg, time.Minute)
+	}
+}
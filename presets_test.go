@@ -0,0 +1,102 @@
+package brrr_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/modfin/brrr"
+)
+
+func TestPostGIS(t *testing.T) {
+	c := newContainer(t, brrr.Config{
+		Database: "brrr_postgis",
+		Presets:  []brrr.Preset{brrr.PostGIS()},
+	})
+
+	di := c.Instance(t)
+	var distance float64
+	err := di.Connection.QueryRow(context.Background(),
+		"SELECT ST_Distance('POINT(0 0)'::geometry, 'POINT(3 4)'::geometry)").Scan(&distance)
+	if err != nil {
+		t.Fatalf("ST_Distance: %v", err)
+	}
+	if distance != 5 {
+		t.Errorf("expected a distance of 5, got %v", distance)
+	}
+	if _, err := di.Connection.Exec(context.Background(), "SELECT topology.CreateTopology('roads', 4326)"); err != nil {
+		t.Errorf("CreateTopology: %v", err)
+	}
+}
+
+func TestPgVector(t *testing.T) {
+	seed := func(ctx context.Context, conn *pgx.Conn, _ string) error {
+		_, err := conn.Exec(ctx, `
+			CREATE TABLE items (id int PRIMARY KEY, embedding vector);
+			INSERT INTO items VALUES (1, '[1,2,3]'), (2, '[4,5,6]');`)
+		return err
+	}
+
+	c := newContainer(t, brrr.Config{
+		Database:         "brrr_pgvector",
+		Presets:          []brrr.Preset{brrr.PgVector()},
+		SeedFuncCtx:      seed,
+		ValidateTemplate: []string{brrr.VectorDimensions("public.items", "embedding", 3)},
+	})
+
+	di := c.Instance(t)
+	var nearest int
+	err := di.Connection.QueryRow(context.Background(), "SELECT id FROM items ORDER BY embedding <-> '[4,5,5]' LIMIT 1").Scan(&nearest)
+	if err != nil {
+		t.Fatalf("nearest neighbour: %v", err)
+	}
+	if nearest != 2 {
+		t.Errorf("expected item 2 to be nearest, got %d", nearest)
+	}
+
+	invalid, err := brrr.NewContainer(brrr.Config{
+		Database:         "brrr_pgvector_invalid",
+		Presets:          []brrr.Preset{brrr.PgVector()},
+		SeedFuncCtx:      seed,
+		ValidateTemplate: []string{brrr.VectorDimensions("items", "embedding", 1536)},
+	})
+	if err == nil {
+		invalid.Close()
+		t.Fatal("NewContainer succeeded with vectors of the wrong dimensions")
+	}
+	if !strings.Contains(err.Error(), "returned 2 rows") {
+		t.Errorf("expected both rows to fail validation, got %v", err)
+	}
+}
+
+func TestTimescaleDB(t *testing.T) {
+	c := newContainer(t, brrr.Config{
+		Database: "brrr_timescale",
+		Presets:  []brrr.Preset{brrr.TimescaleDB()},
+		SeedFuncCtx: func(ctx context.Context, conn *pgx.Conn, _ string) error {
+			_, err := conn.Exec(ctx, `
+				CREATE TABLE metrics (time timestamptz NOT NULL, value double precision);
+				SELECT create_hypertable('metrics', 'time');
+				INSERT INTO metrics VALUES (now(), 1), (now() - interval '30 days', 2);`)
+			return err
+		},
+	})
+
+	// Instances are cloned concurrently, which fails if anything stays connected to the template.
+	for range 3 {
+		t.Run("instance", func(t *testing.T) {
+			t.Parallel()
+
+			di := c.Instance(t)
+			var chunks int
+			err := di.Connection.QueryRow(context.Background(), "SELECT count(*) FROM show_chunks('metrics')").Scan(&chunks)
+			if err != nil {
+				t.Fatalf("show_chunks: %v", err)
+			}
+			if chunks < 2 {
+				t.Errorf("expected the hypertable to have a chunk per row, got %d", chunks)
+			}
+		})
+	}
+}
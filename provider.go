@@ -0,0 +1,13 @@
+package brrr
+
+import "context"
+
+// InstanceProvider creates and removes isolated database instances. It is implemented by Container, so test
+// helpers can accept an InstanceProvider and be unit tested with a fake, or run against alternative backends.
+type InstanceProvider interface {
+	NewInstance(ctx context.Context, opts ...InstanceOption) (*DatabaseInstance, error)
+	CloseInstance(ctx context.Context, di *DatabaseInstance) error
+	Close() error
+}
+
+var _ InstanceProvider = (*Container)(nil)
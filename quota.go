@@ -0,0 +1,118 @@
+package brrr
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// InstanceQuotaWaitForever makes NewInstance wait for an instance to be closed until its context is done, see
+// Config.InstanceQuotaWait.
+const InstanceQuotaWaitForever time.Duration = math.MaxInt64
+
+// QuotaError is returned by NewInstance when Config.MaxInstances instances already exist.
+type QuotaError struct {
+	// Limit is the configured maximum number of instances.
+	Limit int
+	// Holders lists the existing instances as "name (created at file:line)".
+	Holders []string
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("instance quota of %d reached, held by: %s", e.Limit, strings.Join(e.Holders, ", "))
+}
+
+// acquireInstance reserves a slot for a new instance, waiting up to Config.InstanceQuotaWait for one to be freed
+// when the quota is reached, or as long as ctx allows with InstanceQuotaWaitForever.
+func (c *Container) acquireInstance(ctx context.Context) error {
+	if c.slots == nil {
+		return nil
+	}
+
+	select {
+	case c.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if c.cfg.InstanceQuotaWait == InstanceQuotaWaitForever {
+		select {
+		case c.slots <- struct{}{}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if c.cfg.InstanceQuotaWait > 0 {
+		timer := time.NewTimer(c.cfg.InstanceQuotaWait)
+		defer timer.Stop()
+
+		select {
+		case c.slots <- struct{}{}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	return &QuotaError{Limit: c.cfg.MaxInstances, Holders: c.holders()}
+}
+
+// releaseInstance frees a slot reserved with acquireInstance.
+func (c *Container) releaseInstance() {
+	if c.slots != nil {
+		<-c.slots
+	}
+}
+
+// track records that the instance name was created by the code at caller.
+func (c *Container) track(name, caller string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.instances[name] = caller
+}
+
+// untrack forgets the instance name, reporting whether it was tracked.
+func (c *Container) untrack(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.instances[name]
+	delete(c.instances, name)
+	delete(c.ttls, name)
+	return ok
+}
+
+// holders describes every existing instance and where it was created.
+func (c *Container) holders() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	holders := make([]string, 0, len(c.instances))
+	for name, caller := range c.instances {
+		holders = append(holders, fmt.Sprintf("%s (created at %s)", name, caller))
+	}
+	sort.Strings(holders)
+	return holders
+}
+
+// caller returns the file:line of the innermost function outside of brrr on the call stack, which is the code
+// creating an instance, e.g. a test, however many of brrr's own functions are in between.
+func caller() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "github.com/modfin/brrr.") {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
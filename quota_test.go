@@ -0,0 +1,57 @@
+package brrr_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/modfin/brrr"
+)
+
+func TestConfig_MaxInstances_Blocks(t *testing.T) {
+	c := newContainer(t, sharedServer(brrr.Config{
+		Database:          "brrr_quota",
+		MaxInstances:      1,
+		InstanceQuotaWait: brrr.InstanceQuotaWaitForever,
+	}))
+
+	ctx := context.Background()
+	first, err := c.NewInstance(ctx)
+	if err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+
+	created := make(chan error, 1)
+	go func() {
+		di, err := c.NewInstance(ctx)
+		if err == nil {
+			err = c.CloseInstance(ctx, di)
+		}
+		created <- err
+	}()
+
+	select {
+	case err := <-created:
+		t.Fatalf("NewInstance did not wait for the quota, returned %v", err)
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	if err := c.CloseInstance(ctx, first); err != nil {
+		t.Fatalf("CloseInstance: %v", err)
+	}
+	if err := <-created; err != nil {
+		t.Fatalf("NewInstance after the quota was freed: %v", err)
+	}
+
+	timeout, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	held, err := c.NewInstance(ctx)
+	if err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+	defer c.CloseInstance(ctx, held)
+	if _, err := c.NewInstance(timeout); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected NewInstance to wait until its context is done, got %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package brrr
+
+import (
+	"context"
+	"time"
+)
+
+// WithTTL drops the instance once ttl has passed if it hasn't been closed by then, see Config.InstanceTTL.
+func WithTTL(ttl time.Duration) InstanceOption {
+	return func(o *instanceOptions) {
+		o.ttl = ttl
+	}
+}
+
+// startReaper schedules di to be reaped once its TTL has passed.
+func (c *Container) startReaper(di *DatabaseInstance) {
+	if di.opts.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ttls == nil {
+		return
+	}
+	di.reaper = time.AfterFunc(di.opts.ttl, func() { c.reap(di) })
+	c.ttls[di.Name] = di.reaper
+}
+
+// stopReapers stops the timers of all instances with a TTL, so none are reaped once the container is closed.
+func (c *Container) stopReapers() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, timer := range c.ttls {
+		timer.Stop()
+	}
+	c.ttls = nil
+}
+
+// reap force drops the database of di, which was not closed within its TTL, terminating the connections to it.
+// The handles of di are left to CloseInstance, as they may be in use.
+func (c *Container) reap(di *DatabaseInstance) {
+	di.reaped.Store(true)
+
+	c.mu.Lock()
+	created, ok := c.instances[di.Name]
+	// Close may have stopped the timers just as this one fired.
+	closed := c.ttls == nil
+	if ok && !closed {
+		delete(c.instances, di.Name)
+		delete(c.ttls, di.Name)
+	}
+	c.mu.Unlock()
+	if !ok || closed {
+		return
+	}
+	c.releaseInstance()
+
+	logger := c.cfg.logger()
+	logger.Warn("Reaping instance which was not closed within its TTL", "database", di.Name, "ttl", di.opts.ttl, "created_at", created)
+	if err := c.dropInstance(context.Background(), di.Name, di.role); err != nil {
+		logger.Error("Failed to reap instance", "database", di.Name, "error", err)
+	}
+}
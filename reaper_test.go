@@ -0,0 +1,64 @@
+package brrr_test
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modfin/brrr"
+)
+
+func TestWithTTL(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	observer := brrr.Default().Instance(t)
+	di, err := brrr.Default().NewInstance(ctx, brrr.WithTTL(200*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+
+	for {
+		var exists bool
+		err := observer.Connection.QueryRow(ctx, "SELECT EXISTS (SELECT FROM pg_database WHERE datname = $1)", di.Name).Scan(&exists)
+		if err != nil {
+			t.Fatalf("query database: %v", err)
+		}
+		if !exists {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatal("instance was not reaped after its TTL")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	if err := brrr.Default().CloseInstance(ctx, di); err != nil {
+		t.Errorf("CloseInstance of a reaped instance: %v", err)
+	}
+}
+
+func TestWithTTL_StoppedByClose(t *testing.T) {
+	// The server of the shared test container is used externally, so closing the container leaves it running.
+	var logs logBuffer
+	c, err := brrr.NewContainer(sharedServer(brrr.Config{
+		Database: "brrr_ttl_close",
+		Logger:   slog.New(slog.NewTextHandler(&logs, nil)),
+	}))
+	if err != nil {
+		t.Fatalf("NewContainer: %v", err)
+	}
+
+	if _, err := c.NewInstance(t.Context(), brrr.WithTTL(200*time.Millisecond)); err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+	_ = c.Close()
+
+	time.Sleep(400 * time.Millisecond)
+	if strings.Contains(logs.String(), "Reaping instance") {
+		t.Error("instance was reaped after Close")
+	}
+}
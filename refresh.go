@@ -0,0 +1,106 @@
+package brrr
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// RefreshTemplate rebuilds the template databases from scratch with the migrations, seeds and the rest of the
+// Config, without restarting the server, e.g. after the migrations changed in a long-lived container. Instances
+// created meanwhile wait for the refresh to finish, existing instances are left as they are. Not supported with
+// Restore or Migrate isolation.
+func (c *Container) RefreshTemplate(ctx context.Context) error {
+	return c.refreshTemplate(ctx, func(ctx context.Context) error {
+		cfg := c.cfg
+		ident := pgx.Identifier{cfg.Database}.Sanitize()
+		for _, stmt := range []string{
+			fmt.Sprintf("ALTER DATABASE %s is_template=false", ident),
+			fmt.Sprintf("DROP DATABASE %s WITH (FORCE)", ident),
+			fmt.Sprintf("CREATE DATABASE %s%s", ident, cfg.createDatabaseOptions()),
+		} {
+			if _, err := c.pool.Exec(ctx, stmt); err != nil {
+				return fmt.Errorf("failed to recreate template database: %w", err)
+			}
+		}
+
+		if err := populateDatabase(ctx, cfg, c.server); err != nil {
+			return err
+		}
+		if err := buildTemplates(ctx, cfg, c.server, c.pool); err != nil {
+			return err
+		}
+		if !cfg.reusesTemplate() {
+			return nil
+		}
+		fp, err := fingerprint(cfg)
+		if err != nil {
+			return err
+		}
+		return markReusable(ctx, cfg, c.pool, fp)
+	})
+}
+
+// RefreshTemplateWith updates the template database in place by calling fn with a connection to it, without
+// rebuilding it, e.g. to apply a single new migration. It is otherwise like RefreshTemplate, except that a
+// template updated this way no longer matches its Config, so it is built again by the next run with Config.Reuse or
+// the External backend.
+func (c *Container) RefreshTemplateWith(ctx context.Context, fn func(ctx context.Context, conn *pgx.Conn) error) error {
+	return c.refreshTemplate(ctx, func(ctx context.Context) error {
+		ident := pgx.Identifier{c.cfg.Database}.Sanitize()
+		if _, err := c.pool.Exec(ctx, fmt.Sprintf("ALTER DATABASE %s is_template=false", ident)); err != nil {
+			return fmt.Errorf("failed to unflag template: %w", err)
+		}
+		// The mark is replaced before fn changes the template, as no fingerprint matches it afterwards.
+		if c.cfg.reusesTemplate() {
+			if err := markReusable(ctx, c.cfg, c.pool, modifiedFingerprint); err != nil {
+				return err
+			}
+		}
+
+		conn, err := pgx.Connect(ctx, c.cfg.url("postgres", c.cfg.Database))
+		if err != nil {
+			return fmt.Errorf("failed to connect to template database: %w", err)
+		}
+		defer conn.Close(context.Background())
+
+		if err := fn(ctx, conn); err != nil {
+			return fmt.Errorf("failed to refresh template: %w", err)
+		}
+		return nil
+	})
+}
+
+// modifiedFingerprint marks templates updated by RefreshTemplateWith. It never matches the hex fingerprint of a
+// Config, while keeping the template recognizable as built by brrr.
+const modifiedFingerprint = "modified"
+
+// refreshTemplate holds back clones while update changes the template database, then freezes and flags it as a
+// template again.
+func (c *Container) refreshTemplate(ctx context.Context, update func(ctx context.Context) error) error {
+	switch c.cfg.isolation() {
+	case Restore, Migrate:
+		return fmt.Errorf("refreshing the template is not supported with %s isolation", c.cfg.isolation())
+	}
+
+	c.templateMu.Lock()
+	defer c.templateMu.Unlock()
+
+	start := time.Now()
+	if err := update(ctx); err != nil {
+		return err
+	}
+
+	if c.cfg.FreezeTemplate {
+		if err := freezeTemplate(ctx, c.cfg, c.pool); err != nil {
+			return err
+		}
+	}
+	if _, err := c.pool.Exec(ctx, fmt.Sprintf("ALTER DATABASE %s is_template=true", pgx.Identifier{c.cfg.Database}.Sanitize())); err != nil {
+		return fmt.Errorf("failed to flag template: %w", err)
+	}
+	c.cfg.progress(StageTemplate, c.cfg.Database, start)
+	return runHook(ctx, c.cfg, "AfterTemplateReady", c.cfg.AfterTemplateReady)
+}
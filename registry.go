@@ -0,0 +1,117 @@
+package brrr
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/moby/moby/api/types/registry"
+	"github.com/moby/moby/client"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+// RegistryAuth are credentials for pulling the image from a private registry.
+type RegistryAuth struct {
+	Username string
+	Password string
+	// IdentityToken is used instead of Username and Password by registries issuing tokens, such as cloud
+	// registries exchanging credentials of their CLI.
+	IdentityToken string
+}
+
+// mirrorImage prefixes image with mirror if it is hosted on Docker Hub, that is if its first path component is not
+// a registry host.
+func mirrorImage(image, mirror string) string {
+	if mirror == "" {
+		return image
+	}
+	if first, _, ok := strings.Cut(image, "/"); ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		return image
+	}
+	return strings.TrimSuffix(mirror, "/") + "/" + image
+}
+
+// registryHost returns the host of the registry image is pulled from.
+func registryHost(image string) string {
+	if first, _, ok := strings.Cut(image, "/"); ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		return first
+	}
+	return "docker.io"
+}
+
+// PullPolicy selects when the image is pulled.
+type PullPolicy string
+
+const (
+	// PullIfNotPresent pulls the image if it is not present locally.
+	PullIfNotPresent PullPolicy = "if-not-present"
+	// PullAlways pulls the image before every start of the container, e.g. to refresh tags such as latest.
+	PullAlways PullPolicy = "always"
+	// PullNever never pulls the image and fails if it is not present locally, for air-gapped CI runners with
+	// pre-baked images.
+	PullNever PullPolicy = "never"
+)
+
+func (cfg Config) pullPolicy() PullPolicy {
+	if cfg.PullPolicy == "" {
+		return PullIfNotPresent
+	}
+	return cfg.PullPolicy
+}
+
+// alwaysPull reports whether testcontainers should pull the image before starting the container. Images pulled
+// with Config.RegistryAuth are pulled by ensureImage instead.
+func (cfg Config) alwaysPull() bool {
+	return cfg.pullPolicy() == PullAlways && cfg.RegistryAuth == nil
+}
+
+// ensureImage applies the pull policy to the image where testcontainers can't, which is checking that the image is
+// present with PullNever, and pulling it with Config.RegistryAuth. Otherwise testcontainers pulls the image with the
+// credentials of the Docker configuration and credential helpers.
+func ensureImage(ctx context.Context, cfg Config) error {
+	policy := cfg.pullPolicy()
+	if policy != PullNever && cfg.RegistryAuth == nil {
+		return nil
+	}
+
+	cli, err := testcontainers.NewDockerClientWithOpts(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create docker client: %w", err)
+	}
+	defer cli.Close()
+
+	if policy != PullAlways {
+		_, err := cli.ImageInspect(ctx, cfg.image())
+		if err == nil {
+			return nil
+		}
+		if !cerrdefs.IsNotFound(err) {
+			return fmt.Errorf("failed to inspect image %s: %w", cfg.image(), err)
+		}
+		if policy == PullNever {
+			return fmt.Errorf("image %s is not present and the pull policy is %s", cfg.image(), policy)
+		}
+	}
+
+	auth, err := json.Marshal(registry.AuthConfig{
+		Username:      cfg.RegistryAuth.Username,
+		Password:      cfg.RegistryAuth.Password,
+		IdentityToken: cfg.RegistryAuth.IdentityToken,
+		ServerAddress: registryHost(cfg.image()),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode registry credentials: %w", err)
+	}
+
+	resp, err := cli.ImagePull(ctx, cfg.image(), client.ImagePullOptions{RegistryAuth: base64.URLEncoding.EncodeToString(auth)})
+	if err != nil {
+		return fmt.Errorf("failed to pull image %s: %w", cfg.image(), err)
+	}
+	if err := resp.Wait(ctx); err != nil {
+		return fmt.Errorf("failed to pull image %s: %w", cfg.image(), err)
+	}
+	return nil
+}
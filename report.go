@@ -0,0 +1,259 @@
+package brrr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Report describes how the template database was built.
+type Report struct {
+	Backend       Backend `json:"backend"`
+	Image         string  `json:"image,omitempty"`
+	ServerVersion string  `json:"server_version"`
+
+	Migrations []StepReport `json:"migrations"`
+	Seeds      []StepReport `json:"seeds"`
+
+	// TemplateSize is the size of the template database in bytes.
+	TemplateSize int64 `json:"template_size"`
+
+	// Fingerprint is a hash of the configuration and the migration and seed files the template was built from.
+	// Equal fingerprints mean equal templates, which makes it usable as a cache key.
+	Fingerprint string `json:"fingerprint"`
+
+	// Setup is the total time spent starting the server and building the template.
+	Setup time.Duration `json:"setup"`
+
+	// Usage summarizes the instances created since setup, as of the call to Report.
+	Usage Usage `json:"usage"`
+}
+
+// Usage summarizes how a container has been used, to spot tests which forget to close their instances or
+// dominate the setup time.
+type Usage struct {
+	InstancesCreated int64 `json:"instances_created"`
+	InstancesDropped int64 `json:"instances_dropped"`
+	// Leaked lists the instances which have not been closed as "name (created at file:line)". Instances of tests
+	// still running are included when reported before Close.
+	Leaked []string `json:"leaked,omitempty"`
+
+	// AverageClone is the average time taken to clone the template, zero if it was never cloned.
+	AverageClone time.Duration `json:"average_clone"`
+	// SlowestSeed is the seed step which took the longest, nil without seeds.
+	SlowestSeed *StepReport `json:"slowest_seed,omitempty"`
+
+	// Lifetime is the time since setup began.
+	Lifetime time.Duration `json:"lifetime"`
+}
+
+// StepReport is a single migration or seed step.
+type StepReport struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration"`
+}
+
+// JSON returns the report serialized as indented JSON.
+func (r Report) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// Report returns a report of the template setup.
+func (c *Container) Report() Report {
+	r := *c.report
+	r.Migrations = append([]StepReport(nil), r.Migrations...)
+	r.Seeds = append([]StepReport(nil), r.Seeds...)
+	r.Usage = c.usage()
+	return r
+}
+
+// usage summarizes the use of c so far.
+func (c *Container) usage() Usage {
+	u := Usage{
+		InstancesCreated: c.metrics.created.Load(),
+		InstancesDropped: c.metrics.dropped.Load(),
+		Leaked:           c.holders(),
+		Lifetime:         time.Since(c.started),
+	}
+
+	c.metrics.mu.Lock()
+	if c.metrics.clones > 0 {
+		u.AverageClone = c.metrics.cloneTime / time.Duration(c.metrics.clones)
+	}
+	c.metrics.mu.Unlock()
+
+	for _, step := range c.report.Seeds {
+		if u.SlowestSeed == nil || step.Duration > u.SlowestSeed.Duration {
+			u.SlowestSeed = &step
+		}
+	}
+	return u
+}
+
+// newReport starts a report for cfg, returning a config whose OnProgress also records into the report until the
+// container is set up.
+func newReport(cfg Config) (Config, *Report) {
+	r := &Report{Backend: cfg.backend()}
+	if r.Backend == Docker || r.Backend == Kubernetes {
+		r.Image = cfg.image()
+	}
+
+	onProgress := cfg.OnProgress
+	cfg.onProgress = onProgress
+	cfg.OnProgress = func(stage string, detail string, elapsed time.Duration) {
+		switch stage {
+		case StageMigration:
+			r.Migrations = append(r.Migrations, StepReport{Name: detail, Duration: elapsed})
+		case StageDump, StageSeed, StageSeedFunc, StageSyntheticData:
+			r.Seeds = append(r.Seeds, StepReport{Name: detail, Duration: elapsed})
+		}
+		if onProgress != nil {
+			onProgress(stage, detail, elapsed)
+		}
+	}
+
+	return cfg, r
+}
+
+// fingerprint hashes the parts of cfg which determine the contents of the template database.
+func fingerprint(cfg Config) (string, error) {
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "backend=%s\nimage=%s\nembedded=%s\ndatabase=%s\nmigration_tool=%s\nmigration_target=%d\n",
+		cfg.backend(), cfg.image(), cfg.EmbeddedVersion, cfg.Database, cfg.migrationTool(), cfg.MigrationTargetVersion)
+	// The server settings include the timezone, which now and the defaults of timestamp columns depend on.
+	_, _ = fmt.Fprintf(h, "args=%q\ncreate=%s\n", cfg.serverArgs(), cfg.createDatabaseOptions())
+	conf, err := cfg.postgresConf()
+	if err != nil {
+		return "", err
+	}
+	_, _ = fmt.Fprintf(h, "conf=%d\n", len(conf))
+	_, _ = h.Write(conf)
+
+	tables := make([]string, 0, len(cfg.SyntheticRows))
+	for table := range cfg.SyntheticRows {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		_, _ = fmt.Fprintf(h, "synthetic=%s:%d\n", table, cfg.SyntheticRows[table])
+	}
+	// JSON sorts the keys of maps, at any depth, and follows pointers.
+	vars, err := json.Marshal(cfg.SeedVars)
+	if err != nil {
+		return "", fmt.Errorf("failed to fingerprint SeedVars: %w", err)
+	}
+	_, _ = fmt.Fprintf(h, "seed_vars=%s\n", vars)
+	if cfg.SyntheticFaker {
+		_, _ = fmt.Fprintf(h, "synthetic_faker\n")
+	}
+	if args := cfg.initdbArgs(); args != "" {
+		_, _ = fmt.Fprintf(h, "initdb=%s\n", args)
+	}
+	for _, ext := range cfg.Extensions {
+		_, _ = fmt.Fprintf(h, "extension=%s\n", ext)
+	}
+
+	// Seed files are hashed as rendered, as templates calling now may render differently from run to run.
+	renderSQL := func(name string, r io.Reader) (io.Reader, error) {
+		if path.Ext(name) != ".sql" {
+			return r, nil
+		}
+		return renderSeed(cfg, name, r)
+	}
+	for _, src := range []struct {
+		dir    string
+		render func(name string, r io.Reader) (io.Reader, error)
+	}{{cfg.MigrationsPath, nil}, {cfg.SeedPath, renderSQL}, {cfg.CSVPath, nil}} {
+		if src.dir == "" {
+			continue
+		}
+		if err := fingerprintFS(h, filepath.ToSlash(src.dir), os.DirFS(src.dir), src.render); err != nil {
+			return "", fmt.Errorf("failed to fingerprint %s: %w", src.dir, err)
+		}
+	}
+	if cfg.DumpPath != "" {
+		if err := fingerprintFile(h, "dump", cfg.DumpPath); err != nil {
+			return "", fmt.Errorf("failed to fingerprint %s: %w", cfg.DumpPath, err)
+		}
+	}
+	if cfg.MigrationsFS != nil {
+		if err := fingerprintFS(h, "migrations fs", cfg.MigrationsFS, nil); err != nil {
+			return "", fmt.Errorf("failed to fingerprint MigrationsFS: %w", err)
+		}
+	}
+	if cfg.SeedFS != nil {
+		if err := fingerprintFS(h, "seed fs", cfg.SeedFS, renderSQL); err != nil {
+			return "", fmt.Errorf("failed to fingerprint SeedFS: %w", err)
+		}
+	}
+	if cfg.CSVFS != nil {
+		if err := fingerprintFS(h, "csv fs", cfg.CSVFS, nil); err != nil {
+			return "", fmt.Errorf("failed to fingerprint CSVFS: %w", err)
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// fingerprintFile hashes the file at name, identified by label, and its contents into h.
+func fingerprintFile(h io.Writer, label, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(h, "%s\n%d\n", label, info.Size())
+	_, err = io.Copy(h, f)
+	return err
+}
+
+// fingerprintFS hashes the names, prefixed with prefix, and contents of the files in fsys into h. The contents are
+// passed through render first, unless it is nil.
+func fingerprintFS(h io.Writer, prefix string, fsys fs.FS, render func(name string, r io.Reader) (io.Reader, error)) error {
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		f, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		var r io.Reader = f
+		if render != nil {
+			if r, err = render(name, f); err != nil {
+				return err
+			}
+		}
+		// The size follows the contents, as rendered contents are only sized once read.
+		_, _ = fmt.Fprintf(h, "%s\n", path.Join(prefix, name))
+		n, err := io.Copy(h, r)
+		_, _ = fmt.Fprintf(h, "\n%d\n", n)
+		return err
+	})
+}
+
+// logUsage logs the usage summary of c.
+func (c *Container) logUsage() {
+	u := c.usage()
+	attrs := []any{"database", c.cfg.Database, "created", u.InstancesCreated, "dropped", u.InstancesDropped,
+		"leaked", len(u.Leaked), "average_clone", u.AverageClone, "lifetime", u.Lifetime}
+	if u.SlowestSeed != nil {
+		attrs = append(attrs, "slowest_seed", u.SlowestSeed.Name, "slowest_seed_duration", u.SlowestSeed.Duration)
+	}
+	c.cfg.logger().Info("Test container usage", attrs...)
+}
@@ -0,0 +1,39 @@
+package brrr
+
+import "testing"
+
+func TestFingerprint(t *testing.T) {
+	mustFingerprint := func(cfg Config) string {
+		t.Helper()
+		fp, err := fingerprint(cfg)
+		if err != nil {
+			t.Fatalf("fingerprint: %v", err)
+		}
+		return fp
+	}
+
+	base := Config{Database: "brrr_fingerprint"}
+	for name, cfg := range map[string]Config{
+		"timezone":      {Database: base.Database, Timezone: "Europe/Stockholm"},
+		"collation":     {Database: base.Database, Collation: "C"},
+		"server params": {Database: base.Database, ServerParams: map[string]string{"search_path": "app"}},
+		"postgres conf": {Database: base.Database, PostgresConfData: []byte("search_path = 'app'\n")},
+		"seed vars":     {Database: base.Database, SeedVars: map[string]any{"TenantID": 42}},
+	} {
+		if mustFingerprint(cfg) == mustFingerprint(base) {
+			t.Errorf("fingerprint did not change with %s", name)
+		}
+	}
+
+	// Seed variables hash by value, not by the addresses of pointers or the iteration order of maps.
+	withVars := func() Config {
+		tenant := 42
+		settings := map[string]any{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5, "f": 6, "g": 7, "h": 8}
+		return Config{Database: base.Database, SeedVars: map[string]any{"Tenant": &tenant, "Settings": settings}}
+	}
+	for range 10 {
+		if mustFingerprint(withVars()) != mustFingerprint(withVars()) {
+			t.Fatal("fingerprint changed for equal seed variables")
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package brrr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+)
+
+// Isolation selects how NewInstance isolates tests from each other.
+type Isolation string
+
+const (
+	// Clone creates a new database from the template for every instance, so instances can be used concurrently.
+	Clone Isolation = "clone"
+	// Restore resets the database itself from a snapshot of the template for every instance, using the snapshot
+	// feature of the testcontainers postgres module. Only one instance exists at a time, NewInstance waits for the
+	// previous one to be closed. Only supported by the Docker backend.
+	Restore Isolation = "restore"
+	// Migrate creates every instance as an empty database and runs the migrations, seeds and TemplateFinalize in
+	// it directly, without a template. It is slower than Clone, but needed when the migrations have effects which
+	// don't survive cloning, such as creating roles or altering system settings.
+	Migrate Isolation = "migrate"
+)
+
+func (cfg Config) isolation() Isolation {
+	if cfg.Isolation == "" {
+		return Clone
+	}
+	return cfg.Isolation
+}
+
+// snapshotName is the name of the database the template is snapshotted to with Restore isolation.
+func snapshotName(cfg Config) string {
+	return cfg.Database + "_snapshot"
+}
+
+// setupSnapshotContainer starts the postgres test container through the testcontainers postgres module, which can
+// snapshot and restore databases.
+func setupSnapshotContainer(ctx context.Context, cfg Config) (*postgres.PostgresContainer, error) {
+	pgContainer, err := postgres.Run(ctx, cfg.image(),
+		testcontainers.CustomizeRequestOption(func(req *testcontainers.GenericContainerRequest) error {
+			*req = postgresContainerRequest(cfg)
+			return nil
+		}),
+		// Snapshots are taken over database/sql, with the driver registered by pgx/stdlib.
+		postgres.WithSQLDriver("pgx"),
+	)
+	if err != nil {
+		if pgContainer != nil {
+			_ = pgContainer.Terminate(context.Background())
+		}
+		return nil, err
+	}
+
+	return pgContainer, nil
+}
+
+// snapshotTemplate snapshots the template database of srv, which must have been started by setupSnapshotContainer.
+func snapshotTemplate(ctx context.Context, cfg Config, srv server) (*postgres.PostgresContainer, error) {
+	docker, ok := srv.(*dockerServer)
+	if !ok {
+		return nil, errors.New("restore isolation requires a container started by brrr")
+	}
+	snapshot, ok := docker.container.(*postgres.PostgresContainer)
+	if !ok {
+		return nil, errors.New("restore isolation requires a container started by brrr")
+	}
+
+	if err := snapshot.Snapshot(ctx, postgres.WithSnapshotName(snapshotName(cfg))); err != nil {
+		return nil, fmt.Errorf("failed to snapshot template database: %w", err)
+	}
+	return snapshot, nil
+}
+
+// restoreInstance waits for the previous instance to be closed, then restores the database from the snapshot and
+// hands it out as the instance.
+func (c *Container) restoreInstance(ctx context.Context, opts []InstanceOption) (_ *DatabaseInstance, err error) {
+	if len(opts) > 0 || c.cfg.UniqueCredentials || c.cfg.InstanceTxIsoLevel != "" || c.cfg.InstanceTTL != 0 ||
+		c.cfg.InstanceConnectionLimit != 0 {
+		return nil, errors.New("instance options are not supported with restore isolation")
+	}
+
+	select {
+	case c.restoring <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() {
+		if err != nil {
+			<-c.restoring
+		}
+	}()
+
+	if err := c.snapshot.Restore(ctx); err != nil {
+		return nil, fmt.Errorf("failed to restore database from snapshot: %w", err)
+	}
+
+	conn, err := c.connect(ctx, c.cfg.url("postgres", c.cfg.Database), c.cfg.Tracer)
+	if err != nil {
+		return nil, err
+	}
+	c.track(c.cfg.Database, caller())
+
+	return &DatabaseInstance{
+		Connection: conn,
+		Name:       c.cfg.Database,
+		container:  c,
+		info:       c.info,
+		opts:       newInstanceOptions(c.cfg, nil),
+	}, nil
+}
+
+// closeRestoredInstance closes the connection of an instance created by restoreInstance and lets the next one be
+// restored. The database is left as is until then.
+func (c *Container) closeRestoredInstance(ctx context.Context, di *DatabaseInstance) error {
+	if c.untrack(di.Name) {
+		defer func() { <-c.restoring }()
+	}
+
+	if err := di.closeDB(); err != nil {
+		return fmt.Errorf("failed to close database handle: %w", err)
+	}
+	if err := di.Connection.Close(ctx); err != nil {
+		return fmt.Errorf("failed to close database connection: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package brrr_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/modfin/brrr"
+)
+
+func newRestoreContainer(tb testing.TB) *brrr.Container {
+	tb.Helper()
+
+	c, err := brrr.NewContainer(brrr.Config{
+		Database:  "brrr_restore",
+		Isolation: brrr.Restore,
+	})
+	if err != nil {
+		tb.Fatalf("NewContainer: %v", err)
+	}
+	tb.Cleanup(func() {
+		if err := c.Close(); err != nil {
+			tb.Errorf("Close: %v", err)
+		}
+	})
+	return c
+}
+
+func TestContainer_NewInstance_Restore(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	c := newRestoreContainer(t)
+
+	di, err := c.NewInstance(ctx)
+	if err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+	if _, err := di.Connection.Exec(ctx, "CREATE TABLE leftover (id int)"); err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+	if err := c.CloseInstance(ctx, di); err != nil {
+		t.Fatalf("CloseInstance: %v", err)
+	}
+
+	di, err = c.NewInstance(ctx)
+	if err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+	defer c.CloseInstance(context.Background(), di)
+
+	var exists bool
+	if err := di.Connection.QueryRow(ctx, "SELECT to_regclass('leftover') IS NOT NULL").Scan(&exists); err != nil {
+		t.Fatalf("look up table: %v", err)
+	}
+	if exists {
+		t.Fatal("table created by the previous instance survived the restore")
+	}
+}
+
+func TestConfig_Isolation_Restore_InstanceDefaults(t *testing.T) {
+	for name, cfg := range map[string]brrr.Config{
+		"ttl":              {InstanceTTL: time.Minute},
+		"connection limit": {InstanceConnectionLimit: 5},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg.Database = "brrr_restore_defaults"
+			cfg.Isolation = brrr.Restore
+			c, err := brrr.NewContainer(cfg)
+			if err == nil {
+				c.Close()
+				t.Fatal("NewContainer succeeded with restore isolation")
+			}
+		})
+	}
+}
+
+func BenchmarkNewInstance_Clone(b *testing.B) {
+	ctx := context.Background()
+	for b.Loop() {
+		di, err := brrr.Default().NewInstance(ctx)
+		if err != nil {
+			b.Fatalf("NewInstance: %v", err)
+		}
+		if err := brrr.Default().CloseInstance(ctx, di); err != nil {
+			b.Fatalf("CloseInstance: %v", err)
+		}
+	}
+}
+
+func BenchmarkNewInstance_Restore(b *testing.B) {
+	ctx := context.Background()
+	c := newRestoreContainer(b)
+	for b.Loop() {
+		di, err := c.NewInstance(ctx)
+		if err != nil {
+			b.Fatalf("NewInstance: %v", err)
+		}
+		if err := c.CloseInstance(ctx, di); err != nil {
+			b.Fatalf("CloseInstance: %v", err)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package brrr
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// reuseLabel marks containers started with Config.Reuse.
+const reuseLabel = "org.modfin.brrr.reuse"
+
+// reapLabel marks the containers the testcontainers reaper removes when the process exits.
+const reapLabel = "org.testcontainers.reap"
+
+// reuseCredentials defaults the credentials of a reusable container to ones derived from cfg, as random ones
+// would differ from those the container was created with by an earlier run.
+func reuseCredentials(cfg Config) Config {
+	if cfg.User == "" {
+		cfg.User = "brrr"
+	}
+	if cfg.Password == "" {
+		sum := sha256.Sum256([]byte("brrr reuse\n" + cfg.image() + "\n" + cfg.Database + "\n" + cfg.User))
+		cfg.Password = hex.EncodeToString(sum[:16])
+	}
+	return cfg
+}
+
+// reuseName returns the name of the reusable container for cfg. Only configurations which would start the
+// container identically share a name, unless it is set with Config.ContainerName.
+func reuseName(cfg Config) (string, error) {
+	if cfg.ContainerName != "" {
+		return cfg.ContainerName, nil
+	}
+
+	conf, err := cfg.postgresConf()
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "image=%s\ndatabase=%s\nuser=%s\npassword=%s\nargs=%q\ninitdb=%s\n",
+		cfg.image(), cfg.Database, cfg.User, cfg.Password, cfg.serverArgs(), cfg.initdbArgs())
+	_, _ = fmt.Fprintf(h, "host_port=%d\nhost_network=%t\nnetwork=%s\naliases=%q\n",
+		cfg.HostPort, cfg.HostNetwork, cfg.Network, cfg.NetworkAliases)
+	_, _ = fmt.Fprintf(h, "memory=%d\ncpus=%g\ncpu_shares=%d\nshm=%d\n",
+		cfg.MemoryLimit, cfg.CPULimit, cfg.CPUShares, cfg.ShmSize)
+	_, _ = h.Write(conf)
+	return "brrr-" + hex.EncodeToString(h.Sum(nil))[:16], nil
+}
+
+// reusesTemplate reports whether the template database may outlive the run, as the server does with Config.Reuse
+// or the External backend, so it is marked with the fingerprint of its configuration.
+func (cfg Config) reusesTemplate() bool {
+	return cfg.Reuse || cfg.backend() == External
+}
+
+// templateCommentPrefix starts the comment on template databases built for Config.Reuse.
+const templateCommentPrefix = "brrr:"
+
+// templateComment is the comment on template databases built for Config.Reuse, recording the fingerprint of the
+// configuration they were built from.
+func templateComment(fp string) string {
+	return templateCommentPrefix + fp
+}
+
+// reusableTemplate reports whether the template database was built by an earlier run with the fingerprint fp.
+// Otherwise the template is stale, and it is replaced by an empty database to build it again in. created is set
+// when the database was just created empty, leaving nothing to replace.
+//
+// Only databases built by brrr are replaced, as an External server may hold databases of others, unless the server
+// was started by brrr itself.
+func reusableTemplate(ctx context.Context, cfg Config, pool *pgxpool.Pool, fp string, created bool) (bool, error) {
+	if created {
+		return false, nil
+	}
+
+	var isTemplate bool
+	var comment *string
+	err := pool.QueryRow(ctx, `
+		SELECT datistemplate, shobj_description(oid, 'pg_database') FROM pg_database WHERE datname = $1`,
+		cfg.Database).Scan(&isTemplate, &comment)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up template database %s: %w", cfg.Database, err)
+	}
+	if isTemplate && comment != nil && *comment == templateComment(fp) {
+		return true, nil
+	}
+	if cfg.backend() == External && (comment == nil || !strings.HasPrefix(*comment, templateCommentPrefix)) {
+		return false, fmt.Errorf("refusing to replace database %s, which was not built by brrr", cfg.Database)
+	}
+
+	ident := pgx.Identifier{cfg.Database}.Sanitize()
+	for _, stmt := range []string{
+		fmt.Sprintf("ALTER DATABASE %s is_template=false", ident),
+		fmt.Sprintf("DROP DATABASE %s WITH (FORCE)", ident),
+		fmt.Sprintf("CREATE DATABASE %s%s", ident, cfg.createDatabaseOptions()),
+	} {
+		if _, err := pool.Exec(ctx, stmt); err != nil {
+			return false, fmt.Errorf("failed to reset stale template database: %w", err)
+		}
+	}
+	return false, nil
+}
+
+// markReusable records the fingerprint fp on the template database, for reusableTemplate of later runs.
+func markReusable(ctx context.Context, cfg Config, pool *pgxpool.Pool, fp string) error {
+	_, err := pool.Exec(ctx, fmt.Sprintf("COMMENT ON DATABASE %s IS %s", pgx.Identifier{cfg.Database}.Sanitize(), quoteLiteral(templateComment(fp))))
+	if err != nil {
+		return fmt.Errorf("failed to mark template database: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package brrr_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/moby/moby/client"
+	"github.com/modfin/brrr"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func TestConfig_Reuse(t *testing.T) {
+	// The reused container outlives Close, so it is removed after the test, and named for this run so a container
+	// left by an earlier run is not reused.
+	name := "brrr-reuse-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	cli, err := testcontainers.NewDockerClientWithOpts(t.Context())
+	if err != nil {
+		t.Fatalf("docker client: %v", err)
+	}
+	t.Cleanup(func() {
+		_, _ = cli.ContainerRemove(context.Background(), name, client.ContainerRemoveOptions{Force: true})
+		cli.Close()
+	})
+
+	var seeded int
+	cfg := brrr.Config{
+		Database:      "brrr_reuse",
+		ContainerName: name,
+		Reuse:         true,
+		SeedFuncCtx: func(ctx context.Context, conn *pgx.Conn, _ string) error {
+			seeded++
+			_, err := conn.Exec(ctx, "CREATE TABLE IF NOT EXISTS reused (id int)")
+			return err
+		},
+	}
+
+	for range 2 {
+		c, err := brrr.NewContainer(cfg)
+		if err != nil {
+			t.Fatalf("NewContainer: %v", err)
+		}
+		di, err := c.NewInstance(t.Context())
+		if err != nil {
+			t.Fatalf("NewInstance: %v", err)
+		}
+		if _, err := di.Connection.Exec(t.Context(), "SELECT FROM reused"); err != nil {
+			t.Fatalf("template was not built: %v", err)
+		}
+		if err := c.CloseInstance(context.Background(), di); err != nil {
+			t.Fatalf("CloseInstance: %v", err)
+		}
+		if err := c.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+	}
+
+	if seeded != 1 {
+		t.Fatalf("expected the template to be built once, got %d", seeded)
+	}
+}
+
+func TestConfig_Persistent(t *testing.T) {
+	ctx := context.Background()
+	name := "brrr-persistent-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	cli, err := testcontainers.NewDockerClientWithOpts(ctx)
+	if err != nil {
+		t.Fatalf("docker client: %v", err)
+	}
+	defer cli.Close()
+	t.Cleanup(func() {
+		_, _ = cli.ContainerRemove(context.Background(), name, client.ContainerRemoveOptions{Force: true})
+	})
+
+	c, err := brrr.NewContainer(brrr.Config{
+		Database:      "brrr_persistent",
+		ContainerName: name,
+		Persistent:    true,
+	})
+	if err != nil {
+		t.Fatalf("NewContainer: %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	res, err := cli.ContainerInspect(ctx, name, client.ContainerInspectOptions{})
+	if err != nil {
+		t.Fatalf("inspect container %s: %v", name, err)
+	}
+	if res.Container.State == nil || !res.Container.State.Running {
+		t.Fatal("expected the container to keep running after Close")
+	}
+	if _, ok := res.Container.Config.Labels["org.testcontainers.reap"]; ok {
+		t.Error("expected the container to be kept from the reaper")
+	}
+}
+
+func TestContainer_RefreshTemplate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	seed := fstest.MapFS{"01_items.sql": {Data: []byte("CREATE TABLE items (id int PRIMARY KEY); INSERT INTO items VALUES (1);")}}
+	c := newContainer(t, sharedServer(brrr.Config{
+		Database: "brrr_refresh",
+		SeedFS:   seed,
+	}))
+
+	count := func() int {
+		t.Helper()
+		di, err := c.NewInstance(ctx)
+		if err != nil {
+			t.Fatalf("NewInstance: %v", err)
+		}
+		defer c.CloseInstance(context.Background(), di)
+
+		var n int
+		if err := di.Connection.QueryRow(ctx, "SELECT count(*) FROM items").Scan(&n); err != nil {
+			t.Fatalf("count items: %v", err)
+		}
+		return n
+	}
+
+	seed["02_more.sql"] = &fstest.MapFile{Data: []byte("INSERT INTO items VALUES (2), (3);")}
+	if err := c.RefreshTemplate(ctx); err != nil {
+		t.Fatalf("RefreshTemplate: %v", err)
+	}
+	if n := count(); n != 3 {
+		t.Errorf("got %d items after refresh, want 3", n)
+	}
+	if got := len(c.Report().Seeds); got != 1 {
+		t.Errorf("got %d seed steps in the setup report, want only the one of setup", got)
+	}
+
+	err := c.RefreshTemplateWith(ctx, func(ctx context.Context, conn *pgx.Conn) error {
+		_, err := conn.Exec(ctx, "DELETE FROM items WHERE id > 1")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("RefreshTemplateWith: %v", err)
+	}
+	if n := count(); n != 1 {
+		t.Errorf("got %d items after refresh, want 1", n)
+	}
+
+	// The template no longer matches the Config, so the next run must not reuse it.
+	var comment string
+	err = c.Instance(t).Connection.QueryRow(ctx, "SELECT shobj_description(oid, 'pg_database') FROM pg_database WHERE datname = 'brrr_refresh'").Scan(&comment)
+	if err != nil {
+		t.Fatalf("look up template comment: %v", err)
+	}
+	if comment != "brrr:modified" {
+		t.Errorf("got template comment %q, want brrr:modified", comment)
+	}
+}
@@ -0,0 +1,112 @@
+package brrr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"syscall"
+
+	"github.com/moby/moby/client"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+const (
+	// sessionLabel records Config.Session on containers.
+	sessionLabel = "brrr.session"
+	// hostLabel and pidLabel record the process which started a container without the testcontainers reaper, so
+	// later runs can remove it once the process is gone.
+	hostLabel = "brrr.host"
+	pidLabel  = "brrr.pid"
+)
+
+// configureReaper applies the reaper settings of cfg to testcontainers, which reads them from the environment once
+// per process, and fails if they were read with other settings already. Without the reaper, the containers left
+// behind by processes which are gone are removed instead.
+func configureReaper(ctx context.Context, cfg Config) error {
+	if cfg.DisableReaper {
+		_ = os.Setenv("TESTCONTAINERS_RYUK_DISABLED", "true")
+	}
+	if cfg.ReaperPrivileged {
+		_ = os.Setenv("TESTCONTAINERS_RYUK_CONTAINER_PRIVILEGED", "true")
+	}
+	if cfg.ReaperRegistry != "" {
+		_ = os.Setenv("TESTCONTAINERS_HUB_IMAGE_NAME_PREFIX", cfg.ReaperRegistry)
+	}
+
+	tc := testcontainers.ReadConfig()
+	if (cfg.DisableReaper && !tc.RyukDisabled) || (cfg.ReaperPrivileged && !tc.RyukPrivileged) ||
+		(cfg.ReaperRegistry != "" && tc.Config.HubImageNamePrefix != cfg.ReaperRegistry) {
+		return errors.New("the testcontainers reaper was configured differently by an earlier container of this process")
+	}
+
+	if !tc.RyukDisabled {
+		return nil
+	}
+	return removeOrphanedContainers(ctx, cfg)
+}
+
+// reaperLabels returns the labels recording the session and, without the testcontainers reaper, the process
+// starting the container.
+func (cfg Config) reaperLabels() map[string]string {
+	labels := map[string]string{}
+	if cfg.Session != "" {
+		labels[sessionLabel] = cfg.Session
+	}
+	if cfg.DisableReaper && cfg.reuseName == "" {
+		host, _ := os.Hostname()
+		labels[hostLabel] = host
+		labels[pidLabel] = strconv.Itoa(os.Getpid())
+	}
+	return labels
+}
+
+// removeOrphanedContainers removes the containers started without the testcontainers reaper by processes of this
+// host which are gone, e.g. after a test binary crashed or was killed before Close.
+func removeOrphanedContainers(ctx context.Context, cfg Config) error {
+	host, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("failed to get host name: %w", err)
+	}
+
+	cli, err := testcontainers.NewDockerClientWithOpts(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create docker client: %w", err)
+	}
+	defer cli.Close()
+
+	list, err := cli.ContainerList(ctx, client.ContainerListOptions{
+		All:     true,
+		Filters: make(client.Filters).Add("label", brrrLabel+"=true", hostLabel+"="+host),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	var removed []string
+	for _, c := range list.Items {
+		pid, err := strconv.Atoi(c.Labels[pidLabel])
+		if err != nil || processRunning(pid) {
+			continue
+		}
+		if _, err := cli.ContainerRemove(ctx, c.ID, client.ContainerRemoveOptions{Force: true, RemoveVolumes: true}); err != nil {
+			return fmt.Errorf("failed to remove orphaned container %s: %w", c.ID, err)
+		}
+		removed = append(removed, c.ID)
+	}
+	if len(removed) > 0 {
+		cfg.logger().Info("Removed orphaned containers", "count", len(removed), "containers", removed)
+	}
+	return nil
+}
+
+// processRunning reports whether the process pid may still be running. Processes which can't be signalled, e.g.
+// as they belong to another user, are assumed to be running.
+func processRunning(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return !errors.Is(p.Signal(syscall.Signal(0)), os.ErrProcessDone)
+}
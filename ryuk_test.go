@@ -0,0 +1,59 @@
+package brrr_test
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moby/moby/client"
+	"github.com/modfin/brrr"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func TestConfig_Session(t *testing.T) {
+	ctx := context.Background()
+	session := "brrr-test-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	newContainer(t, brrr.Config{
+		Database: "brrr_session",
+		Session:  session,
+	})
+
+	cli, err := testcontainers.NewDockerClientWithOpts(ctx)
+	if err != nil {
+		t.Fatalf("docker client: %v", err)
+	}
+	defer cli.Close()
+	list, err := cli.ContainerList(ctx, client.ContainerListOptions{
+		Filters: make(client.Filters).Add("label", "brrr.session="+session),
+	})
+	if err != nil {
+		t.Fatalf("list containers: %v", err)
+	}
+	if len(list.Items) != 1 {
+		t.Errorf("expected one container of the session, got %d", len(list.Items))
+	}
+}
+
+func TestConfig_DisableReaper_Conflict(t *testing.T) {
+	// The test container of TestMain started the reaper, unless it is disabled for the whole run.
+	if testcontainers.ReadConfig().RyukDisabled {
+		t.Skip("the reaper is disabled for the run")
+	}
+	// NewContainer sets the variable read by testcontainers, which is restored after the test.
+	t.Setenv("TESTCONTAINERS_RYUK_DISABLED", os.Getenv("TESTCONTAINERS_RYUK_DISABLED"))
+
+	c, err := brrr.NewContainer(brrr.Config{
+		Database:      "brrr_no_reaper",
+		DisableReaper: true,
+	})
+	if err == nil {
+		c.Close()
+		t.Fatal("NewContainer succeeded with reaper settings conflicting with earlier containers")
+	}
+	if !strings.Contains(err.Error(), "reaper") {
+		t.Errorf("error does not mention the reaper: %v", err)
+	}
+}
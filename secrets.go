@@ -0,0 +1,91 @@
+package brrr
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// CredentialSource supplies the database user and password, so configs don't need to contain literal credentials.
+type CredentialSource interface {
+	Credentials(ctx context.Context) (user, password string, err error)
+}
+
+// CredentialsFunc is a CredentialSource backed by a function, e.g. a lookup in a secret manager.
+type CredentialsFunc func(ctx context.Context) (user, password string, err error)
+
+func (f CredentialsFunc) Credentials(ctx context.Context) (string, string, error) {
+	return f(ctx)
+}
+
+// CredentialsFromEnv reads the user and password from the named environment variables.
+func CredentialsFromEnv(userVar, passwordVar string) CredentialSource {
+	return CredentialsFunc(func(context.Context) (string, string, error) {
+		user, ok := os.LookupEnv(userVar)
+		if !ok {
+			return "", "", fmt.Errorf("environment variable %s is not set", userVar)
+		}
+		password, ok := os.LookupEnv(passwordVar)
+		if !ok {
+			return "", "", fmt.Errorf("environment variable %s is not set", passwordVar)
+		}
+		return user, password, nil
+	})
+}
+
+// CredentialsFromFiles reads the user and password from the named files, e.g. mounted secrets. Surrounding
+// whitespace, such as a trailing newline, is ignored.
+func CredentialsFromFiles(userFile, passwordFile string) CredentialSource {
+	return CredentialsFunc(func(context.Context) (string, string, error) {
+		user, err := os.ReadFile(userFile)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read user: %w", err)
+		}
+		password, err := os.ReadFile(passwordFile)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read password: %w", err)
+		}
+		return strings.TrimSpace(string(user)), strings.TrimSpace(string(password)), nil
+	})
+}
+
+// defaultCredentials generates a random User and Password for servers brrr starts itself, when still empty after
+// resolving the CredentialSource. They are available through ConnectionInfo. External servers are only connected to
+// with the credentials of their DSN, or the defaults of pgconn.ParseConfig for it.
+func defaultCredentials(cfg Config) (Config, error) {
+	if cfg.User == "" {
+		suffix, err := randomSecret()
+		if err != nil {
+			return cfg, err
+		}
+		cfg.User = "brrr_" + suffix[:12]
+	}
+	if cfg.Password == "" {
+		password, err := randomSecret()
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Password = password
+	}
+	return cfg, nil
+}
+
+// resolveCredentials fills in User and Password from the configured CredentialSource. Fields set explicitly win.
+func resolveCredentials(ctx context.Context, cfg Config) (Config, error) {
+	if cfg.Credentials == nil {
+		return cfg, nil
+	}
+
+	user, password, err := cfg.Credentials.Credentials(ctx)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to resolve credentials: %w", err)
+	}
+	if cfg.User == "" {
+		cfg.User = user
+	}
+	if cfg.Password == "" {
+		cfg.Password = password
+	}
+	return cfg, nil
+}
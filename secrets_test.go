@@ -0,0 +1,87 @@
+package brrr_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/modfin/brrr"
+)
+
+func TestCredentialsFromEnv(t *testing.T) {
+	t.Setenv("BRRR_TEST_USER", "alice")
+	t.Setenv("BRRR_TEST_PASSWORD", "s3cret")
+
+	user, password, err := brrr.CredentialsFromEnv("BRRR_TEST_USER", "BRRR_TEST_PASSWORD").Credentials(t.Context())
+	if err != nil {
+		t.Fatalf("Credentials: %v", err)
+	}
+	if user != "alice" || password != "s3cret" {
+		t.Errorf("got %s and %s, want alice and s3cret", user, password)
+	}
+
+	_, _, err = brrr.CredentialsFromEnv("BRRR_TEST_USER", "BRRR_TEST_MISSING").Credentials(t.Context())
+	if err == nil || !strings.Contains(err.Error(), "BRRR_TEST_MISSING") {
+		t.Errorf("expected an error naming the missing variable, got %v", err)
+	}
+}
+
+func TestCredentialsFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	userFile, passwordFile := filepath.Join(dir, "user"), filepath.Join(dir, "password")
+	if err := os.WriteFile(userFile, []byte("alice\n"), 0o600); err != nil {
+		t.Fatalf("write user: %v", err)
+	}
+	if err := os.WriteFile(passwordFile, []byte("  s3cret\n"), 0o600); err != nil {
+		t.Fatalf("write password: %v", err)
+	}
+
+	user, password, err := brrr.CredentialsFromFiles(userFile, passwordFile).Credentials(t.Context())
+	if err != nil {
+		t.Fatalf("Credentials: %v", err)
+	}
+	if user != "alice" || password != "s3cret" {
+		t.Errorf("got %q and %q, want alice and s3cret without surrounding whitespace", user, password)
+	}
+
+	_, _, err = brrr.CredentialsFromFiles(userFile, filepath.Join(dir, "missing")).Credentials(t.Context())
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the missing file to be reported, got %v", err)
+	}
+}
+
+func TestConfig_Credentials(t *testing.T) {
+	info := brrr.Default().ConnectionInfo()
+	wrong := brrr.CredentialsFunc(func(context.Context) (string, string, error) {
+		return info.User, "wrong", nil
+	})
+
+	// The source takes precedence over the credentials in the DSN.
+	c, err := brrr.NewContainer(sharedServer(brrr.Config{Database: "brrr_credentials", Credentials: wrong}))
+	if err == nil {
+		c.Close()
+		t.Fatal("NewContainer succeeded with the wrong password from the credential source")
+	}
+
+	// Fields set explicitly take precedence over the source.
+	newContainer(t, sharedServer(brrr.Config{
+		Database:    "brrr_credentials",
+		Password:    info.Password,
+		Credentials: wrong,
+	}))
+
+	failing := brrr.CredentialsFunc(func(context.Context) (string, string, error) {
+		return "", "", errors.New("secret manager unavailable")
+	})
+	c, err = brrr.NewContainer(sharedServer(brrr.Config{Database: "brrr_credentials", Credentials: failing}))
+	if err == nil {
+		c.Close()
+		t.Fatal("NewContainer succeeded although the credential source failed")
+	}
+	if !strings.Contains(err.Error(), "secret manager unavailable") {
+		t.Errorf("expected the error of the credential source, got %v", err)
+	}
+}
@@ -0,0 +1,427 @@
+package brrr_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/modfin/brrr"
+)
+
+func TestConfig_SeedPath_Statements(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	c := newContainer(t, sharedServer(brrr.Config{
+		Database: "brrr_seed",
+		SeedPath: "testdata/seed",
+	}))
+
+	di, err := c.NewInstance(ctx)
+	if err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+	defer c.CloseInstance(context.Background(), di)
+
+	var notes int
+	if err := di.Connection.QueryRow(ctx, "SELECT count(*) FROM notes WHERE body LIKE '%;%'").Scan(&notes); err != nil {
+		t.Fatalf("count notes: %v", err)
+	}
+	if notes != 3 {
+		t.Errorf("got %d notes, want 3", notes)
+	}
+
+	var tags, nulls int
+	if err := di.Connection.QueryRow(ctx, "SELECT count(*), count(*) FILTER (WHERE name IS NULL) FROM tags").Scan(&tags, &nulls); err != nil {
+		t.Fatalf("count tags: %v", err)
+	}
+	if tags != 3 || nulls != 1 {
+		t.Errorf("got %d tags of which %d null, want 3 of which 1 null", tags, nulls)
+	}
+
+	var count int
+	if err := di.Connection.QueryRow(ctx, "SELECT note_count()").Scan(&count); err != nil {
+		t.Fatalf("note_count: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("note_count() = %d, want 3", count)
+	}
+}
+
+func TestConfig_SeedPath_ErrorPosition(t *testing.T) {
+	c, err := brrr.NewContainer(sharedServer(brrr.Config{
+		Database: "brrr_seed_broken",
+		SeedPath: "testdata/seed_broken",
+	}))
+	if err == nil {
+		c.Close()
+		t.Fatal("NewContainer succeeded with a broken seed file")
+	}
+	if want := "statement 3 in 01_broken.sql at line 7"; !strings.Contains(err.Error(), want) {
+		t.Errorf("error %q does not contain %q", err, want)
+	}
+}
+
+func TestConfig_SeedPath_Transaction(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	seed := fstest.MapFS{
+		"01_schema.sql": {Data: []byte("CREATE TABLE colors (name text);")},
+	}
+	c := newContainer(t, sharedServer(brrr.Config{
+		Database: "brrr_seed_tx",
+		SeedFS:   seed,
+	}))
+
+	seed["02_broken.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE partial (id int);\nSELECT missing_column;")}
+	if err := c.RefreshTemplate(ctx); err == nil {
+		t.Fatal("RefreshTemplate succeeded with a broken seed file")
+	}
+
+	err := c.RefreshTemplateWith(ctx, func(ctx context.Context, conn *pgx.Conn) error {
+		var colors, partial bool
+		if err := conn.QueryRow(ctx, "SELECT to_regclass('colors') IS NOT NULL, to_regclass('partial') IS NOT NULL").Scan(&colors, &partial); err != nil {
+			return err
+		}
+		if !colors || partial {
+			t.Errorf("got colors %t and partial %t, want only the tables of the files which succeeded", colors, partial)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RefreshTemplateWith: %v", err)
+	}
+}
+
+func TestConfig_SeedFS(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	c := newContainer(t, sharedServer(brrr.Config{
+		Database: "brrr_seed_fs",
+		SeedFS: fstest.MapFS{
+			"01_schema.sql": {Data: []byte("CREATE TABLE colors (name text);")},
+			"02_data.sql":   {Data: []byte("INSERT INTO colors VALUES ('red'), ('blue');")},
+			"README.md":     {Data: []byte("not a seed file")},
+		},
+	}))
+
+	di, err := c.NewInstance(ctx)
+	if err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+	defer c.CloseInstance(context.Background(), di)
+
+	var colors int
+	if err := di.Connection.QueryRow(ctx, "SELECT count(*) FROM colors").Scan(&colors); err != nil {
+		t.Fatalf("count colors: %v", err)
+	}
+	if colors != 2 {
+		t.Errorf("got %d colors, want 2", colors)
+	}
+}
+
+func TestConfig_Templates(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	schema := fstest.MapFS{"01_schema.sql": {Data: []byte("CREATE TABLE users (id int PRIMARY KEY);")}}
+	c := newContainer(t, sharedServer(brrr.Config{
+		Database: "brrr_templates",
+		SeedFS:   schema,
+		// Templates take the settings of Config which they do not replace, such as SeedVars.
+		SeedVars: map[string]any{"Users": 10},
+		Templates: map[string]brrr.Template{
+			"small-seed": {SeedFS: fstest.MapFS{
+				"01_schema.sql": {Data: []byte("CREATE TABLE users (id int PRIMARY KEY);")},
+				"02_users.sql":  {Data: []byte("INSERT INTO users SELECT generate_series(1, {{.Users}});")},
+			}},
+		},
+	}))
+
+	for _, tc := range []struct {
+		opts []brrr.InstanceOption
+		want int
+	}{
+		{nil, 0},
+		{[]brrr.InstanceOption{brrr.WithTemplate("small-seed")}, 10},
+	} {
+		di, err := c.NewInstance(ctx, tc.opts...)
+		if err != nil {
+			t.Fatalf("NewInstance: %v", err)
+		}
+		var users int
+		if err := di.Connection.QueryRow(ctx, "SELECT count(*) FROM users").Scan(&users); err != nil {
+			t.Fatalf("count users: %v", err)
+		}
+		if users != tc.want {
+			t.Errorf("got %d users, want %d", users, tc.want)
+		}
+		if err := c.CloseInstance(ctx, di); err != nil {
+			t.Fatalf("CloseInstance: %v", err)
+		}
+	}
+
+	if _, err := c.NewInstance(ctx, brrr.WithTemplate("missing")); err == nil {
+		t.Error("NewInstance succeeded with an unknown template")
+	}
+}
+
+func TestConfig_Templates_StaleName(t *testing.T) {
+	c, err := brrr.NewContainer(sharedServer(brrr.Config{
+		Database:  "brrr_templates_stale",
+		Templates: map[string]brrr.Template{"dump_0123abcd": {}},
+	}))
+	if err == nil {
+		c.Close()
+		t.Fatal("NewContainer accepted a template named like a stale instance")
+	}
+}
+
+func TestContainer_NewInstanceWithSeed(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	c := newContainer(t, sharedServer(brrr.Config{
+		Database: "brrr_overlay",
+		SeedFS: fstest.MapFS{
+			"01_schema.sql": {Data: []byte("CREATE TABLE orders (id int PRIMARY KEY, status text NOT NULL);")},
+		},
+	}))
+
+	di, err := c.NewInstanceWithSeed(ctx, "testdata/overlay/orders.sql")
+	if err != nil {
+		t.Fatalf("NewInstanceWithSeed: %v", err)
+	}
+	defer c.CloseInstance(context.Background(), di)
+
+	var refunded int
+	if err := di.Connection.QueryRow(ctx, "SELECT count(*) FROM orders WHERE status = 'refunded'").Scan(&refunded); err != nil {
+		t.Fatalf("count orders: %v", err)
+	}
+	if refunded != 2 {
+		t.Errorf("got %d refunded orders, want 2", refunded)
+	}
+
+	plain, err := c.NewInstance(ctx)
+	if err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+	defer c.CloseInstance(context.Background(), plain)
+
+	var orders int
+	if err := plain.Connection.QueryRow(ctx, "SELECT count(*) FROM orders").Scan(&orders); err != nil {
+		t.Fatalf("count orders: %v", err)
+	}
+	if orders != 0 {
+		t.Errorf("overlay leaked into another instance: got %d orders, want 0", orders)
+	}
+}
+
+func TestConfig_CSVPath(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	c := newContainer(t, sharedServer(brrr.Config{
+		Database: "brrr_csv",
+		SeedFS: fstest.MapFS{
+			"01_schema.sql": {Data: []byte(`
+				CREATE TABLE users (id int PRIMARY KEY, name text NOT NULL, created_at timestamptz NOT NULL DEFAULT now());
+				CREATE TABLE notes (id serial PRIMARY KEY, user_id int NOT NULL REFERENCES users, note text);`)},
+		},
+		CSVPath: "testdata/csv",
+	}))
+
+	di, err := c.NewInstance(ctx)
+	if err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+	defer c.CloseInstance(context.Background(), di)
+
+	var name string
+	if err := di.Connection.QueryRow(ctx, "SELECT name FROM users WHERE id = 2").Scan(&name); err != nil {
+		t.Fatalf("select user: %v", err)
+	}
+	if name != "Bob, Jr." {
+		t.Errorf("got name %q, want %q", name, "Bob, Jr.")
+	}
+
+	var notes, nulls int
+	if err := di.Connection.QueryRow(ctx, "SELECT count(*), count(*) FILTER (WHERE note IS NULL) FROM notes").Scan(&notes, &nulls); err != nil {
+		t.Fatalf("count notes: %v", err)
+	}
+	if notes != 2 || nulls != 1 {
+		t.Errorf("got %d notes of which %d null, want 2 of which 1 null", notes, nulls)
+	}
+}
+
+func TestConfig_SeedVars(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	c := newContainer(t, sharedServer(brrr.Config{
+		Database: "brrr_seed_vars",
+		SeedFS: fstest.MapFS{
+			"01_tenants.sql": {Data: []byte(`
+				CREATE TABLE tenants (id int PRIMARY KEY, name text NOT NULL, trial_ends date NOT NULL);
+				INSERT INTO tenants VALUES ({{.TenantID}}, {{quote .TenantName}}, {{date (now.AddDate 0 0 14)}});`)},
+		},
+		SeedVars: map[string]any{"TenantID": 42, "TenantName": "O'Brien & Co"},
+	}))
+
+	di, err := c.NewInstance(ctx)
+	if err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+	defer c.CloseInstance(context.Background(), di)
+
+	var name string
+	var days int
+	if err := di.Connection.QueryRow(ctx, "SELECT name, trial_ends - current_date FROM tenants WHERE id = 42").Scan(&name, &days); err != nil {
+		t.Fatalf("select tenant: %v", err)
+	}
+	if name != "O'Brien & Co" || days < 13 || days > 15 {
+		t.Errorf("got tenant %q with trial ending in %d days, want %q in 14 days", name, days, "O'Brien & Co")
+	}
+
+	missing, err := brrr.NewContainer(sharedServer(brrr.Config{
+		Database: "brrr_seed_vars_missing",
+		SeedFS:   fstest.MapFS{"01.sql": {Data: []byte("SELECT {{.Missing}};")}},
+		SeedVars: map[string]any{"TenantID": 42},
+	}))
+	if err == nil {
+		missing.Close()
+		t.Fatal("NewContainer succeeded with a missing seed variable")
+	}
+	if !strings.Contains(err.Error(), "Missing") {
+		t.Errorf("error does not name the missing variable: %v", err)
+	}
+}
+
+func TestConfig_SeedVars_Fingerprint(t *testing.T) {
+	fingerprint := func(seed string) string {
+		c, err := brrr.NewContainer(sharedServer(brrr.Config{
+			Database: "brrr_seed_vars_fp",
+			SeedFS:   fstest.MapFS{"01_seed.sql": {Data: []byte(seed)}},
+			SeedVars: map[string]any{"Name": "brrr"},
+		}))
+		if err != nil {
+			t.Fatalf("NewContainer: %v", err)
+		}
+		defer c.Close()
+		return c.Report().Fingerprint
+	}
+
+	static := "SELECT {{quote .Name}};"
+	if fingerprint(static) != fingerprint(static) {
+		t.Error("fingerprint changed for a seed file rendering the same")
+	}
+	changing := "SELECT {{timestamp now}};"
+	if fingerprint(changing) == fingerprint(changing) {
+		t.Error("fingerprint did not change for a seed file rendering differently")
+	}
+}
+
+func TestConfig_DumpPath(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	c := newContainer(t, sharedServer(brrr.Config{
+		Database: "brrr_dump",
+		DumpPath: "testdata/dump/reference.sql",
+		SeedFS: fstest.MapFS{
+			"01_accounts.sql": {Data: []byte("INSERT INTO accounts VALUES (3, 'Seeded');")},
+		},
+	}))
+
+	di, err := c.NewInstance(ctx)
+	if err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+	defer c.CloseInstance(context.Background(), di)
+
+	var accounts int
+	if err := di.Connection.QueryRow(ctx, "SELECT count(*) FROM accounts").Scan(&accounts); err != nil {
+		t.Fatalf("count accounts: %v", err)
+	}
+	if accounts != 3 {
+		t.Errorf("got %d accounts, want the 2 dumped and 1 seeded", accounts)
+	}
+}
+
+func TestContainer_DumpTemplate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	source := newContainer(t, brrr.Config{
+		Database: "brrr_dump_source",
+		SeedFS: fstest.MapFS{
+			"01_accounts.sql": {Data: []byte("CREATE TABLE accounts (id int PRIMARY KEY); INSERT INTO accounts VALUES (1), (2);")},
+		},
+	})
+
+	dumpPath := filepath.Join(t.TempDir(), "template.dump")
+	f, err := os.Create(dumpPath)
+	if err != nil {
+		t.Fatalf("create dump file: %v", err)
+	}
+	if err := source.DumpTemplate(ctx, f); err != nil {
+		t.Fatalf("DumpTemplate: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("close dump file: %v", err)
+	}
+
+	c := newContainer(t, brrr.Config{
+		Database: "brrr_dump_restored",
+		DumpPath: dumpPath,
+	})
+
+	di, err := c.NewInstance(ctx)
+	if err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+	defer c.CloseInstance(context.Background(), di)
+
+	var accounts int
+	if err := di.Connection.QueryRow(ctx, "SELECT count(*) FROM accounts").Scan(&accounts); err != nil {
+		t.Fatalf("count accounts: %v", err)
+	}
+	if accounts != 2 {
+		t.Errorf("got %d accounts, want 2", accounts)
+	}
+
+	// With Migrate isolation, every instance restores the custom format dump itself, concurrently.
+	migrated := newContainer(t, brrr.Config{
+		Database:  "brrr_dump_migrate",
+		Isolation: brrr.Migrate,
+		DumpPath:  dumpPath,
+	})
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Go(func() {
+			di, err := migrated.NewInstance(ctx)
+			if err != nil {
+				t.Errorf("NewInstance: %v", err)
+				return
+			}
+			defer migrated.CloseInstance(context.Background(), di)
+
+			var accounts int
+			if err := di.Connection.QueryRow(ctx, "SELECT count(*) FROM accounts").Scan(&accounts); err != nil {
+				t.Errorf("count accounts: %v", err)
+			} else if accounts != 2 {
+				t.Errorf("got %d accounts, want 2", accounts)
+			}
+		})
+	}
+	wg.Wait()
+}
@@ -0,0 +1,43 @@
+package brrr
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"text/template"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// seedFuncs are the functions available to seed files rendered with Config.SeedVars.
+var seedFuncs = template.FuncMap{
+	"now":       time.Now,
+	"quote":     quoteLiteral,
+	"ident":     func(name string) string { return pgx.Identifier{name}.Sanitize() },
+	"date":      func(t time.Time) string { return quoteLiteral(t.Format(time.DateOnly)) },
+	"timestamp": func(t time.Time) string { return quoteLiteral(t.Format(time.RFC3339Nano)) },
+}
+
+// renderSeed returns the seed file name read from r, rendered as a template with the SeedVars of cfg. Files are
+// returned as is without SeedVars, so braces in existing seed files keep their meaning.
+func renderSeed(cfg Config, name string, r io.Reader) (io.Reader, error) {
+	if len(cfg.SeedVars) == 0 {
+		return r, nil
+	}
+
+	text, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", name, err)
+	}
+	tmpl, err := template.New(name).Funcs(seedFuncs).Option("missingkey=error").Parse(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, cfg.SeedVars); err != nil {
+		return nil, fmt.Errorf("failed to render template %s: %w", name, err)
+	}
+	return &buf, nil
+}
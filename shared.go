@@ -0,0 +1,38 @@
+package brrr
+
+import "sync"
+
+var shared struct {
+	mu        sync.Mutex
+	started   bool
+	container *Container
+	err       error
+}
+
+// Shared returns the process wide container, which is started for cfg by the first call. Later calls return the
+// same container, or the same error, regardless of their cfg, so packages compiled into one test binary share a
+// single server instead of racing to start one each.
+//
+// Callers must not Close the shared container. It is removed by the testcontainers reaper when the process exits,
+// or explicitly with CloseShared, after which the next call starts a new one.
+func Shared(cfg Config) (*Container, error) {
+	shared.mu.Lock()
+	defer shared.mu.Unlock()
+	if !shared.started {
+		shared.container, shared.err = NewContainer(cfg)
+		shared.started = true
+	}
+	return shared.container, shared.err
+}
+
+// CloseShared closes the container started by Shared, if any.
+func CloseShared() error {
+	shared.mu.Lock()
+	defer shared.mu.Unlock()
+	c := shared.container
+	shared.started, shared.container, shared.err = false, nil, nil
+	if c == nil {
+		return nil
+	}
+	return c.Close()
+}
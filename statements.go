@@ -0,0 +1,415 @@
+package brrr
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// statement is a single SQL statement of a seed file.
+type statement struct {
+	sql string
+	// line is the line of the file the statement starts on, counting from 1.
+	line int
+	// copyData reads the inline data following a COPY ... FROM stdin statement, without the terminating \. line.
+	// It is read from the underlying reader as it is consumed, and must be done with before the next statement.
+	copyData io.Reader
+}
+
+// copyFromStdin matches COPY statements reading their data from the lines following them.
+var copyFromStdin = regexp.MustCompile(`(?is)^COPY\b.*\bFROM\s+STDIN\b`)
+
+// statementScanner splits SQL into statements. It understands quoted strings and identifiers, dollar quoted bodies,
+// comments and the inline data of COPY ... FROM stdin, so semicolons inside those do not end a statement.
+type statementScanner struct {
+	r    *bufio.Reader
+	line int
+	// copy is the data of the last COPY ... FROM stdin statement
+	copy *copyReader
+}
+
+func newStatementScanner(r io.Reader) *statementScanner {
+	return &statementScanner{r: bufio.NewReader(r), line: 1}
+}
+
+// atomicBody tracks the words of a statement to find the end of BEGIN ATOMIC ... END function bodies, whose
+// semicolons do not end the statement.
+type atomicBody struct {
+	word strings.Builder
+	prev string
+	// depth counts the BEGIN and CASE blocks open in the body, zero outside of it
+	depth  int
+	inside bool
+}
+
+// add adds the rune r of the statement outside of strings and comments.
+func (a *atomicBody) add(r rune) {
+	if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+		a.word.WriteRune(r)
+		return
+	}
+	a.endWord()
+}
+
+// endWord counts the word read last.
+func (a *atomicBody) endWord() {
+	if a.word.Len() == 0 {
+		return
+	}
+	w := strings.ToUpper(a.word.String())
+	a.word.Reset()
+
+	switch {
+	case !a.inside && a.prev == "BEGIN" && w == "ATOMIC":
+		a.inside, a.depth = true, 1
+	case a.inside && (w == "BEGIN" || w == "CASE"):
+		a.depth++
+	case a.inside && w == "END":
+		a.depth--
+	}
+	a.prev = w
+}
+
+// open reports whether a BEGIN ATOMIC body is still open.
+func (a *atomicBody) open() bool {
+	a.endWord()
+	return a.inside && a.depth > 0
+}
+
+// next returns the next statement, or io.EOF when there are none left. Comments are left out of the statement.
+func (s *statementScanner) next() (statement, error) {
+	var buf strings.Builder
+	var stmt statement
+	var body atomicBody
+
+	// Skip whatever COPY data of the previous statement was not consumed.
+	if s.copy != nil {
+		if _, err := io.Copy(io.Discard, s.copy); err != nil {
+			return stmt, err
+		}
+		s.copy = nil
+	}
+
+	for {
+		r, err := s.read()
+		if err == io.EOF {
+			if buf.Len() == 0 {
+				return stmt, io.EOF
+			}
+			break
+		}
+		if err != nil {
+			return stmt, err
+		}
+
+		// Skip whitespace between statements, so the statement starts at its first token.
+		if buf.Len() == 0 && unicode.IsSpace(r) {
+			continue
+		}
+		if buf.Len() == 0 {
+			stmt.line = s.line
+		}
+
+		switch {
+		case r == '\\' && buf.Len() == 0:
+			// psql meta-commands, such as the \restrict lines of recent pg_dump versions, only apply to psql.
+			if err := s.skipLineComment(); err != nil {
+				return stmt, err
+			}
+
+		case r == ';' && !body.open():
+			stmt.sql = buf.String()
+			return stmt, s.readCopyData(&stmt)
+
+		case r == '-' && s.peek() == '-':
+			// The newline ending the comment is read next, and kept so lines of the statement stay apart.
+			body.endWord()
+			if err := s.skipLineComment(); err != nil {
+				return stmt, err
+			}
+
+		case r == '/' && s.peek() == '*':
+			body.endWord()
+			newlines, err := s.skipBlockComment()
+			if err != nil {
+				return stmt, err
+			}
+			if buf.Len() > 0 {
+				buf.WriteString(strings.Repeat("\n", newlines))
+			}
+
+		case r == '\'':
+			body.endWord()
+			// E'...' strings treat backslashes as escapes.
+			prefix := buf.String()
+			last, size := utf8.DecodeLastRuneInString(prefix)
+			escapes := (last == 'E' || last == 'e') && !endsWithIdentifier(prefix[:len(prefix)-size])
+			buf.WriteRune(r)
+			if err := s.copyQuoted(&buf, '\'', escapes); err != nil {
+				return stmt, err
+			}
+
+		case r == '"':
+			body.endWord()
+			buf.WriteRune(r)
+			if err := s.copyQuoted(&buf, '"', false); err != nil {
+				return stmt, err
+			}
+
+		case r == '$' && !endsWithIdentifier(buf.String()):
+			body.endWord()
+			buf.WriteRune(r)
+			if err := s.copyDollarQuoted(&buf); err != nil {
+				return stmt, err
+			}
+
+		default:
+			body.add(r)
+			buf.WriteRune(r)
+		}
+	}
+
+	stmt.sql = buf.String()
+	return stmt, s.readCopyData(&stmt)
+}
+
+// readCopyData sets up reading the inline data of stmt if it is a COPY ... FROM stdin statement.
+func (s *statementScanner) readCopyData(stmt *statement) error {
+	if !copyFromStdin.MatchString(stmt.sql) {
+		return nil
+	}
+
+	// The data starts on the line after the statement.
+	if _, err := s.readLine(); err != nil && err != io.EOF {
+		return err
+	}
+
+	s.copy = &copyReader{s: s}
+	stmt.copyData = s.copy
+	return nil
+}
+
+// copyReader reads COPY data line by line from a statementScanner, up to the terminating \. line.
+type copyReader struct {
+	s       *statementScanner
+	pending []byte
+	done    bool
+}
+
+func (c *copyReader) Read(p []byte) (int, error) {
+	for len(c.pending) == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+
+		line, err := c.s.readLine()
+		if line == `\.` {
+			c.done = true
+			continue
+		}
+		if err == io.EOF {
+			return 0, errors.New(`COPY data is not terminated by \.`)
+		}
+		if err != nil {
+			return 0, err
+		}
+		c.pending = append(append(c.pending, line...), '\n')
+	}
+
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+func (s *statementScanner) read() (rune, error) {
+	r, _, err := s.r.ReadRune()
+	if r == '\n' {
+		s.line++
+	}
+	return r, err
+}
+
+func (s *statementScanner) peek() rune {
+	r, _, err := s.r.ReadRune()
+	if err != nil {
+		return 0
+	}
+	_ = s.r.UnreadRune()
+	return r
+}
+
+// readLine reads up to and including the next newline, returning the line without it.
+func (s *statementScanner) readLine() (string, error) {
+	line, err := s.r.ReadString('\n')
+	if strings.HasSuffix(line, "\n") {
+		s.line++
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), err
+}
+
+// skipLineComment skips the rest of a -- comment or a line, leaving the newline ending it.
+func (s *statementScanner) skipLineComment() error {
+	for {
+		r := s.peek()
+		if r == '\n' || r == 0 {
+			return nil
+		}
+		if _, err := s.read(); err != nil {
+			return err
+		}
+	}
+}
+
+// skipBlockComment skips a possibly nested /* */ comment whose opening slash has been read, and returns the number
+// of newlines in it.
+func (s *statementScanner) skipBlockComment() (int, error) {
+	start := s.line
+	if _, err := s.read(); err != nil {
+		return 0, err
+	}
+
+	depth := 1
+	var prev rune
+	for {
+		r, err := s.read()
+		if err != nil {
+			return s.line - start, err
+		}
+		switch {
+		case prev == '/' && r == '*':
+			depth++
+			r = 0
+		case prev == '*' && r == '/':
+			depth--
+			if depth == 0 {
+				return s.line - start, nil
+			}
+			r = 0
+		}
+		prev = r
+	}
+}
+
+// copyQuoted copies a string or identifier into buf up to and including its closing quote, whose opening quote
+// has been written.
+func (s *statementScanner) copyQuoted(buf *strings.Builder, quote rune, escapes bool) error {
+	for {
+		r, err := s.read()
+		if err != nil {
+			return err
+		}
+		buf.WriteRune(r)
+
+		switch {
+		case escapes && r == '\\':
+			r, err := s.read()
+			if err != nil {
+				return err
+			}
+			buf.WriteRune(r)
+		case r == quote:
+			// A doubled quote is an escaped quote.
+			if s.peek() != quote {
+				return nil
+			}
+			r, _ := s.read()
+			buf.WriteRune(r)
+		}
+	}
+}
+
+// copyDollarQuoted copies a dollar quoted string such as $body$...$body$ into buf, whose opening dollar sign has
+// been written. Anything else starting with a dollar sign, such as a parameter, is copied as is.
+func (s *statementScanner) copyDollarQuoted(buf *strings.Builder) error {
+	tag := "$"
+	for {
+		r := s.peek()
+		if r == '$' {
+			s.read()
+			tag += "$"
+			break
+		}
+		if !(unicode.IsLetter(r) || r == '_' || (len(tag) > 1 && unicode.IsDigit(r))) {
+			buf.WriteString(tag[1:])
+			return nil
+		}
+		s.read()
+		tag += string(r)
+	}
+	buf.WriteString(tag[1:])
+
+	var body strings.Builder
+	for !strings.HasSuffix(body.String(), tag) {
+		r, err := s.read()
+		if err != nil {
+			buf.WriteString(body.String())
+			return err
+		}
+		body.WriteRune(r)
+	}
+	buf.WriteString(body.String())
+	return nil
+}
+
+// endsWithIdentifier reports whether sql ends with a character which can be part of an identifier.
+func endsWithIdentifier(sql string) bool {
+	if sql == "" {
+		return false
+	}
+	r, _ := utf8.DecodeLastRuneInString(sql)
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '$'
+}
+
+// executeStatements executes the statements read from r one by one. name identifies r in errors.
+func executeStatements(ctx context.Context, conn *pgx.Conn, name string, r io.Reader) error {
+	sc := newStatementScanner(r)
+	for n := 1; ; n++ {
+		stmt, err := sc.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to parse statement %d in %s at line %d: %w", n, name, sc.line, err)
+		}
+
+		if stmt.copyData != nil {
+			// The inline data is sent with the copy protocol, as the server cannot read it from the statement.
+			if _, err := conn.PgConn().CopyFrom(ctx, stmt.copyData, stmt.sql); err != nil {
+				return fmt.Errorf("failed to copy data of statement %d in %s at line %d: %w", n, name, stmt.line, err)
+			}
+			continue
+		}
+		if _, err := conn.Exec(ctx, stmt.sql); err != nil {
+			return fmt.Errorf("failed to execute statement %d in %s at line %d: %w", n, name, errorLine(stmt, err), err)
+		}
+	}
+}
+
+// executeFile executes the statements read from r in a transaction, so a failing statement leaves none of the
+// file behind. name identifies r in errors.
+func executeFile(ctx context.Context, conn *pgx.Conn, name string, r io.Reader) error {
+	return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		return executeStatements(ctx, tx.Conn(), name, r)
+	})
+}
+
+// errorLine returns the line of the file err from executing stmt points at, which is the start of the statement
+// unless the server reported a position in it.
+func errorLine(stmt statement, err error) int {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Position <= 0 {
+		return stmt.line
+	}
+	r := []rune(stmt.sql)
+	pos := min(int(pgErr.Position)-1, len(r))
+	return stmt.line + strings.Count(string(r[:pos]), "\n")
+}
@@ -0,0 +1,107 @@
+package brrr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/client"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+// Stats is the resource usage of the server, see Container.Stats.
+type Stats struct {
+	// MemoryUsage is the memory used by the container in bytes, without the page cache. Only reported by the
+	// Docker backend.
+	MemoryUsage uint64
+	// MemoryLimit is the memory available to the container in bytes. Only reported by the Docker backend.
+	MemoryLimit uint64
+	// CPUTime is the CPU time used by the container since it started. Only reported by the Docker backend.
+	CPUTime time.Duration
+	// DataUsage is the number of bytes used on the file system holding the data directory, a tmpfs unless the
+	// container was attached. Only reported by the Docker backend.
+	DataUsage uint64
+	// DataSize is the size of the file system holding the data directory in bytes. Only reported by the Docker
+	// backend.
+	DataSize uint64
+
+	// Connections is the number of client connections to the server, brrr's own included.
+	Connections int
+	// ActiveConnections is the number of client connections running a query.
+	ActiveConnections int
+}
+
+// statsServer is implemented by servers which can report their resource usage.
+type statsServer interface {
+	// stats sets the resource usage of the server in stats.
+	stats(ctx context.Context, stats *Stats) error
+}
+
+// Stats returns the resource usage of the server and its connection counts from pg_stat_activity, e.g. to assert
+// that a suite stays clear of the memory limit or fills the tmpfs of the data directory.
+func (c *Container) Stats(ctx context.Context) (Stats, error) {
+	var stats Stats
+	err := c.pool.QueryRow(ctx, `
+		SELECT count(*), count(*) FILTER (WHERE state = 'active') FROM pg_stat_activity
+		WHERE backend_type = 'client backend'`).Scan(&stats.Connections, &stats.ActiveConnections)
+	if err != nil {
+		return stats, fmt.Errorf("failed to count connections: %w", err)
+	}
+
+	if srv, ok := c.server.(statsServer); ok {
+		if err := srv.stats(ctx, &stats); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+func (s *dockerServer) stats(ctx context.Context, stats *Stats) error {
+	cli, err := testcontainers.NewDockerClientWithOpts(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create docker client: %w", err)
+	}
+	defer cli.Close()
+
+	res, err := cli.ContainerStats(ctx, s.container.GetContainerID(), client.ContainerStatsOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get container stats: %w", err)
+	}
+	defer res.Body.Close()
+
+	var resp container.StatsResponse
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return fmt.Errorf("failed to decode container stats: %w", err)
+	}
+
+	// Like docker stats, the page cache is left out of the memory usage, which cgroup v1 and v2 name differently.
+	cache := resp.MemoryStats.Stats["inactive_file"]
+	if v1, ok := resp.MemoryStats.Stats["total_inactive_file"]; ok {
+		cache = v1
+	}
+	stats.MemoryUsage = resp.MemoryStats.Usage - min(cache, resp.MemoryStats.Usage)
+	stats.MemoryLimit = resp.MemoryStats.Limit
+	stats.CPUTime = time.Duration(resp.CPUStats.CPUUsage.TotalUsage)
+
+	// Attached containers may keep the data directory elsewhere, the postgres image exports it as PGDATA.
+	out, err := s.run(ctx, []string{"sh", "-c", `df -B1 --output=used,size "$PGDATA"`})
+	if err != nil {
+		return fmt.Errorf("failed to get data directory usage: %w", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) != 2 {
+		return fmt.Errorf("unexpected output of df: %s", out)
+	}
+	if stats.DataUsage, err = strconv.ParseUint(fields[0], 10, 64); err != nil {
+		return fmt.Errorf("unexpected output of df: %w", err)
+	}
+	if stats.DataSize, err = strconv.ParseUint(fields[1], 10, 64); err != nil {
+		return fmt.Errorf("unexpected output of df: %w", err)
+	}
+	return nil
+}
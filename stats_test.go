@@ -0,0 +1,34 @@
+package brrr_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/modfin/brrr"
+)
+
+func TestContainer_Stats(t *testing.T) {
+	c := newContainer(t, brrr.Config{
+		Database:    "brrr_stats",
+		MemoryLimit: 512 << 20,
+	})
+
+	di := c.Instance(t)
+	stats, err := c.Stats(context.Background())
+	if err != nil {
+		t.Fatalf("Stats: %v", err)
+	}
+	if stats.MemoryUsage == 0 || stats.MemoryLimit != 512<<20 {
+		t.Errorf("expected memory usage within the 512MB limit, got %d of %d", stats.MemoryUsage, stats.MemoryLimit)
+	}
+	if stats.CPUTime == 0 {
+		t.Error("expected the server to have used CPU time")
+	}
+	if stats.DataUsage == 0 || stats.DataUsage > stats.DataSize {
+		t.Errorf("expected data directory usage within its size, got %d of %d", stats.DataUsage, stats.DataSize)
+	}
+	// The connection of the instance and the one running the query.
+	if stats.Connections < 2 || stats.ActiveConnections < 1 {
+		t.Errorf("expected the connection of %s, got %d connections and %d active", di.Name, stats.Connections, stats.ActiveConnections)
+	}
+}
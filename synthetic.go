@@ -0,0 +1,320 @@
+package brrr
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// syntheticTable is a table to fill with synthetic rows, as read from the catalog.
+type syntheticTable struct {
+	oid     uint32
+	ident   pgx.Identifier
+	rows    int
+	columns []syntheticColumn
+	fks     []syntheticFK
+}
+
+type syntheticColumn struct {
+	num      int16
+	name     string
+	typ      string // the type as accepted in a cast, e.g. varchar(20)
+	typname  string
+	category string
+	notNull  bool
+	// length is the maximum length of character types, zero if unlimited
+	length int
+	// unique is true for columns with a single column unique constraint or index
+	unique bool
+	// skip is true for columns populated by postgres, i.e. with a default, identity or generated columns
+	skip bool
+}
+
+type syntheticFK struct {
+	parent  uint32
+	columns []int16
+	refs    []string
+}
+
+// generateSyntheticData fills the tables in rows with the given number of synthetic rows each. Tables are keyed by
+// name, optionally qualified with their schema. Parents are filled before their children, and foreign keys refer to
+// existing parent rows, so referenced tables outside rows must already contain data.
+func generateSyntheticData(ctx context.Context, conn *pgx.Conn, rows map[string]int, faker bool, progress func(table string)) error {
+	tables, err := loadSyntheticTables(ctx, conn, rows)
+	if err != nil {
+		return err
+	}
+
+	ordered, err := sortSyntheticTables(tables)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range ordered {
+		query, args, err := t.insertSQL(ctx, conn, faker)
+		if err != nil {
+			return err
+		}
+		if _, err := conn.Exec(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to generate rows for %s: %w", t.ident.Sanitize(), err)
+		}
+		progress(t.ident.Sanitize())
+	}
+	return nil
+}
+
+// loadSyntheticTables reads the columns and foreign keys of the tables in rows.
+func loadSyntheticTables(ctx context.Context, conn *pgx.Conn, rows map[string]int) (map[uint32]*syntheticTable, error) {
+	tables := map[uint32]*syntheticTable{}
+	for name, n := range rows {
+		// to_regclass resolves unqualified names through the search path, like any other query would.
+		var oid *uint32
+		if err := conn.QueryRow(ctx, "SELECT to_regclass($1)::oid", name).Scan(&oid); err != nil {
+			return nil, fmt.Errorf("failed to look up table %s: %w", name, err)
+		}
+		if oid == nil {
+			return nil, fmt.Errorf("table %s for synthetic data does not exist", name)
+		}
+		ident, err := relationIdent(ctx, conn, *oid)
+		if err != nil {
+			return nil, err
+		}
+		tables[*oid] = &syntheticTable{oid: *oid, ident: ident, rows: n}
+	}
+
+	for _, t := range tables {
+		colRows, err := conn.Query(ctx, `
+			SELECT a.attnum, a.attname, format_type(a.atttypid, a.atttypmod), ty.typname, ty.typcategory::text,
+				a.attnotnull, CASE WHEN ty.typname IN ('varchar', 'bpchar') AND a.atttypmod > 4 THEN a.atttypmod - 4 ELSE 0 END,
+				a.atthasdef OR a.attidentity <> '' OR a.attgenerated <> '',
+				EXISTS (SELECT FROM pg_index i WHERE i.indrelid = a.attrelid AND i.indisunique AND i.indkey::int2[] = ARRAY[a.attnum])
+			FROM pg_attribute a JOIN pg_type ty ON ty.oid = a.atttypid
+			WHERE a.attrelid = $1 AND a.attnum > 0 AND NOT a.attisdropped
+			ORDER BY a.attnum`, t.oid)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list columns of %s: %w", t.ident.Sanitize(), err)
+		}
+		t.columns, err = pgx.CollectRows(colRows, func(row pgx.CollectableRow) (syntheticColumn, error) {
+			var c syntheticColumn
+			err := row.Scan(&c.num, &c.name, &c.typ, &c.typname, &c.category, &c.notNull, &c.length, &c.skip, &c.unique)
+			return c, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list columns of %s: %w", t.ident.Sanitize(), err)
+		}
+
+		fkRows, err := conn.Query(ctx, `
+			SELECT con.confrelid, con.conkey,
+				ARRAY(SELECT a.attname FROM unnest(con.confkey) WITH ORDINALITY k(num, ord)
+					JOIN pg_attribute a ON a.attrelid = con.confrelid AND a.attnum = k.num ORDER BY k.ord)
+			FROM pg_constraint con
+			WHERE con.conrelid = $1 AND con.contype = 'f'`, t.oid)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list foreign keys of %s: %w", t.ident.Sanitize(), err)
+		}
+		t.fks, err = pgx.CollectRows(fkRows, func(row pgx.CollectableRow) (syntheticFK, error) {
+			var fk syntheticFK
+			err := row.Scan(&fk.parent, &fk.columns, &fk.refs)
+			return fk, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list foreign keys of %s: %w", t.ident.Sanitize(), err)
+		}
+	}
+
+	return tables, nil
+}
+
+// sortSyntheticTables orders tables so every table comes after the tables it references.
+func sortSyntheticTables(tables map[uint32]*syntheticTable) ([]*syntheticTable, error) {
+	oids := make([]uint32, 0, len(tables))
+	for oid := range tables {
+		oids = append(oids, oid)
+	}
+	// Keep the order of unrelated tables stable between runs.
+	sort.Slice(oids, func(i, j int) bool { return tables[oids[i]].ident.Sanitize() < tables[oids[j]].ident.Sanitize() })
+
+	var ordered []*syntheticTable
+	state := map[uint32]int{} // 1 while visiting, 2 when done
+	var visit func(oid uint32) error
+	visit = func(oid uint32) error {
+		switch state[oid] {
+		case 1:
+			return fmt.Errorf("cannot generate synthetic data for %s, its foreign keys form a cycle", tables[oid].ident.Sanitize())
+		case 2:
+			return nil
+		}
+		state[oid] = 1
+		for _, fk := range tables[oid].fks {
+			if _, ok := tables[fk.parent]; ok && fk.parent != oid {
+				if err := visit(fk.parent); err != nil {
+					return err
+				}
+			}
+		}
+		state[oid] = 2
+		ordered = append(ordered, tables[oid])
+		return nil
+	}
+
+	for _, oid := range oids {
+		if err := visit(oid); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// insertSQL builds the statement inserting the synthetic rows of t. Row i of the child refers to row i of the
+// parent, wrapping around when the parent has fewer rows. With faker, columns get realistic looking values where
+// their names suggest what they hold.
+func (t *syntheticTable) insertSQL(ctx context.Context, conn *pgx.Conn, faker bool) (string, []any, error) {
+	exprs := map[int16]string{}
+	var joins []string
+	args := []any{t.rows}
+
+	for i, fk := range t.fks {
+		parentIdent, err := relationIdent(ctx, conn, fk.parent)
+		if err != nil {
+			return "", nil, err
+		}
+
+		var count int64
+		if fk.parent != t.oid {
+			if err := conn.QueryRow(ctx, fmt.Sprintf("SELECT count(*) FROM %s", parentIdent.Sanitize())).Scan(&count); err != nil {
+				return "", nil, fmt.Errorf("failed to count rows of %s: %w", parentIdent.Sanitize(), err)
+			}
+		}
+
+		if count == 0 {
+			// Self references and empty parents can only be left unset.
+			for _, num := range fk.columns {
+				if c := t.column(num); c.notNull {
+					return "", nil, fmt.Errorf("cannot generate synthetic data for %s, column %s references %s which has no rows",
+						t.ident.Sanitize(), c.name, parentIdent.Sanitize())
+				}
+				exprs[num] = "NULL"
+			}
+			continue
+		}
+
+		alias := fmt.Sprintf("fk%d", i)
+		refs := make([]string, len(fk.refs))
+		for j, ref := range fk.refs {
+			refs[j] = pgx.Identifier{ref}.Sanitize()
+			exprs[fk.columns[j]] = alias + "." + refs[j]
+		}
+		args = append(args, count)
+		joins = append(joins, fmt.Sprintf(
+			"JOIN (SELECT %s, row_number() OVER () AS rn FROM %s) %s ON %s.rn = (g.i - 1) %% $%d + 1",
+			strings.Join(refs, ", "), parentIdent.Sanitize(), alias, alias, len(args)))
+	}
+
+	var names, values []string
+	for _, c := range t.columns {
+		expr, ok := exprs[c.num]
+		if !ok {
+			if c.skip {
+				continue
+			}
+			if faker {
+				expr, ok = c.fakeValue()
+			}
+			if !ok {
+				if expr, ok = c.syntheticValue(); ok && c.unique {
+					if limit := c.distinctValues(); limit > 0 && int64(t.rows) > limit {
+						return "", nil, fmt.Errorf("cannot generate %d distinct values for unique column %s of %s with type %s, at most %d",
+							t.rows, c.name, t.ident.Sanitize(), c.typ, limit)
+					}
+				}
+			}
+			if !ok {
+				if c.notNull {
+					return "", nil, fmt.Errorf("cannot generate synthetic data for column %s of %s with type %s",
+						c.name, t.ident.Sanitize(), c.typ)
+				}
+				expr = "NULL"
+			}
+		}
+		names = append(names, pgx.Identifier{c.name}.Sanitize())
+		values = append(values, expr)
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM generate_series(1, $1::bigint) AS g(i) %s",
+		t.ident.Sanitize(), strings.Join(names, ", "), strings.Join(values, ", "), strings.Join(joins, " "))
+	return query, args, nil
+}
+
+// relationIdent returns the schema qualified name of the table with oid.
+func relationIdent(ctx context.Context, conn *pgx.Conn, oid uint32) (pgx.Identifier, error) {
+	var schema, name string
+	err := conn.QueryRow(ctx, `
+		SELECT n.nspname, c.relname FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.oid = $1`, oid).Scan(&schema, &name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up table %d: %w", oid, err)
+	}
+	return pgx.Identifier{schema, name}, nil
+}
+
+func (t *syntheticTable) column(num int16) syntheticColumn {
+	for _, c := range t.columns {
+		if c.num == num {
+			return c
+		}
+	}
+	return syntheticColumn{}
+}
+
+// syntheticValue returns an expression for the value of the column in row g.i, distinct for every row where the
+// type allows it, so unique constraints hold.
+func (c syntheticColumn) syntheticValue() (string, bool) {
+	switch {
+	case c.typname == "int2":
+		return "(g.i % 32767)::int2", true
+	case c.category == "N":
+		return fmt.Sprintf("g.i::%s", c.typ), true
+	case c.category == "S" && c.length > 0:
+		// Values too long for the type are cut from the start, keeping the row number which makes them distinct.
+		return fmt.Sprintf("right(%s || '_' || g.i, %d)::%s", quoteLiteral(c.name), c.length, c.typ), true
+	case c.category == "S":
+		return fmt.Sprintf("(%s || '_' || g.i)::%s", quoteLiteral(c.name), c.typ), true
+	case c.category == "B":
+		return "g.i % 2 = 0", true
+	case c.category == "D":
+		return fmt.Sprintf("(timestamp '2000-01-01' + g.i * interval '1 minute')::%s", c.typ), true
+	case c.category == "T":
+		return fmt.Sprintf("(g.i * interval '1 second')::%s", c.typ), true
+	case c.category == "E":
+		return fmt.Sprintf("(enum_range(NULL::%[1]s))[(g.i - 1) %% array_length(enum_range(NULL::%[1]s), 1) + 1]", c.typ), true
+	case c.category == "A":
+		return fmt.Sprintf("'{}'::%s", c.typ), true
+	case c.typname == "uuid":
+		return "md5(g.i::text)::uuid", true
+	case c.typname == "json" || c.typname == "jsonb":
+		return fmt.Sprintf("json_build_object('n', g.i)::%s", c.typ), true
+	case c.typname == "bytea":
+		return "int8send(g.i)", true
+	}
+	return "", false
+}
+
+// distinctValues returns the number of distinct values syntheticValue generates for the column, or zero if it is not
+// limited by the type.
+func (c syntheticColumn) distinctValues() int64 {
+	switch {
+	case c.typname == "int2":
+		return 32767
+	case c.category == "S" && c.length > 0 && c.length < 18:
+		// Row numbers stay distinct as long as they fit the length.
+		limit := int64(1)
+		for range c.length {
+			limit *= 10
+		}
+		return limit - 1
+	}
+	return 0
+}
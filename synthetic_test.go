@@ -0,0 +1,127 @@
+package brrr_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/modfin/brrr"
+)
+
+func TestConfig_SyntheticRows(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	c := newContainer(t, sharedServer(brrr.Config{
+		Database: "brrr_synthetic",
+		SeedFuncCtx: func(ctx context.Context, conn *pgx.Conn, _ string) error {
+			_, err := conn.Exec(ctx, `
+				CREATE TYPE status AS ENUM ('active', 'closed');
+				CREATE TABLE customers (id serial PRIMARY KEY, email text NOT NULL UNIQUE, created date NOT NULL);
+				CREATE TABLE orders (
+					id uuid PRIMARY KEY,
+					customer_id int NOT NULL REFERENCES customers,
+					status status NOT NULL,
+					total numeric NOT NULL,
+					parent_id uuid REFERENCES orders
+				);
+				CREATE TABLE codes (code varchar(4) NOT NULL UNIQUE, fixed char(3) NOT NULL UNIQUE);`)
+			return err
+		},
+		SyntheticRows: map[string]int{"orders": 500, "public.customers": 20, "codes": 500},
+	}))
+
+	di, err := c.NewInstance(ctx)
+	if err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+	defer c.CloseInstance(context.Background(), di)
+
+	var customers, orders, customersWithOrders int
+	err = di.Connection.QueryRow(ctx, `
+		SELECT (SELECT count(*) FROM customers), (SELECT count(*) FROM orders),
+			(SELECT count(DISTINCT customer_id) FROM orders)`).Scan(&customers, &orders, &customersWithOrders)
+	if err != nil {
+		t.Fatalf("count rows: %v", err)
+	}
+	if customers != 20 || orders != 500 {
+		t.Errorf("got %d customers and %d orders, want 20 and 500", customers, orders)
+	}
+	if customersWithOrders != 20 {
+		t.Errorf("orders reference %d customers, want all 20", customersWithOrders)
+	}
+
+	// Values too long for their type keep the row number, so they stay distinct.
+	var codes int
+	if err := di.Connection.QueryRow(ctx, "SELECT count(DISTINCT code) FROM codes").Scan(&codes); err != nil {
+		t.Fatalf("count codes: %v", err)
+	}
+	if codes != 500 {
+		t.Errorf("got %d distinct codes, want 500", codes)
+	}
+}
+
+func TestConfig_SyntheticRows_TypeRange(t *testing.T) {
+	_, err := brrr.NewContainer(sharedServer(brrr.Config{
+		Database: "brrr_synthetic_range",
+		SeedFuncCtx: func(ctx context.Context, conn *pgx.Conn, _ string) error {
+			_, err := conn.Exec(ctx, "CREATE TABLE small (id int2 PRIMARY KEY)")
+			return err
+		},
+		SyntheticRows: map[string]int{"small": 40000},
+	}))
+	if err == nil || !strings.Contains(err.Error(), "distinct values") {
+		t.Errorf("expected NewContainer to fail on more rows than int2 holds, got %v", err)
+	}
+}
+
+func TestConfig_SyntheticFaker(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	c := newContainer(t, sharedServer(brrr.Config{
+		Database: "brrr_faker",
+		SeedFuncCtx: func(ctx context.Context, conn *pgx.Conn, _ string) error {
+			_, err := conn.Exec(ctx, `
+				CREATE TABLE people (
+					id serial PRIMARY KEY,
+					email text NOT NULL UNIQUE,
+					first_name varchar(50) NOT NULL,
+					city text NOT NULL UNIQUE,
+					price numeric(10, 2) NOT NULL,
+					birth_date date NOT NULL
+				);`)
+			return err
+		},
+		SyntheticRows:  map[string]int{"people": 200},
+		SyntheticFaker: true,
+	}))
+
+	di, err := c.NewInstance(ctx)
+	if err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+	defer c.CloseInstance(context.Background(), di)
+
+	var rows, emails, names, cities int
+	err = di.Connection.QueryRow(ctx, `
+		SELECT count(*),
+			count(*) FILTER (WHERE email LIKE '%.%@example.com'),
+			count(DISTINCT first_name),
+			count(DISTINCT city)
+		FROM people WHERE birth_date BETWEEN '1950-01-01' AND '2010-01-01'`).Scan(&rows, &emails, &names, &cities)
+	if err != nil {
+		t.Fatalf("query people: %v", err)
+	}
+	if rows != 200 || emails != 200 {
+		t.Errorf("got %d people of which %d with fake emails, want 200 of each", rows, emails)
+	}
+	if names < 2 || names > 20 {
+		t.Errorf("got %d distinct first names, want a few from the fake names", names)
+	}
+	if cities != 200 {
+		t.Errorf("got %d distinct cities, want unique values for the unique column", cities)
+	}
+}
@@ -0,0 +1,161 @@
+package brrr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Template describes an additional template database built next to the one of Config, see Config.Templates. The
+// fields mean the same as the Config fields of the same name, and replace them for the template. Everything else
+// is taken from Config, such as SeedVars, Tracer and the template hooks, except for DumpPath, Migrator, SeedFunc,
+// SyntheticRows, ValidateTemplate and TemplateFinalize, which only apply to the template of Config.
+type Template struct {
+	MigrationsPath string
+	MigrationsFS   fs.FS
+	MigrationTool  MigrationTool
+
+	SeedPath    string
+	SeedFS      fs.FS
+	CSVPath     string
+	CSVFS       fs.FS
+	SeedFuncCtx func(ctx context.Context, conn *pgx.Conn, connStr string) error
+}
+
+// templatesComment is the comment marking the databases of Config.Templates, whose contents are not fingerprinted.
+var templatesComment = templateComment("template")
+
+// templateDatabase returns the name of the database of the template called name.
+func templateDatabase(cfg Config, name string) string {
+	return cfg.Database + "_" + name
+}
+
+// config returns the configuration populating the database of the template called name on the server of cfg.
+func (t Template) config(cfg Config, name string) Config {
+	tcfg := cfg
+	tcfg.Database = templateDatabase(cfg, name)
+	tcfg.Templates = nil
+
+	tcfg.DumpPath = ""
+	tcfg.MigrationsPath = t.MigrationsPath
+	tcfg.MigrationsFS = t.MigrationsFS
+	tcfg.MigrationTool = t.MigrationTool
+	tcfg.MigrationTargetVersion = 0
+	tcfg.Migrator = nil
+	tcfg.SeedPath = t.SeedPath
+	tcfg.SeedFS = t.SeedFS
+	tcfg.CSVPath = t.CSVPath
+	tcfg.CSVFS = t.CSVFS
+	tcfg.SeedFunc = nil
+	tcfg.SeedFuncCtx = t.SeedFuncCtx
+	tcfg.SyntheticRows = nil
+	tcfg.ValidateTemplate = nil
+	tcfg.TemplateFinalize = nil
+	return tcfg
+}
+
+// validateTemplates checks the names and sources of the templates of cfg.
+func validateTemplates(cfg Config) error {
+	if len(cfg.Templates) > 0 && cfg.isolation() != Clone {
+		return errors.New("templates are only supported with Clone isolation")
+	}
+	for name, t := range cfg.Templates {
+		database := templateDatabase(cfg, name)
+		switch {
+		case name == "":
+			return errors.New("template name is required")
+		case strings.ContainsRune(name, 0) || !utf8.ValidString(name):
+			return fmt.Errorf("template name %q is not valid UTF-8 without NUL characters", name)
+		case len(database) > 63:
+			return fmt.Errorf("template database name %q is longer than 63 bytes", database)
+		case stalePattern(cfg.Database).MatchString(database):
+			return fmt.Errorf("template name %q would be dropped as a stale instance", name)
+		case t.MigrationsPath != "" && t.MigrationsFS != nil:
+			return fmt.Errorf("template %s: only one of MigrationsPath and MigrationsFS may be set", name)
+		case t.SeedPath != "" && t.SeedFS != nil:
+			return fmt.Errorf("template %s: only one of SeedPath and SeedFS may be set", name)
+		case t.CSVPath != "" && t.CSVFS != nil:
+			return fmt.Errorf("template %s: only one of CSVPath and CSVFS may be set", name)
+		}
+	}
+	return nil
+}
+
+// buildTemplates builds the templates of cfg from scratch, in name order. Their contents are not fingerprinted, so
+// they are rebuilt even when reusing a server.
+func buildTemplates(ctx context.Context, cfg Config, srv server, pool *pgxpool.Pool) error {
+	names := make([]string, 0, len(cfg.Templates))
+	for name := range cfg.Templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		start := time.Now()
+		tcfg := cfg.Templates[name].config(cfg, name)
+
+		ident := pgx.Identifier{tcfg.Database}.Sanitize()
+		var comment *string
+		err := pool.QueryRow(ctx, "SELECT shobj_description(oid, 'pg_database') FROM pg_database WHERE datname = $1", tcfg.Database).Scan(&comment)
+		exists := err == nil
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("failed to look up template %s: %w", name, err)
+		}
+		// Like the template of Config, databases on External servers are only replaced when brrr built them.
+		if exists && cfg.backend() == External && (comment == nil || *comment != templatesComment) {
+			return fmt.Errorf("refusing to replace database %s of template %s, which was not built by brrr", tcfg.Database, name)
+		}
+		stmts := []string{
+			fmt.Sprintf("CREATE DATABASE %s%s", ident, cfg.createDatabaseOptions()),
+			fmt.Sprintf("COMMENT ON DATABASE %s IS %s", ident, quoteLiteral(templatesComment)),
+		}
+		if exists {
+			stmts = append([]string{
+				fmt.Sprintf("ALTER DATABASE %s is_template=false", ident),
+				fmt.Sprintf("DROP DATABASE %s WITH (FORCE)", ident),
+			}, stmts...)
+		}
+		for _, stmt := range stmts {
+			if _, err := pool.Exec(ctx, stmt); err != nil {
+				return fmt.Errorf("failed to create template %s: %w", name, err)
+			}
+		}
+
+		if err := populateDatabase(ctx, tcfg, srv); err != nil {
+			return fmt.Errorf("failed to build template %s: %w", name, err)
+		}
+		if cfg.FreezeTemplate {
+			if err := freezeTemplate(ctx, tcfg, pool); err != nil {
+				return err
+			}
+		}
+		if _, err := pool.Exec(ctx, fmt.Sprintf("ALTER DATABASE %s is_template=true", ident)); err != nil {
+			return fmt.Errorf("failed to flag template %s: %w", name, err)
+		}
+		cfg.progress(StageTemplate, name, start)
+
+		if err := runHook(ctx, tcfg, "AfterTemplateReady", tcfg.AfterTemplateReady); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// templateFor returns the database instances with the options o are cloned from.
+func (c *Container) templateFor(o instanceOptions) (string, error) {
+	if o.template == "" {
+		return c.cfg.Database, nil
+	}
+	if _, ok := c.cfg.Templates[o.template]; !ok {
+		return "", fmt.Errorf("unknown template %q", o.template)
+	}
+	return templateDatabase(c.cfg, o.template), nil
+}
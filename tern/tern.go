@@ -0,0 +1,83 @@
+// Package tern registers the brrr.Tern migration tool, which runs jackc/tern migrations:
+//
+//	import _ "github.com/modfin/brrr/tern"
+package tern
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/tern/v2/migrate"
+	"github.com/modfin/brrr"
+)
+
+func init() {
+	brrr.RegisterMigrationTool(brrr.Tern, open)
+}
+
+// versionTable is the table tern keeps the schema version in, the default of the tern CLI.
+const versionTable = "schema_version"
+
+// steps steps through tern migrations.
+type steps struct {
+	conn *pgx.Conn
+	m    *migrate.Migrator
+	// applied is the number of applied migrations
+	applied int
+}
+
+func open(ctx context.Context, dsn string, fsys fs.FS) (_ brrr.MigrationSteps, err error) {
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = conn.Close(context.Background())
+		}
+	}()
+
+	m, err := migrate.NewMigrator(ctx, conn, versionTable)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up tern: %w", err)
+	}
+	if err := m.LoadMigrations(fsys); err != nil {
+		return nil, fmt.Errorf("failed to load tern migrations: %w", err)
+	}
+	current, err := m.GetCurrentVersion(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tern version: %w", err)
+	}
+	// Sequences count up from 1 without gaps.
+	return &steps{conn: conn, m: m, applied: int(current)}, nil
+}
+
+func (s *steps) Up(ctx context.Context) (uint64, bool, error) {
+	if s.applied == len(s.m.Migrations) {
+		return 0, true, nil
+	}
+	migration := s.m.Migrations[s.applied]
+	if err := s.m.MigrateTo(ctx, migration.Sequence); err != nil {
+		return 0, false, &brrr.MigrationError{Version: uint64(migration.Sequence), File: migration.Name, Err: err}
+	}
+	s.applied++
+	return uint64(migration.Sequence), false, nil
+}
+
+func (s *steps) Down(ctx context.Context) (uint64, bool, error) {
+	if s.applied == 0 {
+		return 0, true, nil
+	}
+	migration := s.m.Migrations[s.applied-1]
+	if err := s.m.MigrateTo(ctx, migration.Sequence-1); err != nil {
+		return 0, false, fmt.Errorf("failed to revert tern migration %s: %w", migration.Name, err)
+	}
+	s.applied--
+	return uint64(migration.Sequence), false, nil
+}
+
+func (s *steps) Close() error {
+	return s.conn.Close(context.Background())
+}
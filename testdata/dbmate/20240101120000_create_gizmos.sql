@@ -0,0 +1,8 @@
+-- migrate:up
+CREATE TABLE gizmos (
+    id   int PRIMARY KEY,
+    name text NOT NULL
+);
+
+-- migrate:down
+DROP TABLE gizmos;
@@ -0,0 +1,6 @@
+-- migrate:up transaction:false
+CREATE INDEX CONCURRENTLY gizmos_name ON gizmos (name);
+INSERT INTO gizmos (id, name) VALUES (1, 'doohickey');
+
+-- migrate:down
+DROP INDEX gizmos_name;
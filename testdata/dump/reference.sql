@@ -0,0 +1,25 @@
+--
+-- PostgreSQL database dump
+--
+
+\restrict 3bb5d1a2d0c1
+
+SET statement_timeout = 0;
+SET client_encoding = 'UTF8';
+SET standard_conforming_strings = on;
+SELECT pg_catalog.set_config('search_path', '', false);
+
+CREATE TABLE public.accounts (
+    id integer NOT NULL,
+    name text NOT NULL
+);
+
+COPY public.accounts (id, name) FROM stdin;
+1	Reference One
+2	Reference Two
+\.
+
+ALTER TABLE ONLY public.accounts
+    ADD CONSTRAINT accounts_pkey PRIMARY KEY (id);
+
+\unrestrict 3bb5d1a2d0c1
@@ -0,0 +1,8 @@
+-- +goose Up
+CREATE TABLE widgets (
+    id   int PRIMARY KEY,
+    name text NOT NULL
+);
+
+-- +goose Down
+DROP TABLE widgets;
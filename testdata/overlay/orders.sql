@@ -0,0 +1 @@
+INSERT INTO orders (id, status) VALUES (1, 'refunded'), (2, 'refunded');
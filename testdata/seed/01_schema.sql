@@ -0,0 +1,12 @@
+-- Semicolons in comments; strings; and function bodies must not split statements.
+CREATE TABLE notes (id int PRIMARY KEY, body text NOT NULL);
+
+/* A block comment; /* nested; */ still a comment; */
+CREATE FUNCTION add_note(note text) RETURNS void AS $body$
+BEGIN
+    INSERT INTO notes VALUES ((SELECT coalesce(max(id), 0) + 1 FROM notes), note);
+END;
+$body$ LANGUAGE plpgsql;
+
+INSERT INTO notes VALUES (1, 'first; with a semicolon'), (2, E'it\'s escaped;');
+SELECT add_note('third; via function');
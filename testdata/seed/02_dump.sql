@@ -0,0 +1,24 @@
+--
+-- PostgreSQL database dump
+--
+
+\restrict brrr
+
+SET statement_timeout = 0;
+SET client_encoding = 'UTF8';
+SELECT pg_catalog.set_config('search_path', '', false);
+
+CREATE TABLE public.tags (
+    id integer NOT NULL,
+    name text
+);
+
+COPY public.tags (id, name) FROM stdin;
+1	go
+2	postgres; with a semicolon
+3	\N
+\.
+
+SELECT pg_catalog.set_config('search_path', 'public', false);
+
+\unrestrict brrr
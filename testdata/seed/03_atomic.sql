@@ -0,0 +1,8 @@
+-- SQL-standard function bodies contain semicolons which do not end the statement.
+CREATE FUNCTION note_count() RETURNS int
+LANGUAGE sql
+BEGIN ATOMIC
+    SELECT CASE WHEN count(*) > 0 THEN count(*)::int ELSE 0 END FROM notes;
+END;
+
+SELECT note_count();
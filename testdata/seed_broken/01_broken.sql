@@ -0,0 +1,7 @@
+CREATE TABLE notes (id int PRIMARY KEY);
+
+INSERT INTO notes VALUES (1);
+INSERT INTO notes
+-- The second row references a column which does not exist.
+VALUES (2),
+       (missing_column);
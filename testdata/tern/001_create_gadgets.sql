@@ -0,0 +1,8 @@
+CREATE TABLE gadgets (
+    id   int PRIMARY KEY,
+    name text NOT NULL
+);
+
+---- create above / drop below ----
+
+DROP TABLE gadgets;
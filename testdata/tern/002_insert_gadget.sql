@@ -0,0 +1,5 @@
+INSERT INTO gadgets (id, name) VALUES (1, 'widget');
+
+---- create above / drop below ----
+
+DELETE FROM gadgets WHERE id = 1;
@@ -0,0 +1,117 @@
+package brrr
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+// Instance creates a new instance for the test t, which is closed and dropped when the test and its subtests
+// complete, unless the test failed with Config.KeepOnFailure. The test fails immediately if the instance can't be
+// created.
+func (c *Container) Instance(t testing.TB, opts ...InstanceOption) *DatabaseInstance {
+	t.Helper()
+
+	di, err := c.NewInstance(t.Context(), opts...)
+	if err != nil {
+		t.Fatalf("failed to create database instance: %v", err)
+	}
+	// Name the test in leak reports, the cleanup closes the instance unless the process exits before.
+	c.track(di.Name, caller()+" in "+t.Name())
+	t.Cleanup(func() {
+		if t.Failed() {
+			c.failed.Store(true)
+			if c.cfg.FailureDumpDir != "" {
+				di.dumpOnFailure(t, c.cfg.FailureDumpDir)
+			}
+			if c.cfg.KeepOnFailure {
+				c.keepInstance(di)
+				t.Logf("kept database %s of the failed test at %s", di.Name, di.URL())
+				return
+			}
+		}
+		// The test context is already cancelled when cleanups run.
+		if err := c.CloseInstance(context.Background(), di); err != nil {
+			t.Errorf("failed to close database instance %s: %v", di.Name, err)
+		}
+	})
+	return di
+}
+
+// DumpOnFailure writes a plain SQL dump of the instance to dir when the test t fails, before the instance is
+// dropped, e.g. into the artifacts directory of a CI pipeline. It must be called after the instance was created
+// for t, as cleanups run in reverse. See Config.FailureDumpDir to dump the instances of every failed test.
+func (di *DatabaseInstance) DumpOnFailure(t testing.TB, dir string) {
+	t.Cleanup(func() {
+		if t.Failed() {
+			di.dumpOnFailure(t, dir)
+		}
+	})
+}
+
+// failedTestName matches the characters of test names which are replaced in the names of dump files.
+var failedTestName = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// dumpOnFailure dumps the instance of the failed test t to a file in dir named after the test.
+func (di *DatabaseInstance) dumpOnFailure(t testing.TB, dir string) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Errorf("failed to create dump directory: %v", err)
+		return
+	}
+	path := filepath.Join(dir, failedTestName.ReplaceAllString(t.Name(), "_")+"_"+di.Name+".sql")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Errorf("failed to create dump of database %s: %v", di.Name, err)
+		return
+	}
+	defer f.Close()
+
+	if err := di.Dump(context.Background(), f); err != nil {
+		t.Errorf("failed to dump database %s: %v", di.Name, err)
+		return
+	}
+	t.Logf("dumped database %s of the failed test to %s", di.Name, path)
+}
+
+// mainContainer is the container started by Main.
+var mainContainer *Container
+
+// Main starts a container for cfg, runs the tests of m and closes the container, returning the exit code for
+// os.Exit. The container is available to the tests through Default. It is meant to be called from TestMain:
+//
+//	func TestMain(m *testing.M) {
+//		os.Exit(brrr.Main(m, brrr.Config{Database: "app", MigrationsPath: "migrations"}))
+//	}
+//
+// A test panicking exits the test binary without returning from m.Run, so the container is not closed then.
+// Like after the process is killed, it is left to the testcontainers reaper, or to be found by its Config.Labels.
+func Main(m *testing.M, cfg Config) (code int) {
+	c, err := NewContainer(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "brrr: failed to start container: %v\n", err)
+		return 1
+	}
+	mainContainer = c
+	defer func() {
+		mainContainer = nil
+		if code != 0 {
+			c.failed.Store(true)
+		}
+		if err := c.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "brrr: failed to close container: %v\n", err)
+			if code == 0 {
+				code = 1
+			}
+		}
+	}()
+
+	return m.Run()
+}
+
+// Default returns the container started by Main, or nil outside of it.
+func Default() *Container {
+	return mainContainer
+}
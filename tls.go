@@ -0,0 +1,196 @@
+package brrr
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+// ClientCert holds the PEM encoded certificates for authenticating as Config.ClientCertRole.
+type ClientCert struct {
+	// Role the certificate authenticates as, which is also its common name.
+	Role string
+	// CA is the certificate authority which signed both the server and client certificates.
+	CA []byte
+	// Cert and Key of the client.
+	Cert []byte
+	Key  []byte
+}
+
+// TLSConfig returns a TLS config presenting the client certificate and verifying the server against the CA.
+func (cc *ClientCert) TLSConfig() (*tls.Config, error) {
+	cert, err := tls.X509KeyPair(cc.Cert, cc.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client certificate: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(cc.CA) {
+		return nil, errors.New("failed to load CA certificate")
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      roots,
+		// The server certificate is issued for localhost, regardless of the address the server is reached on.
+		ServerName: "localhost",
+	}, nil
+}
+
+// ClientCert returns the client certificate for Config.ClientCertRole, or nil if it is not configured.
+func (c *Container) ClientCert() *ClientCert {
+	return c.clientCert
+}
+
+// ClientCertConnConfig returns a pgx connection config for database which authenticates as Config.ClientCertRole
+// with its client certificate.
+func (c *Container) ClientCertConnConfig(database string) (*pgx.ConnConfig, error) {
+	if c.clientCert == nil {
+		return nil, errors.New("client certificate authentication is not configured")
+	}
+
+	tlsCfg, err := c.clientCert.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := c.cfg
+	cfg.User, cfg.Password = c.clientCert.Role, ""
+	connCfg, err := pgx.ParseConfig(cfg.url("postgres", database))
+	if err != nil {
+		return nil, err
+	}
+	connCfg.TLSConfig = tlsCfg
+	connCfg.Fallbacks = nil
+	return connCfg, nil
+}
+
+// certAuthScript installs the server certificate in the data directory, enables TLS and requires certificate
+// authentication for TLS connections of the client certificate role, leaving other roles to the rules of the
+// image. It runs as an init script, before the server is started for real.
+const certAuthScript = `#!/bin/sh
+set -e
+install -m 0600 /brrr/tls/server.key "$PGDATA/server.key"
+install -m 0644 /brrr/tls/server.crt "$PGDATA/server.crt"
+install -m 0644 /brrr/tls/ca.crt "$PGDATA/ca.crt"
+cat >> "$PGDATA/postgresql.conf" <<EOF
+ssl = on
+ssl_cert_file = 'server.crt'
+ssl_key_file = 'server.key'
+ssl_ca_file = 'ca.crt'
+EOF
+cat /brrr/tls/pg_hba.conf "$PGDATA/pg_hba.conf" > "$PGDATA/pg_hba.conf.brrr"
+mv "$PGDATA/pg_hba.conf.brrr" "$PGDATA/pg_hba.conf"
+`
+
+// certAuthFiles generates a CA, a server certificate and a client certificate for role, and returns the client
+// certificate together with the files setting up the container for certificate authentication.
+func certAuthFiles(role string) (*ClientCert, []testcontainers.ContainerFile, error) {
+	caKey, caCert, caPEM, err := newCertificate(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "brrr CA"},
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+	}, nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serverKey, _, serverPEM, err := newCertificate(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		DNSNames:    []string{"localhost"},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, caCert, caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	clientKey, _, clientPEM, err := newCertificate(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: role},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, caCert, caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serverKeyPEM, err := encodeKey(serverKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	clientKeyPEM, err := encodeKey(clientKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The key is copied into the data directory with restrictive permissions by the init script, which runs as
+	// the postgres user, so it has to be readable here.
+	files := []testcontainers.ContainerFile{
+		{Reader: bytes.NewReader(caPEM), ContainerFilePath: "/brrr/tls/ca.crt", FileMode: 0o644},
+		{Reader: bytes.NewReader(serverPEM), ContainerFilePath: "/brrr/tls/server.crt", FileMode: 0o644},
+		{Reader: bytes.NewReader(serverKeyPEM), ContainerFilePath: "/brrr/tls/server.key", FileMode: 0o644},
+		{Reader: strings.NewReader(certAuthHBA(role)), ContainerFilePath: "/brrr/tls/pg_hba.conf", FileMode: 0o644},
+		{Reader: bytes.NewReader([]byte(certAuthScript)), ContainerFilePath: "/docker-entrypoint-initdb.d/zz-brrr-tls.sh", FileMode: 0o755},
+	}
+
+	return &ClientCert{Role: role, CA: caPEM, Cert: clientPEM, Key: clientKeyPEM}, files, nil
+}
+
+// certAuthHBA returns the pg_hba.conf line requiring certificate authentication for TLS connections of role.
+func certAuthHBA(role string) string {
+	// Double quotes keep the role name literal, and are doubled inside it like in SQL identifiers.
+	return fmt.Sprintf("hostssl all \"%s\" all cert\n", strings.ReplaceAll(role, `"`, `""`))
+}
+
+// newCertificate creates a key and a certificate from template, signed by parent or self-signed if parent is nil.
+func newCertificate(template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*ecdsa.PrivateKey, *x509.Certificate, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	template.SerialNumber = serial
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(7 * 24 * time.Hour)
+
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return key, cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
+
+func encodeKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
@@ -0,0 +1,61 @@
+package brrr_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/modfin/brrr"
+)
+
+func TestContainer_ClientCertAuthentication(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	c, err := brrr.NewContainerContext(ctx, brrr.Config{
+		Database:       "brrr_tls",
+		ClientCertRole: "cert_user",
+	})
+	if err != nil {
+		t.Fatalf("NewContainer: %v", err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+
+	connCfg, err := c.ClientCertConnConfig("brrr_tls")
+	if err != nil {
+		t.Fatalf("ClientCertConnConfig: %v", err)
+	}
+	conn, err := pgx.ConnectConfig(ctx, connCfg)
+	if err != nil {
+		t.Fatalf("connect with client certificate: %v", err)
+	}
+	defer conn.Close(ctx)
+
+	var user string
+	var ssl bool
+	err = conn.QueryRow(ctx, "SELECT current_user, ssl FROM pg_stat_ssl WHERE pid = pg_backend_pid()").Scan(&user, &ssl)
+	if err != nil {
+		t.Fatalf("lookup connection: %v", err)
+	}
+	if user != "cert_user" || !ssl {
+		t.Fatalf("expected a TLS connection as cert_user, got user %q ssl %v", user, ssl)
+	}
+
+	// Other roles keep authenticating with their password over TLS.
+	info := c.ConnectionInfo()
+	pwCfg, err := pgx.ParseConfig(fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=require",
+		url.PathEscape(info.User), url.PathEscape(info.Password), net.JoinHostPort(info.Host, strconv.Itoa(info.Port)), info.Database))
+	if err != nil {
+		t.Fatalf("parse config: %v", err)
+	}
+	pwConn, err := pgx.ConnectConfig(ctx, pwCfg)
+	if err != nil {
+		t.Fatalf("connect with password over TLS: %v", err)
+	}
+	defer pwConn.Close(ctx)
+}
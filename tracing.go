@@ -0,0 +1,36 @@
+package brrr
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// tracerName is the instrumentation scope of the spans of brrr.
+const tracerName = "github.com/modfin/brrr"
+
+// startSpan starts the span name as a child of the span in ctx, with the TracerProvider of cfg.
+func (cfg Config) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	provider := cfg.TracerProvider
+	if provider == nil {
+		provider = noop.NewTracerProvider()
+	}
+	return provider.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends span, recording err if it is not nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// databaseAttr is the attribute naming the database a span concerns.
+func databaseAttr(name string) attribute.KeyValue {
+	return attribute.String("db.namespace", name)
+}
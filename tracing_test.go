@@ -0,0 +1,48 @@
+package brrr_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/modfin/brrr"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestConfig_TracerProvider(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	c := newContainer(t, sharedServer(brrr.Config{
+		Database:       "brrr_tracing",
+		SeedPath:       "testdata/seed",
+		TracerProvider: provider,
+	}))
+
+	ctx := context.Background()
+	di, err := c.NewInstance(ctx)
+	if err != nil {
+		t.Fatalf("NewInstance: %v", err)
+	}
+	if err := c.CloseInstance(ctx, di); err != nil {
+		t.Fatalf("CloseInstance: %v", err)
+	}
+
+	spans := map[string]int{}
+	parents := map[string]string{}
+	names := map[string]string{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()]++
+		names[span.SpanContext().SpanID().String()] = span.Name()
+		parents[span.Name()] = span.Parent().SpanID().String()
+	}
+	for _, name := range []string{"brrr.setup", "brrr.server.start", "brrr.template.build", "brrr.seed.file",
+		"brrr.instance.create", "brrr.instance.clone", "brrr.instance.drop"} {
+		if spans[name] == 0 {
+			t.Errorf("no %s span recorded, got %v", name, spans)
+		}
+	}
+	if parent := names[parents["brrr.instance.clone"]]; parent != "brrr.instance.create" {
+		t.Errorf("brrr.instance.clone is a child of %q, want brrr.instance.create", parent)
+	}
+}
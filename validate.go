@@ -0,0 +1,47 @@
+package brrr
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// maxValidationRows is the number of offending rows included in a template validation error.
+const maxValidationRows = 5
+
+// validateTemplate runs the Config.ValidateTemplate queries against conn. A query fails if it errors or returns any
+// rows, which are included in the error.
+func validateTemplate(ctx context.Context, conn *pgx.Conn, queries []string) error {
+	for _, query := range queries {
+		rows, err := conn.Query(ctx, query)
+		if err != nil {
+			return fmt.Errorf("template validation query %q failed: %w", query, err)
+		}
+
+		var found []string
+		var count int
+		for rows.Next() {
+			count++
+			if len(found) == maxValidationRows {
+				continue
+			}
+			values, err := rows.Values()
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("template validation query %q failed: %w", query, err)
+			}
+			found = append(found, fmt.Sprint(values))
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("template validation query %q failed: %w", query, err)
+		}
+
+		if count > 0 {
+			return fmt.Errorf("template validation query %q returned %d rows, first: %s", query, count, strings.Join(found, "; "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package brrr_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/modfin/brrr"
+)
+
+func TestConfig_ValidateTemplate_Fails(t *testing.T) {
+	c, err := brrr.NewContainer(sharedServer(brrr.Config{
+		Database: "brrr_validate",
+		SeedFuncCtx: func(ctx context.Context, conn *pgx.Conn, _ string) error {
+			_, err := conn.Exec(ctx, `
+				CREATE TABLE users (id int PRIMARY KEY, email text);
+				INSERT INTO users VALUES (1, 'a@example.com'), (2, NULL);`)
+			return err
+		},
+		ValidateTemplate: []string{
+			"SELECT 1 WHERE NOT EXISTS (SELECT FROM users)",
+			"SELECT id FROM users WHERE email IS NULL",
+		},
+	}))
+	if err == nil {
+		c.Close()
+		t.Fatal("NewContainer succeeded with a failing validation query")
+	}
+	if !strings.Contains(err.Error(), "email IS NULL") || !strings.Contains(err.Error(), "[2]") {
+		t.Errorf("error does not name the failing query and row: %v", err)
+	}
+}
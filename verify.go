@@ -0,0 +1,186 @@
+package brrr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// bookkeepingRelations are the tables the migration tools track applied migrations in, with their indexes and
+// sequences, which are left out of schema comparisons.
+var bookkeepingRelations = []string{
+	"schema_migrations", "schema_migrations_pkey",
+	"goose_db_version", "goose_db_version_pkey", "goose_db_version_id_seq",
+	"schema_version",
+}
+
+// schemaQuery lists the objects of a database, one line describing each, for comparing schemas.
+const schemaQuery = `
+WITH ns AS (
+	SELECT oid, nspname FROM pg_namespace
+	WHERE nspname NOT IN ('pg_catalog', 'information_schema') AND nspname NOT LIKE 'pg\_toast%' AND nspname NOT LIKE 'pg\_temp%'
+), rel AS (
+	SELECT c.oid, c.relname, c.relkind, ns.nspname FROM pg_class c JOIN ns ON ns.oid = c.relnamespace
+	WHERE c.relname <> ALL ($1)
+)
+SELECT format('schema %I', nspname) FROM ns
+UNION ALL
+SELECT format('relation %I.%I (%s)', nspname, relname, relkind) FROM rel
+UNION ALL
+SELECT format('column %I.%I.%I %s%s', rel.nspname, rel.relname, a.attname, format_type(a.atttypid, a.atttypmod),
+	CASE WHEN a.attnotnull THEN ' not null' ELSE '' END)
+FROM pg_attribute a JOIN rel ON rel.oid = a.attrelid WHERE a.attnum > 0 AND NOT a.attisdropped
+UNION ALL
+SELECT format('constraint %I.%I %I', rel.nspname, rel.relname, con.conname)
+FROM pg_constraint con JOIN rel ON rel.oid = con.conrelid
+UNION ALL
+SELECT format('trigger %I.%I %I', rel.nspname, rel.relname, t.tgname)
+FROM pg_trigger t JOIN rel ON rel.oid = t.tgrelid WHERE NOT t.tgisinternal
+UNION ALL
+SELECT format('type %I.%I', ns.nspname, t.typname)
+FROM pg_type t JOIN ns ON ns.oid = t.typnamespace WHERE t.typtype IN ('e', 'd', 'r', 'm')
+UNION ALL
+SELECT format('function %I.%I(%s)', ns.nspname, p.proname, pg_get_function_identity_arguments(p.oid))
+FROM pg_proc p JOIN ns ON ns.oid = p.pronamespace
+UNION ALL
+SELECT format('extension %I', extname) FROM pg_extension
+ORDER BY 1`
+
+// schemaObjects returns the sorted descriptions of the objects in the database of conn.
+func schemaObjects(ctx context.Context, conn *pgx.Conn) ([]string, error) {
+	rows, err := conn.Query(ctx, schemaQuery, bookkeepingRelations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+	objects, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+	return objects, nil
+}
+
+// schemaDiff describes the objects of after missing from before and the other way around, or is empty when the
+// schemas are the same.
+func schemaDiff(before, after []string) string {
+	var diff []string
+	for _, object := range after {
+		if !slices.Contains(before, object) {
+			diff = append(diff, "left behind "+object)
+		}
+	}
+	for _, object := range before {
+		if !slices.Contains(after, object) {
+			diff = append(diff, "removed "+object)
+		}
+	}
+	return strings.Join(diff, ", ")
+}
+
+// VerifyMigrations checks that every down migration reverts its up migration. It migrates a scratch database up
+// one migration at a time, all the way down, and up again, and fails on the first down migration which errors or
+// leaves the schema different from before its up migration, naming the objects it left behind or removed. The
+// template is not touched. Not supported with Migrator.
+func (c *Container) VerifyMigrations(ctx context.Context) (err error) {
+	cfg := c.cfg
+	if cfg.Migrator != nil {
+		return errors.New("verifying migrations is not supported with Migrator")
+	}
+	if cfg.MigrationsPath == "" && cfg.MigrationsFS == nil {
+		return errors.New("no migrations to verify")
+	}
+
+	suffix, err := randomSecret()
+	if err != nil {
+		return err
+	}
+	cfg.Database = c.cfg.Database + "_verify_" + suffix[:8]
+	ident := pgx.Identifier{cfg.Database}.Sanitize()
+	if _, err := c.pool.Exec(ctx, fmt.Sprintf("CREATE DATABASE %s%s", ident, cfg.createDatabaseOptions())); err != nil {
+		return fmt.Errorf("failed to create scratch database: %w", err)
+	}
+	defer func() {
+		_, dropErr := c.pool.Exec(context.Background(), fmt.Sprintf("DROP DATABASE %s WITH (FORCE)", ident))
+		if err == nil && dropErr != nil {
+			err = fmt.Errorf("failed to drop scratch database: %w", dropErr)
+		}
+	}()
+
+	conn, err := pgx.Connect(ctx, cfg.url("postgres", cfg.Database))
+	if err != nil {
+		return fmt.Errorf("failed to connect to scratch database: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	steps, err := openMigrationSteps(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := steps.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	// schemas[i] is the schema with the first i migrations applied.
+	initial, err := schemaObjects(ctx, conn)
+	if err != nil {
+		return err
+	}
+	schemas := [][]string{initial}
+	for {
+		_, done, err := steps.Up(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to migrate up: %w", err)
+		}
+		if done {
+			break
+		}
+		schema, err := schemaObjects(ctx, conn)
+		if err != nil {
+			return err
+		}
+		schemas = append(schemas, schema)
+	}
+
+	for i := len(schemas) - 1; i > 0; i-- {
+		version, done, err := steps.Down(ctx)
+		if err != nil && version != 0 {
+			return fmt.Errorf("down migration %d failed: %w", version, err)
+		}
+		if err != nil {
+			return fmt.Errorf("down migration failed: %w", err)
+		}
+		if done {
+			return fmt.Errorf("%d migrations were applied but only %d could be migrated down", len(schemas)-1, len(schemas)-1-i)
+		}
+		schema, err := schemaObjects(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if diff := schemaDiff(schemas[i-1], schema); diff != "" {
+			return fmt.Errorf("down migration %d does not revert its up migration: %s", version, diff)
+		}
+	}
+
+	for {
+		_, done, err := steps.Up(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to migrate up again after migrating down: %w", err)
+		}
+		if done {
+			break
+		}
+	}
+	schema, err := schemaObjects(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if diff := schemaDiff(schemas[len(schemas)-1], schema); diff != "" {
+		return fmt.Errorf("migrating up again after migrating down gives a different schema: %s", diff)
+	}
+	return nil
+}
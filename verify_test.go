@@ -0,0 +1,48 @@
+package brrr_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/modfin/brrr"
+)
+
+func TestContainer_VerifyMigrations(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	c := newContainer(t, sharedServer(brrr.Config{
+		Database: "brrr_verify",
+		MigrationsFS: fstest.MapFS{
+			"1_create_a.up.sql":   {Data: []byte("CREATE TABLE a (id int PRIMARY KEY);")},
+			"1_create_a.down.sql": {Data: []byte("DROP TABLE a;")},
+			"2_create_b.up.sql":   {Data: []byte("CREATE TABLE b (id int); CREATE INDEX b_id ON b (id);")},
+			"2_create_b.down.sql": {Data: []byte("DROP INDEX b_id;")},
+		},
+	}))
+
+	err := c.VerifyMigrations(ctx)
+	if err == nil {
+		t.Fatal("VerifyMigrations succeeded with a down migration leaving a table behind")
+	}
+	if !strings.Contains(err.Error(), "down migration 2") || !strings.Contains(err.Error(), "left behind relation public.b") {
+		t.Errorf("error does not name the migration and its residue: %v", err)
+	}
+}
+
+func TestContainer_VerifyMigrations_Reversible(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	c := newContainer(t, sharedServer(brrr.Config{
+		Database:       "brrr_verify_ok",
+		MigrationsPath: "testdata/migrations",
+	}))
+
+	if err := c.VerifyMigrations(ctx); err != nil {
+		t.Errorf("VerifyMigrations: %v", err)
+	}
+}